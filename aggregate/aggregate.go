@@ -0,0 +1,267 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package aggregate turns downloaded quay logs into pull & push
+// counts grouped by namespace, repo, tag, kind, location & time.
+package aggregate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// Dimension is a property of logs by which the counts are grouped
+type Dimension string
+
+const (
+	// Namespace groups the counts by quay namespace
+	Namespace Dimension = "namespace"
+
+	// Repo groups the counts by `namespace/repo`
+	Repo Dimension = "repo"
+
+	// Tag groups the counts by `namespace/repo:tag`
+	Tag Dimension = "tag"
+
+	// Kind groups the counts by kind of log e.g. pull_repo
+	Kind Dimension = "kind"
+
+	// Country groups the counts by ISO code of the country
+	// the request was made from
+	Country Dimension = "country"
+
+	// City groups the counts by `country/city` of the IP as found by
+	// the GeoIP enrichment e.g. DE/Berlin
+	City Dimension = "city"
+
+	// Network groups the counts by the autonomous system of the IP as
+	// found by the GeoIP enrichment e.g. AS3320 Deutsche Telekom AG
+	Network Dimension = "network"
+
+	// Day groups the counts by date e.g. 2020-08-06
+	Day Dimension = "day"
+
+	// Week groups the counts by ISO week e.g. 2020-W32
+	Week Dimension = "week"
+
+	// Month groups the counts by month e.g. 2020-08
+	Month Dimension = "month"
+)
+
+// Dimensions lists all the supported dimensions
+var Dimensions = []Dimension{
+	Namespace,
+	Repo,
+	Tag,
+	Kind,
+	Country,
+	City,
+	Network,
+	Day,
+	Week,
+	Month,
+}
+
+// UnknownKey is the key of logs that do not have the property
+// of a dimension e.g. logs without a country
+const UnknownKey string = "unknown"
+
+// ParseDimension returns the Dimension of the given name
+func ParseDimension(name string) (Dimension, error) {
+	for _, d := range Dimensions {
+		if string(d) == strings.ToLower(strings.TrimSpace(name)) {
+			return d, nil
+		}
+	}
+	return "", errors.Errorf(
+		"Unsupported dimension %q: Supported dimensions %v",
+		name,
+		Dimensions,
+	)
+}
+
+// isTimeDimension returns true if the given dimension groups by
+// time. These are ordered chronologically instead of by count.
+func isTimeDimension(d Dimension) bool {
+	return d == Day || d == Week || d == Month
+}
+
+// Count holds the number of logs of a group
+type Count struct {
+	Key    string `json:"key"`
+	Pulls  int    `json:"pulls"`
+	Pushes int    `json:"pushes"`
+	// Total is the number of logs of all kinds including pulls
+	// & pushes
+	Total int `json:"total"`
+}
+
+// add counts the given log
+func (c *Count) add(entry gmetrics.Log) {
+	switch entry.Kind {
+	case gmetrics.KindPullRepo:
+		c.Pulls++
+	case gmetrics.KindPushRepo:
+		c.Pushes++
+	}
+	c.Total++
+}
+
+// Aggregator counts logs by all the supported dimensions
+type Aggregator struct {
+	Debug bool
+
+	total  Count
+	counts map[Dimension]map[string]*Count
+}
+
+// NewAggregator returns a new instance of Aggregator
+func NewAggregator() *Aggregator {
+	counts := map[Dimension]map[string]*Count{}
+	for _, d := range Dimensions {
+		counts[d] = map[string]*Count{}
+	}
+	return &Aggregator{
+		counts: counts,
+	}
+}
+
+// Add counts the given log
+func (a *Aggregator) Add(entry gmetrics.Log) {
+	a.total.add(entry)
+	for d, key := range keys(entry) {
+		count, found := a.counts[d][key]
+		if !found {
+			count = &Count{Key: key}
+			a.counts[d][key] = count
+		}
+		count.add(entry)
+	}
+}
+
+// AddLogList counts all the logs of the given list
+func (a *Aggregator) AddLogList(list gmetrics.LogList) {
+	for _, entry := range list.Items {
+		a.Add(entry)
+	}
+}
+
+// AddFiles counts all the logs of the given json files
+func (a *Aggregator) AddFiles(files []string) error {
+	for _, file := range files {
+		got, err := gmetrics.ReadLogListFile(file)
+		if err != nil {
+			return err
+		}
+		a.AddLogList(got)
+	}
+	return nil
+}
+
+// AddFolder counts all the logs stored in the given folder. The
+// folder is expected to be laid out as `<namespace>/<repo>/*.json`
+// e.g. the logs file path of the fetch mode.
+func (a *Aggregator) AddFolder(fpath string) error {
+	return a.AddStorage(storage.NewLocal(fpath))
+}
+
+// AddStorage counts all the logs stored in the given storage. The
+// keys are expected to be laid out as `<namespace>/<repo>/*.json`.
+func (a *Aggregator) AddStorage(store storage.Storage) error {
+	repos, err := gmetrics.ReadRepoLogs(store, a.Debug)
+	if err != nil {
+		return err
+	}
+	for _, repo := range repos {
+		for _, entry := range repo.Items {
+			a.Add(entry)
+		}
+	}
+	return nil
+}
+
+// Total returns the counts of all the logs
+func (a *Aggregator) Total() Count {
+	out := a.total
+	out.Key = "total"
+	return out
+}
+
+// Counts returns the counts grouped by the given dimension
+//
+// Time based dimensions are ordered chronologically. Others are
+// ordered by total in descending order.
+func (a *Aggregator) Counts(d Dimension) []Count {
+	var out []Count
+	for _, count := range a.counts[d] {
+		out = append(out, *count)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if isTimeDimension(d) || out[i].Total == out[j].Total {
+			return out[i].Key < out[j].Key
+		}
+		return out[i].Total > out[j].Total
+	})
+	return out
+}
+
+// keys returns the key of the given log for every dimension
+func keys(entry gmetrics.Log) map[Dimension]string {
+	namespace := orUnknown(entry.Metadata.Namespace)
+	repo := namespace + "/" + orUnknown(entry.Metadata.Repo)
+	out := map[Dimension]string{
+		Namespace: namespace,
+		Repo:      repo,
+		Tag:       repo + ":" + orUnknown(entry.Metadata.Tag),
+		Kind:      orUnknown(string(entry.Kind)),
+		Country:   orUnknown(entry.Country()),
+		City:      UnknownKey,
+		Network:   UnknownKey,
+		Day:       UnknownKey,
+		Week:      UnknownKey,
+		Month:     UnknownKey,
+	}
+	if entry.Geo != nil {
+		if entry.Geo.City != "" {
+			out[City] = orUnknown(entry.Geo.CountryISOCode) + "/" + entry.Geo.City
+		}
+		if entry.Geo.ASN != 0 {
+			out[Network] = strings.TrimSpace(fmt.Sprintf("AS%d %s", entry.Geo.ASN, entry.Geo.Organization))
+		}
+	}
+	t, err := entry.Time()
+	if err == nil {
+		year, week := t.ISOWeek()
+		out[Day] = t.Format(gmetrics.ISODateFormat)
+		out[Week] = fmt.Sprintf("%d-W%02d", year, week)
+		out[Month] = t.Format("2006-01")
+	}
+	return out
+}
+
+// orUnknown returns UnknownKey if the given value is empty
+func orUnknown(value string) string {
+	if value == "" {
+		return UnknownKey
+	}
+	return value
+}
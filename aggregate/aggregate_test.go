@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregate_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/aggregate"
+	"github.com/mayadata.io/quay-logs/quaytest"
+)
+
+func TestAggregatorCounts(t *testing.T) {
+	// Sunday the 2nd of August 2020 is in the 31st ISO week
+	sunday := time.Date(2020, 8, 2, 23, 0, 0, 0, time.UTC)
+	monday := sunday.Add(2 * time.Hour)
+	september := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	a := aggregate.NewAggregator()
+	for _, entry := range []gmetrics.Log{
+		quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: sunday}),
+		quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Time: monday}),
+		quaytest.NewLog(quaytest.LogConfig{Kind: gmetrics.KindPushRepo, Repo: "jiva", Tag: "latest", Country: "US", Time: monday}),
+		quaytest.NewLog(quaytest.LogConfig{Repo: "cstor", Tag: "latest", Country: "IN", Time: september}),
+		quaytest.NewLog(quaytest.LogConfig{Kind: gmetrics.KindDeleteTag, Repo: "cstor", Tag: "latest", Country: "IN", Time: september}),
+		{Kind: gmetrics.KindPullRepo, Datetime: "invalid"},
+	} {
+		a.Add(entry)
+	}
+
+	var tests = map[string]struct {
+		dimension aggregate.Dimension
+		expect    []aggregate.Count
+	}{
+		"repos by total": {
+			dimension: aggregate.Repo,
+			expect: []aggregate.Count{
+				{Key: "openebs/jiva", Pulls: 2, Pushes: 1, Total: 3},
+				{Key: "openebs/cstor", Pulls: 1, Total: 2},
+				{Key: "unknown/unknown", Pulls: 1, Total: 1},
+			},
+		},
+		"kinds": {
+			dimension: aggregate.Kind,
+			expect: []aggregate.Count{
+				{Key: "pull_repo", Pulls: 4, Total: 4},
+				{Key: "delete_tag", Total: 1},
+				{Key: "push_repo", Pushes: 1, Total: 1},
+			},
+		},
+		"unknown country": {
+			dimension: aggregate.Country,
+			expect: []aggregate.Count{
+				{Key: "IN", Pulls: 1, Total: 2},
+				{Key: "US", Pulls: 1, Pushes: 1, Total: 2},
+				{Key: "unknown", Pulls: 2, Total: 2},
+			},
+		},
+		"days in chronological order": {
+			dimension: aggregate.Day,
+			expect: []aggregate.Count{
+				{Key: "2020-08-02", Pulls: 1, Total: 1},
+				{Key: "2020-08-03", Pulls: 1, Pushes: 1, Total: 2},
+				{Key: "2020-09-01", Pulls: 1, Total: 2},
+				{Key: "unknown", Pulls: 1, Total: 1},
+			},
+		},
+		"ISO weeks": {
+			dimension: aggregate.Week,
+			expect: []aggregate.Count{
+				{Key: "2020-W31", Pulls: 1, Total: 1},
+				{Key: "2020-W32", Pulls: 1, Pushes: 1, Total: 2},
+				{Key: "2020-W36", Pulls: 1, Total: 2},
+				{Key: "unknown", Pulls: 1, Total: 1},
+			},
+		},
+		"months": {
+			dimension: aggregate.Month,
+			expect: []aggregate.Count{
+				{Key: "2020-08", Pulls: 2, Pushes: 1, Total: 3},
+				{Key: "2020-09", Pulls: 1, Total: 2},
+				{Key: "unknown", Pulls: 1, Total: 1},
+			},
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			got := a.Counts(mock.dimension)
+			if !reflect.DeepEqual(got, mock.expect) {
+				t.Fatalf("Expected %+v got %+v", mock.expect, got)
+			}
+		})
+	}
+
+	total := a.Total()
+	if total.Pulls != 4 || total.Pushes != 1 || total.Total != 6 {
+		t.Fatalf("Expected 4 pulls & 1 push of 6 logs got %+v", total)
+	}
+}
+
+func TestParseDimension(t *testing.T) {
+	got, err := aggregate.ParseDimension(" Week ")
+	if err != nil || got != aggregate.Week {
+		t.Fatalf("Expected week got %q %v", got, err)
+	}
+	_, err = aggregate.ParseDimension("year")
+	if err == nil {
+		t.Fatalf("Expected error got none")
+	}
+}
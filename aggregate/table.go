@@ -0,0 +1,40 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteTable writes the given counts as a table with the dimension
+// as the first column
+//
+// Only the first top counts are written if top is greater than 0.
+func WriteTable(w io.Writer, d Dimension, counts []Count, top int) error {
+	if top > 0 && len(counts) > top {
+		counts = counts[:top]
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tPULLS\tPUSHES\tTOTAL\n", strings.ToUpper(string(d)))
+	for _, c := range counts {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", c.Key, c.Pulls, c.Pushes, c.Total)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"time"
+)
+
+// Clock provides the current time e.g. to name the downloaded
+// files. Tests may inject a fake clock to get predictable names.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock that returns the system time
+type SystemClock struct{}
+
+// Now returns the system time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// orSystemClock returns SystemClock if the given clock is not set
+func orSystemClock(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock{}
+	}
+	return clock
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// runAnonymize anonymizes the IPs of the stored logs in place. This
+// is a one-off operation to clean up logs downloaded before an IP
+// privacy was set for fetch.
+func runAnonymize(args []string) error {
+	fs := newCommandFlags("anonymize")
+	stores := addStorageFlags(fs)
+	privacy := addPrivacyFlags(fs)
+	debug := addDebugFlag(fs)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	anonymizer, err := privacy.newAnonymizer()
+	if err != nil {
+		return err
+	}
+	if anonymizer == nil {
+		return usageErrorf("Missing ip-privacy")
+	}
+	store, err := stores.newStorage()
+	if err != nil {
+		return err
+	}
+
+	log.Printf(
+		"Will anonymize IPs of logs: Storage %s: Privacy %s",
+		*stores.storageType,
+		anonymizer.Mode,
+	)
+	result, err := gmetrics.AnonymizeStorage(store, anonymizer, *debug)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to anonymize IPs of logs",
+		)
+	}
+	log.Printf(
+		"Anonymized IPs of logs: Files %d: Rewritten %d: Logs %d: Anonymized %d",
+		result.FileCount,
+		result.RewrittenCount,
+		result.LogCount,
+		result.AnonymizedCount,
+	)
+	return nil
+}
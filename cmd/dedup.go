@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// runDedup removes duplicate logs from the files of the storage.
+// This is a one-off operation to clean up logs downloaded by earlier
+// versions of this binary.
+func runDedup(args []string) error {
+	fs := newCommandFlags("dedup")
+	stores := addStorageFlags(fs)
+	debug := addDebugFlag(fs)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	store, err := stores.newStorage()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Will remove duplicate logs: Storage %s", *stores.storageType)
+	result, err := gmetrics.Dedup(store, *debug)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to remove duplicate logs",
+		)
+	}
+	log.Printf(
+		"Removed duplicate logs: Files %d: Rewritten %d: Removed %d: Logs %d: Duplicates %d",
+		result.FileCount,
+		result.RewrittenCount,
+		result.RemovedCount,
+		result.LogCount,
+		result.DuplicateLogCount,
+	)
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// runEnrich sets the country, city, ASN & organisation of the IPs of
+// the stored logs from the GeoIP databases. Values resolved by quay
+// are kept as is.
+func runEnrich(args []string) error {
+	fs := newCommandFlags("enrich")
+	stores := addStorageFlags(fs)
+	geoFiles := addGeoIPFlag(fs)
+	debug := addDebugFlag(fs)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	geo, err := openGeoIP(*geoFiles)
+	if err != nil {
+		return err
+	}
+	if geo == nil {
+		return usageErrorf("Missing geoip-db")
+	}
+	defer geo.Close()
+	store, err := stores.newStorage()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Will enrich logs: Storage %s", *stores.storageType)
+	result, err := gmetrics.EnrichStorage(store, geo, *debug)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to enrich logs",
+		)
+	}
+	log.Printf(
+		"Enriched logs: Files %d: Rewritten %d: Logs %d: Enriched %d: Not found %d",
+		result.FileCount,
+		result.RewrittenCount,
+		result.LogCount,
+		result.EnrichedCount,
+		result.MissCount,
+	)
+	return nil
+}
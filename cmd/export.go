@@ -0,0 +1,236 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/export"
+)
+
+const (
+	// exportLogs exports logs of repos
+	exportLogs string = "logs"
+
+	// exportPopularity exports repos with their popularity
+	exportPopularity string = "popularity"
+)
+
+// runExport writes logs or popularity of repos as CSV
+//
+// Logs are read from the storage unless these are to be fetched
+// from quay. Popularity is always fetched from quay.
+func runExport(args []string) error {
+	fs := newCommandFlags("export")
+	quay := addQuayFlags(fs)
+	stores := addStorageFlags(fs)
+	dates := addDateFlags(fs)
+	debug := addDebugFlag(fs)
+	exportType := fs.String(
+		"type",
+		exportLogs,
+		"(optional) data to export; one of: logs, popularity",
+	)
+	columns := fs.String(
+		"columns",
+		"",
+		"(optional) comma separated columns e.g. datetime,kind,metadata.tag,metadata.resolved_ip.country_iso_code; all columns are written by default",
+	)
+	output := fs.String(
+		"output",
+		"-",
+		"(optional) CSV file; - writes to stdout; this is a folder if per-repo is set",
+	)
+	perRepo := fs.Bool(
+		"per-repo",
+		false,
+		"(optional) when set to true logs of every repo are written to their own file",
+	)
+	fetch := fs.Bool(
+		"fetch",
+		false,
+		"(optional) when set to true logs are fetched from quay instead of reading the stored ones",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	start, end, err := dates.parse()
+	if err != nil {
+		return err
+	}
+	cols := splitList(*columns)
+
+	switch *exportType {
+	case exportPopularity:
+		err = export.ValidatePopularColumns(cols)
+		if err != nil {
+			return usageErrorf("Invalid columns: %v", err)
+		}
+		err = quay.apply()
+		if err != nil {
+			return err
+		}
+		repolist, err := listRepos(quay, gmetrics.RepoFilter{}, nil, *debug)
+		if err != nil {
+			return err
+		}
+		return writeExportOutput(*output, func(w io.Writer) error {
+			return export.WritePopularCSV(w, repolist.Items, cols)
+		})
+	case exportLogs:
+		err = export.ValidateLogColumns(cols)
+		if err != nil {
+			return usageErrorf("Invalid columns: %v", err)
+		}
+		var repos []gmetrics.RepoLogs
+		if *fetch {
+			err = quay.apply()
+			if err != nil {
+				return err
+			}
+			repos, err = fetchRepoLogs(quay, *debug, start, end)
+		} else {
+			repos, err = readRepoLogs(stores, *debug, start, end)
+		}
+		if err != nil {
+			return err
+		}
+		if *perRepo {
+			err = export.WriteRepoLogsCSVFiles(*output, repos, cols)
+			if err != nil {
+				return errors.Wrapf(
+					err,
+					"Failed to export logs",
+				)
+			}
+			return nil
+		}
+		var all []gmetrics.Log
+		for _, repo := range repos {
+			all = append(all, repo.Items...)
+		}
+		return writeExportOutput(*output, func(w io.Writer) error {
+			return export.WriteLogsCSV(w, all, cols)
+		})
+	default:
+		return usageErrorf("Unsupported export type %q", *exportType)
+	}
+}
+
+// writeExportOutput writes the export to stdout or to the given
+// output file
+func writeExportOutput(output string, write func(io.Writer) error) error {
+	w := os.Stdout
+	if output != "-" {
+		file, err := os.Create(output)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"Failed to create export file",
+			)
+		}
+		defer file.Close()
+		w = file
+	}
+	err := write(w)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to export",
+		)
+	}
+	return nil
+}
+
+// readRepoLogs reads the logs of the storage of the given flags that
+// are from the given dates. Both dates are inclusive & zero dates
+// mean no limit.
+func readRepoLogs(
+	stores *storageFlags,
+	debug bool,
+	start time.Time,
+	end time.Time,
+) ([]gmetrics.RepoLogs, error) {
+	store, err := stores.newStorage()
+	if err != nil {
+		return nil, err
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, debug)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to read logs",
+		)
+	}
+	for i := range repos {
+		var kept []gmetrics.Log
+		for _, entry := range repos[i].Items {
+			if isInDateRange(entry, start, end) {
+				kept = append(kept, entry)
+			}
+		}
+		repos[i].Items = kept
+	}
+	return repos, nil
+}
+
+// fetchRepoLogs fetches logs of all the repos of the namespace from
+// quay without writing them to files
+func fetchRepoLogs(
+	quay *quayFlags,
+	debug bool,
+	start time.Time,
+	end time.Time,
+) ([]gmetrics.RepoLogs, error) {
+	repolist, err := listRepos(quay, gmetrics.RepoFilter{}, nil, debug)
+	if err != nil {
+		return nil, err
+	}
+	results, err := collect(repolist, nil, gmetrics.DefaultWorkers, gmetrics.LoggableConfig{
+		QuayURL:   *quay.url,
+		AuthToken: *quay.authToken,
+		Namespace: *quay.namespace,
+		Debug:     debug,
+		StartTime: start,
+		EndTime:   end,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []gmetrics.RepoLogs
+	for _, result := range results {
+		if result.Err != nil {
+			return nil, errors.Wrapf(
+				result.Err,
+				"Failed to download logs",
+			)
+		}
+		out = append(out, gmetrics.RepoLogs{
+			Namespace: *quay.namespace,
+			Name:      result.Name,
+			Items:     result.Logs.Items,
+		})
+	}
+	return out, nil
+}
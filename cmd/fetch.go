@@ -0,0 +1,623 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/config"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// runFetch has the following logic
+//   - It resolves the namespaces to fetch from the flags or from the
+//     config file. Flags that are set override the values of the
+//     config file.
+//   - It selects the storage that will host the downloaded files.
+//   - It lists all the repos in the sorted order of popularity in the
+//     namespace unless repos are selected with the repo flag.
+//   - It iterates through each of the repos and download its Logs and
+//     stores them in different files.
+//   - It prints a summary per namespace when a config file is used.
+func runFetch(args []string) error {
+	fs := newCommandFlags("fetch")
+	quay := addQuayFlags(fs)
+	stores := addStorageFlags(fs)
+	dates := addDateFlags(fs)
+	filters := addFilterFlags(fs)
+	debug := addDebugFlag(fs)
+	configFile := fs.String(
+		"config",
+		"",
+		"(optional) YAML or JSON file listing the namespaces to fetch; flags that are set override the values of this file",
+	)
+	repos := fs.String(
+		"repo",
+		"",
+		"(optional) comma separated repos whose logs are downloaded without listing the namespace e.g. jiva,cstor-pool; logs of all the repos selected by the filters are downloaded by default",
+	)
+	incremental := fs.Bool(
+		"incremental",
+		true,
+		"when set to true only the logs newer than the ones downloaded earlier are downloaded",
+	)
+	workers := fs.Int(
+		"workers",
+		gmetrics.DefaultWorkers,
+		"(optional) number of repos whose logs are downloaded concurrently",
+	)
+	windows := fs.Bool(
+		"windows",
+		false,
+		"Set to tue when working on windows systems",
+	)
+	snapshot := fs.Bool(
+		"snapshot",
+		true,
+		"when set to true a snapshot of the popularity of all the repos is stored for the trend command",
+	)
+	kindNames := fs.String(
+		"kinds",
+		"",
+		"(optional) comma separated kinds or categories of logs to download e.g. pull_repo,audit; run the kinds command to list these; logs of all kinds are downloaded by default",
+	)
+	geoFiles := addGeoIPFlag(fs)
+	privacy := addPrivacyFlags(fs)
+	outputFormat := fs.String(
+		"output-format",
+		string(gmetrics.FormatJSON),
+		"(optional) format of the stored logs; one of: json, ndjson; json stores every page as returned by quay; ndjson stores a log per line",
+	)
+	compressionName := fs.String(
+		"compression",
+		string(gmetrics.CompressionNone),
+		"(optional) compression of ndjson logs; one of: none, gzip, zstd",
+	)
+	output := fs.String(
+		"output",
+		"",
+		"(optional) use - to stream the logs to stdout as ndjson instead of storing these; sync state & popularity snapshots are still stored",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	if *workers < 0 {
+		return usageErrorf("Invalid workers %d: Must not be negative", *workers)
+	}
+	kinds, err := gmetrics.ParseLogKinds(splitList(*kindNames))
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	anonymizer, err := privacy.newAnonymizer()
+	if err != nil {
+		return err
+	}
+	compression, err := gmetrics.ParseCompression(*compressionName)
+	if err != nil {
+		return usageErrorf("Invalid compression: %v", err)
+	}
+	if *output == "-" && !fs.isSet("output-format") {
+		// stdout is always streamed as ndjson
+		*outputFormat = string(gmetrics.FormatNDJSON)
+	}
+	format, err := gmetrics.ParseLogFileFormat(*outputFormat, compression)
+	if err != nil {
+		return usageErrorf("Invalid output-format: %v", err)
+	}
+	if *output != "" && *output != "-" {
+		return usageErrorf("Invalid output %q: Use - for stdout", *output)
+	}
+	if *output == "-" && format == gmetrics.FormatJSON {
+		return usageErrorf("Invalid output-format %q: Logs are streamed to stdout as ndjson", format)
+	}
+	var targets []fetchTarget
+	if *configFile == "" {
+		target, err := newFetchTarget(fs, quay, stores, dates, filters)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target)
+	} else {
+		targets, err = loadFetchTargets(*configFile, fs, quay, stores, dates, filters)
+		if err != nil {
+			return err
+		}
+	}
+
+	options := fetchOptions{
+		selected:    splitList(*repos),
+		incremental: *incremental,
+		workers:     *workers,
+		debug:       *debug,
+		windows:     *windows,
+		kinds:       kinds,
+		snapshot:    *snapshot,
+		anonymizer:  anonymizer,
+		format:      format,
+	}
+	geo, err := openGeoIP(*geoFiles)
+	if err != nil {
+		return err
+	}
+	if geo != nil {
+		defer geo.Close()
+		options.geo = geo
+	}
+	// summaries are printed to stderr when logs are streamed to stdout
+	summaryOut := os.Stdout
+	var streamOut io.WriteCloser
+	if *output == "-" {
+		streamOut, err = gmetrics.NewCompressWriter(os.Stdout, format.Compression())
+		if err != nil {
+			return err
+		}
+		options.stream = gmetrics.NewLogStream(streamOut)
+		summaryOut = os.Stderr
+	}
+	var summaries []fetchSummary
+	for _, target := range targets {
+		log.Printf("Will fetch namespace %q", *target.quay.namespace)
+		summaries = append(summaries, fetchNamespace(target, options))
+	}
+	if streamOut != nil {
+		err = streamOut.Close()
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"Failed to stream logs to stdout",
+			)
+		}
+	}
+	if *configFile == "" {
+		return summaries[0].Err
+	}
+	writeFetchSummaries(summaryOut, summaries)
+
+	var failedCount int
+	var firstErr error
+	for _, summary := range summaries {
+		if summary.Err == nil {
+			continue
+		}
+		failedCount++
+		if firstErr == nil {
+			firstErr = summary.Err
+		}
+	}
+	switch {
+	case failedCount == 0:
+		return nil
+	case failedCount == 1 && len(summaries) == 1:
+		return firstErr
+	case failedCount == len(summaries) && exitCode(firstErr) != exitPartial:
+		// the cause decides the exit code when all the namespaces
+		// failed
+		return errors.Wrapf(
+			firstErr,
+			"Failed to fetch all %d namespaces",
+			len(summaries),
+		)
+	default:
+		return &partialError{
+			Failed: failedCount,
+			Total:  len(summaries),
+			Unit:   "namespaces",
+		}
+	}
+}
+
+// fetchTarget is a namespace to fetch along with the settings
+// resolved from the flags & the config file
+type fetchTarget struct {
+	quay   quayFlags
+	stores storageFlags
+	filter gmetrics.RepoFilter
+	start  time.Time
+	end    time.Time
+}
+
+// fetchOptions are the settings of fetch that apply to all the
+// namespaces
+type fetchOptions struct {
+	selected    []string
+	incremental bool
+	workers     int
+	debug       bool
+	windows     bool
+	kinds       []gmetrics.LogKind
+	snapshot    bool
+	// geo when set enriches the downloaded logs
+	geo gmetrics.GeoLookup
+	// anonymizer when set anonymizes the IPs of the downloaded logs
+	anonymizer *gmetrics.Anonymizer
+	// format is the format of the stored logs
+	format gmetrics.LogFileFormat
+	// stream when set gets the logs instead of the storage
+	stream *gmetrics.LogStream
+}
+
+// fetchSummary is the outcome of fetching a namespace
+type fetchSummary struct {
+	Namespace  string
+	Repos      int
+	Downloaded int
+	Skipped    int
+	Failed     int
+	Logs       int
+	Kinds      []gmetrics.KindCount
+	Err        error
+}
+
+// newFetchTarget returns the namespace to fetch as set by the flags
+func newFetchTarget(
+	fs *commandFlags,
+	quay *quayFlags,
+	stores *storageFlags,
+	dates *dateFlags,
+	filters *filterFlags,
+) (fetchTarget, error) {
+	start, end, err := dates.parse()
+	if err != nil {
+		return fetchTarget{}, err
+	}
+	err = quay.apply()
+	if err != nil {
+		return fetchTarget{}, err
+	}
+	filter, err := filters.apply(fs, gmetrics.RepoFilter{})
+	if err != nil {
+		return fetchTarget{}, err
+	}
+	return fetchTarget{
+		quay:   *quay,
+		stores: *stores,
+		filter: filter,
+		start:  start,
+		end:    end,
+	}, nil
+}
+
+// loadFetchTargets returns the namespaces to fetch as listed in the
+// given config file
+//
+// Flags that are set override the values of the config file. The
+// quay namespace flag restricts the fetch to that namespace.
+func loadFetchTargets(
+	filename string,
+	fs *commandFlags,
+	quay *quayFlags,
+	stores *storageFlags,
+	dates *dateFlags,
+	filters *filterFlags,
+) ([]fetchTarget, error) {
+	conf, err := config.Load(filename)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	namespaces := conf.Namespaces
+	if fs.isSet("quay-namespace") {
+		ns, found := conf.Namespace(*quay.namespace)
+		if !found {
+			ns = config.Namespace{Name: *quay.namespace, Profile: conf.Defaults}
+		}
+		namespaces = []config.Namespace{ns}
+	}
+	if len(namespaces) == 0 {
+		return nil, usageErrorf("Missing namespaces: Config %q", filename)
+	}
+	err = quay.applyPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []fetchTarget
+	for _, ns := range namespaces {
+		name := ns.Name
+		url := overrideString(fs, "quay-url", *quay.url, ns.QuayURL)
+		token := *quay.authToken
+		if !fs.isSet("quay-auth-token") {
+			nsToken, err := ns.Token()
+			if err != nil {
+				return nil, usageErrorf("Invalid namespace %q: %v", name, err)
+			}
+			if nsToken != "" {
+				token = nsToken
+			}
+		}
+		if token == "" {
+			return nil, usageErrorf("Missing quay auth token: Namespace %q", name)
+		}
+		startDate := overrideString(fs, "start-date", *dates.startDate, ns.StartDate)
+		endDate := overrideString(fs, "end-date", *dates.endDate, ns.EndDate)
+		start, end, err := (&dateFlags{startDate: &startDate, endDate: &endDate}).parse()
+		if err != nil {
+			return nil, usageErrorf("Invalid namespace %q: %v", name, err)
+		}
+
+		filter, err := filters.apply(fs, ns.RepoFilter)
+		if err != nil {
+			return nil, usageErrorf("Invalid namespace %q: %v", name, err)
+		}
+
+		// output path is the folder of local storage or the key prefix
+		// of s3 storage
+		target := fetchTarget{
+			quay:   *quay,
+			stores: *stores,
+			filter: filter,
+			start:  start,
+			end:    end,
+		}
+		logsFilePath := overrideString(fs, "logs-file-path", *stores.logsFilePath, ns.OutputPath)
+		s3Prefix := overrideString(fs, "s3-prefix", *stores.s3Prefix, ns.OutputPath)
+		target.quay.url = &url
+		target.quay.authToken = &token
+		target.quay.namespace = &name
+		target.stores.logsFilePath = &logsFilePath
+		target.stores.s3Prefix = &s3Prefix
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// overrideString returns the value of the given flag if it is set on
+// the command line. Otherwise the given value of the config file is
+// returned if it is not empty & the flag value otherwise.
+func overrideString(fs *commandFlags, name, flagValue, fileValue string) string {
+	if fs.isSet(name) || fileValue == "" {
+		return flagValue
+	}
+	return fileValue
+}
+
+// fetchNamespace downloads logs of the repos of the given namespace
+func fetchNamespace(target fetchTarget, options fetchOptions) fetchSummary {
+	quay := &target.quay
+	summary := fetchSummary{Namespace: *quay.namespace}
+
+	// storage that will host various files downloaded from quay
+	store, err := target.stores.newStorage()
+	if err != nil {
+		summary.Err = err
+		return summary
+	}
+
+	// list repos unless these are selected
+	//
+	// NOTE:
+	//	Repos selected with the repo flag are fetched directly. These
+	// are not filtered.
+	var repolist gmetrics.PopularList
+	if len(options.selected) > 0 {
+		for _, name := range options.selected {
+			repolist.Items = append(repolist.Items, gmetrics.Popular{
+				Namespace: *quay.namespace,
+				Name:      name,
+			})
+		}
+	} else {
+		log.Print("Will list all repos")
+		var snapshots storage.Storage
+		if options.snapshot {
+			snapshots = store
+		}
+		repolist, err = listRepos(quay, target.filter, snapshots, options.debug)
+		if err != nil {
+			summary.Err = err
+			return summary
+		}
+	}
+
+	// sync state has the newest log downloaded per repo
+	//
+	// NOTE:
+	//	A date range is meant to backfill logs. Hence the high water
+	// mark is not used to skip logs in that case.
+	var state *gmetrics.SyncState
+	if options.incremental && target.start.IsZero() && target.end.IsZero() {
+		state, err = gmetrics.LoadSyncState(store)
+		if err != nil {
+			summary.Err = errors.Wrapf(
+				err,
+				"Failed to load sync state",
+			)
+			return summary
+		}
+	}
+
+	// logs of the IPs purged earlier are not downloaded again
+	purged, err := gmetrics.LoadPurgedIPs(store)
+	if err != nil {
+		summary.Err = errors.Wrapf(
+			err,
+			"Failed to load purged IPs",
+		)
+		return summary
+	}
+
+	// download logs of the repos
+	log.Printf("Will download logs of %d repos", len(repolist.Items))
+	results, err := collect(repolist, state, options.workers, gmetrics.LoggableConfig{
+		QuayURL:            *quay.url,
+		AuthToken:          *quay.authToken,
+		Namespace:          *quay.namespace,
+		IsWriteToFile:      options.stream == nil,
+		BaseOutputFilePath: *target.stores.logsFilePath,
+		Storage:            store,
+		Debug:              options.debug,
+		Windows:            options.windows,
+		StartTime:          target.start,
+		EndTime:            target.end,
+		Kinds:              options.kinds,
+		GeoLookup:          options.geo,
+		Anonymizer:         options.anonymizer,
+		Format:             options.format,
+		Stream:             options.stream,
+		Purged:             purged,
+	})
+	if err != nil {
+		summary.Err = err
+		return summary
+	}
+	summary.Repos = len(results)
+
+	// report in the order of popularity
+	//
+	// NOTE:
+	//	Listed repos that got deleted before their logs were
+	// downloaded are skipped. Selected repos that are not found are
+	// failures.
+	var firstErr error
+	var downloaded []gmetrics.Log
+	for _, result := range results {
+		var notFound *gmetrics.NotFoundError
+		if errors.As(result.Err, &notFound) && len(options.selected) == 0 {
+			// repo got deleted after it was listed
+			summary.Skipped++
+			log.Printf("Skipped: %s: %v", result.Name, result.Err)
+			continue
+		}
+		if result.Err != nil {
+			summary.Failed++
+			if firstErr == nil {
+				firstErr = result.Err
+			}
+			log.Printf("Failed: %s: %v%s", result.Name, result.Err, hint(result.Err))
+			continue
+		}
+		summary.Downloaded++
+		summary.Logs += len(result.Logs.Items)
+		downloaded = append(downloaded, result.Logs.Items...)
+		log.Printf(
+			"Downloaded: %s: Logs %d%s",
+			result.Name,
+			len(result.Logs.Items),
+			formatKindCounts(gmetrics.CountKinds(result.Logs.Items), ": ", " "),
+		)
+	}
+	summary.Kinds = gmetrics.CountKinds(downloaded)
+	log.Printf(
+		"Downloaded logs by kind: Namespace %q: Logs %d%s",
+		summary.Namespace,
+		summary.Logs,
+		formatKindCounts(summary.Kinds, ": ", " "),
+	)
+	switch {
+	case summary.Failed == 0:
+	case summary.Failed == len(results):
+		// the cause decides the exit code when all the repos failed
+		summary.Err = errors.Wrapf(
+			firstErr,
+			"Failed to download logs of all %d repos",
+			len(results),
+		)
+	default:
+		summary.Err = &partialError{Failed: summary.Failed, Total: len(results)}
+	}
+	return summary
+}
+
+// writeFetchSummaries writes the given summaries as a table
+func writeFetchSummaries(w io.Writer, summaries []fetchSummary) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tREPOS\tDOWNLOADED\tSKIPPED\tFAILED\tLOGS\tKINDS\tSTATUS")
+	for _, s := range summaries {
+		status := "ok"
+		switch code := exitCode(s.Err); {
+		case code == exitPartial:
+			status = "partial"
+		case code != exitOK:
+			status = "failed: " + s.Err.Error()
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			s.Namespace,
+			s.Repos,
+			s.Downloaded,
+			s.Skipped,
+			s.Failed,
+			s.Logs,
+			orDash(strings.TrimPrefix(formatKindCounts(s.Kinds, ",", "="), ",")),
+			status,
+		)
+	}
+	tw.Flush()
+}
+
+// formatKindCounts formats the given counts of kinds of logs. Every
+// count is prefixed with the given separator & its kind is joined to
+// its count with the given joiner e.g. ,pull_repo=3,push_repo=1
+func formatKindCounts(counts []gmetrics.KindCount, separator, joiner string) string {
+	var b strings.Builder
+	for _, c := range counts {
+		fmt.Fprintf(&b, "%s%s%s%d", separator, c.Kind, joiner, c.Count)
+	}
+	return b.String()
+}
+
+// orDash returns - if the given value is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// collect downloads logs of the given repos concurrently
+func collect(
+	repolist gmetrics.PopularList,
+	state *gmetrics.SyncState,
+	workers int,
+	config gmetrics.LoggableConfig,
+) ([]gmetrics.RepoResult, error) {
+	c, err := gmetrics.NewCollector(gmetrics.CollectorConfig{
+		Logger:  config,
+		Workers: workers,
+		State:   state,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to initialise collector",
+		)
+	}
+	return c.Collect(repolist.Items), nil
+}
+
+// splitList returns the non empty items of the given comma separated
+// list
+func splitList(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
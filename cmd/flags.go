@@ -0,0 +1,525 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/geoip"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+const (
+	// storageLocal stores files in the folders of logs file path
+	storageLocal string = "local"
+
+	// storageMemory keeps files in memory till the binary exits
+	storageMemory string = "memory"
+
+	// storageS3 stores files in a S3 compatible bucket
+	storageS3 string = "s3"
+)
+
+// commandFlags are the flags of a command
+type commandFlags struct {
+	*flag.FlagSet
+}
+
+// newCommandFlags returns an empty set of flags of the given command
+//
+// Errors & help are printed by the command runner instead of the
+// flag package. This avoids printing these twice.
+func newCommandFlags(name string) *commandFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Usage = func() {}
+	return &commandFlags{FlagSet: fs}
+}
+
+// parse parses the given arguments. Help is printed if requested.
+// Commands do not accept positional arguments.
+func (f *commandFlags) parse(args []string) error {
+	err := f.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		f.printUsage()
+		return err
+	}
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usageErrorf("Unexpected arguments %q", f.Args())
+	}
+	return nil
+}
+
+// isSet returns true if the flag of the given name is set on the
+// command line
+func (f *commandFlags) isSet(name string) bool {
+	var found bool
+	f.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// printUsage prints the summary & flags of this command
+func (f *commandFlags) printUsage() {
+	cmd, _ := findCommand(f.Name())
+	fmt.Fprintf(
+		os.Stderr,
+		"Usage: %s %s [flags]\n\n%s\n\nFlags:\n",
+		programName(),
+		cmd.name,
+		cmd.summary,
+	)
+	f.SetOutput(os.Stderr)
+	f.PrintDefaults()
+	f.SetOutput(ioutil.Discard)
+}
+
+// addDebugFlag adds the debug flag to the given flags
+func addDebugFlag(fs *commandFlags) *bool {
+	return fs.Bool(
+		"debug",
+		false,
+		"when set to true will result in more verbose output",
+	)
+}
+
+// quayFlags are the flags to invoke quay APIs
+type quayFlags struct {
+	url              *string
+	authToken        *string
+	namespace        *string
+	maxRetries       *int
+	rateLimit        *float64
+	rateLimitBurst   *int
+	allowPartialList *bool
+}
+
+// addQuayFlags adds the flags to invoke quay APIs to the given flags
+func addQuayFlags(fs *commandFlags) *quayFlags {
+	return &quayFlags{
+		url: fs.String(
+			"quay-url",
+			gmetrics.DefaultQuayURL,
+			"base URL of the quay instance e.g. https://quay.example.com",
+		),
+		authToken: fs.String(
+			"quay-auth-token",
+			os.Getenv("QUAY-AUTH-TOKEN"),
+			"authentication token to communicate with quay.io APIs",
+		),
+		namespace: fs.String(
+			"quay-namespace",
+			os.Getenv("QUAY-NAMESPACE"),
+			"namespace to be used while querying quay.io APIs",
+		),
+		maxRetries: fs.Int(
+			"max-retries",
+			gmetrics.DefaultRetryPolicy.MaxRetries,
+			"(optional) number of times a failed quay API request is retried",
+		),
+		rateLimit: fs.Float64(
+			"rate-limit",
+			0,
+			"(optional) maximum quay API requests per second across all repos; 0 means no limit",
+		),
+		rateLimitBurst: fs.Int(
+			"rate-limit-burst",
+			1,
+			"(optional) number of quay API requests allowed at once when rate-limit is set",
+		),
+		allowPartialList: fs.Bool(
+			"allow-partial-list",
+			false,
+			"(optional) when set to true a repo list that may be truncated by quay results in a warning instead of an error",
+		),
+	}
+}
+
+// apply verifies the auth token & namespace. It then applies the
+// retry policy & the rate limit to all quay API requests.
+func (f *quayFlags) apply() error {
+	if *f.authToken == "" {
+		return usageErrorf("Missing quay auth token")
+	}
+	if *f.namespace == "" {
+		return usageErrorf("Missing quay namespace")
+	}
+	return f.applyPolicy()
+}
+
+// applyPolicy applies the retry policy & the rate limit to all quay
+// API requests
+func (f *quayFlags) applyPolicy() error {
+	if *f.maxRetries < 0 {
+		return usageErrorf("Invalid max-retries %d: Must not be negative", *f.maxRetries)
+	}
+	policy := gmetrics.DefaultRetryPolicy
+	policy.MaxRetries = *f.maxRetries
+	gmetrics.SetRetryPolicy(policy)
+	gmetrics.SetRateLimit(*f.rateLimit, *f.rateLimitBurst)
+	return nil
+}
+
+// regexListFlag is a flag that collects its values when repeated.
+// Values are not split at commas since these are common in regular
+// expressions.
+type regexListFlag []string
+
+func (f *regexListFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *regexListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// filterFlags are the flags to select the repos of the namespace
+type filterFlags struct {
+	include       *string
+	exclude       *string
+	includeRegex  *regexListFlag
+	excludeRegex  *regexListFlag
+	public        *string
+	state         *string
+	minPopularity *float64
+}
+
+// addFilterFlags adds the flags to select the repos of the namespace
+// to the given flags
+func addFilterFlags(fs *commandFlags) *filterFlags {
+	f := &filterFlags{
+		include: fs.String(
+			"include",
+			"",
+			"(optional) comma separated globs of repos to select e.g. jiva*,cstor-*; all repos are selected by default",
+		),
+		exclude: fs.String(
+			"exclude",
+			"",
+			"(optional) comma separated globs of repos to drop e.g. *-ci",
+		),
+		includeRegex: &regexListFlag{},
+		excludeRegex: &regexListFlag{},
+		public: fs.String(
+			"public",
+			"",
+			"(optional) true selects public repos only; false selects private repos only",
+		),
+		state: fs.String(
+			"state",
+			"",
+			"(optional) comma separated states of repos to select e.g. NORMAL",
+		),
+		minPopularity: fs.Float64(
+			"min-popularity",
+			0,
+			"(optional) repos less popular than this are dropped",
+		),
+	}
+	fs.Var(
+		f.includeRegex,
+		"include-regex",
+		"(optional) regular expression of repos to select e.g. ^cstor-(pool|volume)$; can be repeated",
+	)
+	fs.Var(
+		f.excludeRegex,
+		"exclude-regex",
+		"(optional) regular expression of repos to drop; can be repeated",
+	)
+	return f
+}
+
+// apply returns the given filter with its fields replaced by the
+// flags that are set on the command line
+func (f *filterFlags) apply(fs *commandFlags, base gmetrics.RepoFilter) (gmetrics.RepoFilter, error) {
+	filter := base
+	if fs.isSet("include") {
+		filter.Include = splitList(*f.include)
+	}
+	if fs.isSet("exclude") {
+		filter.Exclude = splitList(*f.exclude)
+	}
+	if fs.isSet("include-regex") {
+		filter.IncludeRegex = *f.includeRegex
+	}
+	if fs.isSet("exclude-regex") {
+		filter.ExcludeRegex = *f.excludeRegex
+	}
+	if fs.isSet("public") {
+		public, err := strconv.ParseBool(*f.public)
+		if err != nil {
+			return filter, usageErrorf("Invalid public %q: Must be true or false", *f.public)
+		}
+		filter.IsPublic = &public
+	}
+	if fs.isSet("state") {
+		filter.States = splitList(*f.state)
+	}
+	if fs.isSet("min-popularity") {
+		filter.MinPopularity = f.minPopularity
+	}
+	err := filter.Validate()
+	if err != nil {
+		return filter, usageErrorf("%v", err)
+	}
+	return filter, nil
+}
+
+// storageFlags are the flags to select the storage of logs
+type storageFlags struct {
+	logsFilePath *string
+	storageType  *string
+	s3Endpoint   *string
+	s3Bucket     *string
+	s3Prefix     *string
+	s3Region     *string
+	s3AccessKey  *string
+	s3SecretKey  *string
+	s3Insecure   *bool
+}
+
+// addStorageFlags adds the flags to select the storage of logs to
+// the given flags
+func addStorageFlags(fs *commandFlags) *storageFlags {
+	return &storageFlags{
+		logsFilePath: fs.String(
+			"logs-file-path",
+			"./logs",
+			"(optional) absolute path to the quay repo's log files",
+		),
+		storageType: fs.String(
+			"storage",
+			storageLocal,
+			"(optional) where logs are stored; one of: local (folders of logs-file-path), memory (discarded on exit), s3 (S3 compatible bucket)",
+		),
+		s3Endpoint: fs.String(
+			"s3-endpoint",
+			"s3.amazonaws.com",
+			"(optional) host & optional port of the S3 compatible object storage e.g. localhost:9000",
+		),
+		s3Bucket: fs.String(
+			"s3-bucket",
+			"",
+			"(optional) bucket that stores logs when storage is s3",
+		),
+		s3Prefix: fs.String(
+			"s3-prefix",
+			"",
+			"(optional) prefix of the keys of logs stored in the bucket e.g. quay-logs/",
+		),
+		s3Region: fs.String(
+			"s3-region",
+			"",
+			"(optional) region of the bucket",
+		),
+		s3AccessKey: fs.String(
+			"s3-access-key",
+			os.Getenv("AWS_ACCESS_KEY_ID"),
+			"(optional) access key of the object storage",
+		),
+		s3SecretKey: fs.String(
+			"s3-secret-key",
+			os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			"(optional) secret key of the object storage",
+		),
+		s3Insecure: fs.Bool(
+			"s3-insecure",
+			false,
+			"(optional) when set to true the object storage is accessed over http instead of https",
+		),
+	}
+}
+
+// newStorage returns the storage of logs selected by these flags
+//
+// The folder of logs file path is created for the local storage.
+func (f *storageFlags) newStorage() (storage.Storage, error) {
+	switch *f.storageType {
+	case storageLocal:
+		err := os.MkdirAll(*f.logsFilePath, 0755)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"Failed to create logs folder: Path %q",
+				*f.logsFilePath,
+			)
+		}
+		return storage.NewLocal(*f.logsFilePath), nil
+	case storageMemory:
+		return storage.NewMemory(), nil
+	case storageS3:
+		store, err := storage.NewS3(storage.S3Config{
+			Endpoint:  *f.s3Endpoint,
+			AccessKey: *f.s3AccessKey,
+			SecretKey: *f.s3SecretKey,
+			Bucket:    *f.s3Bucket,
+			Prefix:    *f.s3Prefix,
+			Region:    *f.s3Region,
+			Insecure:  *f.s3Insecure,
+		})
+		if err != nil {
+			return nil, usageErrorf("Invalid s3 storage: %v", err)
+		}
+		return store, nil
+	default:
+		return nil, usageErrorf("Unsupported storage %q", *f.storageType)
+	}
+}
+
+// dateFlags are the flags to select a date range of logs
+type dateFlags struct {
+	startDate *string
+	endDate   *string
+}
+
+// addDateFlags adds the flags to select a date range of logs to the
+// given flags
+func addDateFlags(fs *commandFlags) *dateFlags {
+	return &dateFlags{
+		startDate: fs.String(
+			"start-date",
+			"",
+			"(optional) download logs from this date e.g. Aug-06-2020 or 2020-08-06",
+		),
+		endDate: fs.String(
+			"end-date",
+			"",
+			"(optional) download logs till this date (inclusive) e.g. Aug-13-2020 or 2020-08-13",
+		),
+	}
+}
+
+// parse parses the optional start & end dates
+func (f *dateFlags) parse() (start time.Time, end time.Time, err error) {
+	if *f.startDate != "" {
+		start, err = gmetrics.ParseDate(*f.startDate)
+		if err != nil {
+			return start, end, usageErrorf("Invalid start date: %v", err)
+		}
+	}
+	if *f.endDate != "" {
+		end, err = gmetrics.ParseDate(*f.endDate)
+		if err != nil {
+			return start, end, usageErrorf("Invalid end date: %v", err)
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && start.After(end) {
+		return start, end, usageErrorf(
+			"Invalid date range: Start %s is after end %s",
+			*f.startDate,
+			*f.endDate,
+		)
+	}
+	return start, end, nil
+}
+
+// addGeoIPFlag adds the flag of the GeoIP databases to the given
+// flags
+func addGeoIPFlag(fs *commandFlags) *string {
+	return fs.String(
+		"geoip-db",
+		"",
+		"(optional) comma separated MaxMind format database files used to find the country, city, ASN & organisation of the IPs of logs e.g. GeoLite2-City.mmdb,GeoLite2-ASN.mmdb",
+	)
+}
+
+// openGeoIP opens the given comma separated GeoIP database files. It
+// returns nil if no files are given.
+func openGeoIP(files string) (*geoip.DB, error) {
+	paths := splitList(files)
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	db, err := geoip.Open(paths...)
+	if err != nil {
+		return nil, usageErrorf("Invalid geoip-db: %v", err)
+	}
+	return db, nil
+}
+
+// privacyFlags are the flags to anonymize the IPs of logs
+type privacyFlags struct {
+	mode        *string
+	hmacKeyEnv  *string
+	hmacKeyFile *string
+}
+
+// addPrivacyFlags adds the flags to anonymize the IPs of logs to the
+// given flags
+func addPrivacyFlags(fs *commandFlags) *privacyFlags {
+	return &privacyFlags{
+		mode: fs.String(
+			"ip-privacy",
+			string(gmetrics.IPPrivacyNone),
+			"(optional) how IPs of logs are anonymized before these are stored; one of: none, hmac, truncate, drop",
+		),
+		hmacKeyEnv: fs.String(
+			"ip-hmac-key-env",
+			"QUAY_IP_HMAC_KEY",
+			"(optional) env var having the secret key used by the hmac IP privacy",
+		),
+		hmacKeyFile: fs.String(
+			"ip-hmac-key-file",
+			"",
+			"(optional) file having the secret key used by the hmac IP privacy; takes precedence over ip-hmac-key-env",
+		),
+	}
+}
+
+// newAnonymizer returns the anonymizer of these flags. It returns nil
+// if IPs are kept as is.
+func (f *privacyFlags) newAnonymizer() (*gmetrics.Anonymizer, error) {
+	mode, err := gmetrics.ParseIPPrivacy(*f.mode)
+	if err != nil {
+		return nil, usageErrorf("Invalid ip-privacy: %v", err)
+	}
+	if mode == gmetrics.IPPrivacyNone {
+		return nil, nil
+	}
+	var key string
+	if mode == gmetrics.IPPrivacyHMAC {
+		key = os.Getenv(*f.hmacKeyEnv)
+		if *f.hmacKeyFile != "" {
+			raw, err := ioutil.ReadFile(*f.hmacKeyFile)
+			if err != nil {
+				return nil, usageErrorf("Invalid ip-hmac-key-file: %v", err)
+			}
+			key = strings.TrimSpace(string(raw))
+		}
+	}
+	a, err := gmetrics.NewAnonymizer(mode, []byte(key))
+	if err != nil {
+		return nil, usageErrorf("Invalid ip-privacy: %v", err)
+	}
+	return a, nil
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+
+	"github.com/mayadata.io/quay-logs/logdb"
+)
+
+// runImport loads the logs & the latest popularity of the repos of
+// the storage into the embedded database. Logs imported earlier are
+// skipped.
+func runImport(args []string) error {
+	fs := newCommandFlags("import")
+	stores := addStorageFlags(fs)
+	debug := addDebugFlag(fs)
+	dbPath := fs.String(
+		"db-path",
+		"./quay-logs.db",
+		"(optional) embedded database file the logs are loaded into",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	store, err := stores.newStorage()
+	if err != nil {
+		return err
+	}
+
+	db, err := logdb.Open(logdb.Config{Path: *dbPath, Debug: *debug})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	log.Printf("Will import logs: Storage %s: Database %s", *stores.storageType, *dbPath)
+	result, err := db.Import(store)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to import logs",
+		)
+	}
+	log.Printf(
+		"Imported logs: Repos %d: Logs %d: Added %d: Updated %d: Snapshots %d: Popular repos %d",
+		result.RepoCount,
+		result.LogCount,
+		result.AddedCount,
+		result.UpdatedCount,
+		result.SnapshotCount,
+		result.PopularCount,
+	)
+	return nil
+}
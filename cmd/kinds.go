@@ -0,0 +1,55 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// runKinds prints the catalog of the kinds of quay logs. The kinds
+// & categories are accepted by the kinds flag of fetch.
+func runKinds(args []string) error {
+	fs := newCommandFlags("kinds")
+	category := fs.String(
+		"category",
+		"",
+		"(optional) category of kinds to print; one of: adoption, audit, other; all kinds are printed by default",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tCATEGORY\tDESCRIPTION")
+	var count int
+	for _, info := range gmetrics.KindCatalog {
+		if *category != "" && string(info.Category) != *category {
+			continue
+		}
+		count++
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", info.Kind, info.Category, info.Description)
+	}
+	if count == 0 {
+		return usageErrorf("Unknown category %q", *category)
+	}
+	return tw.Flush()
+}
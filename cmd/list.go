@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+const (
+	// formatTable prints human readable tables
+	formatTable string = "table"
+
+	// formatJSON prints JSON
+	formatJSON string = "json"
+)
+
+// runList prints the repos of the namespace in the order of
+// popularity
+func runList(args []string) error {
+	fs := newCommandFlags("list")
+	quay := addQuayFlags(fs)
+	filters := addFilterFlags(fs)
+	debug := addDebugFlag(fs)
+	format := fs.String(
+		"format",
+		formatTable,
+		"(optional) output format; one of: table, json",
+	)
+	top := fs.Int(
+		"top",
+		0,
+		"(optional) number of most popular repos printed; 0 prints all repos",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	if *format != formatTable && *format != formatJSON {
+		return usageErrorf("Unsupported format %q", *format)
+	}
+	err = quay.apply()
+	if err != nil {
+		return err
+	}
+	filter, err := filters.apply(fs, gmetrics.RepoFilter{})
+	if err != nil {
+		return err
+	}
+
+	repolist, err := listRepos(quay, filter, nil, *debug)
+	if err != nil {
+		return err
+	}
+	repos := repolist.Items
+	if *top > 0 && len(repos) > *top {
+		repos = repos[:*top]
+	}
+	if *format == formatJSON {
+		return writeReposJSON(os.Stdout, repos)
+	}
+	return writeReposTable(os.Stdout, repos)
+}
+
+// writeReposJSON prints the given repos as a JSON array
+func writeReposJSON(w io.Writer, repos []gmetrics.Popular) error {
+	if repos == nil {
+		repos = []gmetrics.Popular{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(repos)
+}
+
+// writeReposTable prints the given repos as a table ranked by the
+// order of the repos
+func writeReposTable(w io.Writer, repos []gmetrics.Popular) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tREPO\tPOPULARITY\tPUBLIC")
+	for i, repo := range repos {
+		fmt.Fprintf(
+			tw,
+			"%d\t%s\t%g\t%t\n",
+			i+1,
+			repo.Name,
+			repo.Popularity,
+			repo.IsPublic,
+		)
+	}
+	return tw.Flush()
+}
+
+// listRepos lists the repos of the namespace selected by the given
+// filter in the sorted order of popularity
+//
+// A snapshot of the popularity of all the repos is stored if a
+// snapshot storage is given.
+func listRepos(
+	quay *quayFlags,
+	filter gmetrics.RepoFilter,
+	snapshots storage.Storage,
+	debug bool,
+) (gmetrics.PopularList, error) {
+	// We create a `NewLister` (refer `list.go`) and set
+	//`IsWriteToFile` false because we don't want to store the data
+	// in the files.
+	l, err := gmetrics.NewLister(gmetrics.ListableConfig{
+		QuayURL:          *quay.url,
+		AuthToken:        *quay.authToken,
+		Namespace:        *quay.namespace,
+		IsWriteToFile:    false,
+		Debug:            debug,
+		AllowPartialList: *quay.allowPartialList,
+		Filter:           filter,
+		IsSnapshot:       snapshots != nil,
+		Storage:          snapshots,
+	})
+	if err != nil {
+		return gmetrics.PopularList{}, errors.Wrapf(
+			err,
+			"Failed to initialise lister",
+		)
+	}
+
+	// repolist contains repos in order of popularity
+	// We call the `ListReposAndWriteToFileOptionally( )` function
+	// to get all the repolist in the namespace as a JSON format.
+	// It returns all the repos in sorted order of popularity.
+	repolist, err := l.ListReposAndWriteToFileOptionally()
+	if err != nil {
+		return gmetrics.PopularList{}, errors.Wrapf(
+			err,
+			"Failed to list repos",
+		)
+	}
+	return repolist, nil
+}
@@ -18,157 +18,308 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
 
 	gmetrics "github.com/mayadata.io/quay-logs"
 )
 
-// The possible list of command line arguments/flags which can be
-// given to the `go run cmd/main.go` command are listed inside
-// the var( ) block.
-var (
-	debug = flag.Bool(
-		"debug",
-		false,
-		"when set to true will result in more verbose output",
-	)
-	repository = flag.String(
-		"repo",
-		"",
-		"quay.io repository",
-	)
-	quayAuthToken = flag.String(
-		"quay-auth-token",
-		os.Getenv("QUAY-AUTH-TOKEN"),
-		"authentication token to communicate with quay.io APIs",
-	)
-	quayNamespace = flag.String(
-		"quay-namespace",
-		os.Getenv("QUAY-NAMESPACE"),
-		"namespace to be used while querying quay.io APIs",
-	)
-	logsFilePath = flag.String(
-		"logs-file-path",
-		"./logs",
-		"(optional) absolute path to the quay repo's log files",
-	)
-	windows = flag.Bool(
-		"windows",
-		false,
-		"Set to tue when working on windows systems",
-	)
+// Exit codes of this binary. Scripts & CI can use these to decide
+// whether to retry, alert or give up.
+const (
+	// exitOK means the command succeeded
+	exitOK int = 0
+
+	// exitFailure means the command failed for a reason not covered
+	// by the other exit codes
+	exitFailure int = 1
+
+	// exitUsage means the command, its flags or arguments are invalid
+	exitUsage int = 2
+
+	// exitAuth means quay rejected the auth token i.e. 401 or 403
+	exitAuth int = 3
+
+	// exitNotFound means quay did not find the namespace or repo
+	exitNotFound int = 4
+
+	// exitUnavailable means quay kept failing or rate limiting the
+	// requests even after retries
+	exitUnavailable int = 5
+
+	// exitPartial means the command succeeded for some of the repos
+	// or namespaces only e.g. logs of a few repos failed to download
+	exitPartial int = 6
 )
 
-// makes all the required directories/folders from the arguments
-// by formatting them with -p flags.
-// - Here we create 1 directory/folder i.e ./logs
-//
-// ./logs is used for storing the repos in order of popularity
-func mkdirAll() {
-	// Uncomment below code if current code isn't worrking on Linux.
-	// If it works then remove the commented codes
-	// var cmds = map[string][]string{
-	// 	"logs": {"-p", *logsFilePath},
-	// }
-	// for _, commandargs := range cmds {
-	// 	cmd := exec.Command("mkdir", commandargs...)
-	// 	err := cmd.Run()
-	// 	if err != nil {
-	// 		log.Fatalf(
-	// 			"Failed to create folder: %s : %v",
-	// 			commandargs,
-	// 			err,
-	// 		)
-	// 	 }
-	// }
-	if _, err := os.Stat(*logsFilePath); os.IsNotExist(err) {
-		err := os.Mkdir(*logsFilePath, 0755)
-		if err != nil {
-			log.Fatal(err)
-		}
+// command is a subcommand of this binary
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists all the subcommands in the order shown by help.
+// It is set in init since commands refer to it to print their usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:    "list",
+			summary: "print repos of the namespace in the order of popularity",
+			run:     runList,
+		},
+		{
+			name:    "fetch",
+			summary: "download logs of all or the selected repos of the namespace",
+			run:     runFetch,
+		},
+		{
+			name:    "kinds",
+			summary: "print the kinds of quay logs & their categories",
+			run:     runKinds,
+		},
+		{
+			name:    "trend",
+			summary: "compare popularity snapshots of the namespace taken by fetch",
+			run:     runTrend,
+		},
+		{
+			name:    "report",
+			summary: "print pull & push counts of the stored logs",
+			run:     runReport,
+		},
+		{
+			name:    "export",
+			summary: "write logs or popularity of repos as CSV",
+			run:     runExport,
+		},
+		{
+			name:    "serve",
+			summary: "expose logs & popularity of repos as prometheus metrics",
+			run:     runServe,
+		},
+		{
+			name:    "enrich",
+			summary: "set country, city, ASN & organisation of the stored logs from GeoIP databases",
+			run:     runEnrich,
+		},
+		{
+			name:    "anonymize",
+			summary: "anonymize IPs of the stored logs by hashing, truncating or dropping these",
+			run:     runAnonymize,
+		},
+		{
+			name:    "purge",
+			summary: "remove the stored logs of the given IPs & CIDR ranges with an audit record",
+			run:     runPurge,
+		},
+		{
+			name:    "dedup",
+			summary: "remove duplicate logs from the stored logs",
+			run:     runDedup,
+		},
+		{
+			name:    "import",
+			summary: "load the stored logs into the embedded database",
+			run:     runImport,
+		},
 	}
 }
 
-// The main function has the following logic
-// - It makes the required directories.
-// - It lists all the repos in the sorted order of popularity in the
-//   namespace into `repolist`.
-// - It iterates through each of the repos and download its Logs and
-//   stores them in different files.
+// usageError is returned when a command is invoked with invalid
+// flags or arguments
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// usageErrorf returns a usageError with the given message
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// partialError is returned when a command failed for some of the
+// repos or namespaces only
+type partialError struct {
+	Failed int
+	Total  int
+
+	// Unit is what failed e.g. namespaces; repos by default
+	Unit string
+}
+
+func (e *partialError) Error() string {
+	unit := e.Unit
+	if unit == "" {
+		unit = "repos"
+	}
+	return fmt.Sprintf("Failed for %d of %d %s", e.Failed, e.Total, unit)
+}
+
+// programName returns the name of this binary as invoked
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// main runs the given command & exits with its exit code
 func main() {
-	// parses the flags. It must be called before using any of the flags.
-	flag.Parse()
+	os.Exit(run(os.Args[1:]))
+}
 
-	if *quayAuthToken == "" {
-		log.Fatal("Missing quay auth token")
+// run runs the command of the given arguments & returns the exit
+// code
+//
+// Running without a command is same as the fetch command. This
+// keeps the invocations of earlier versions of this binary working.
+func run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			printUsage()
+			return exitOK
+		}
+		args = append([]string{"fetch"}, args...)
 	}
-	if *quayNamespace == "" {
-		log.Fatal("Missing quay namespace")
+	name, args := args[0], args[1:]
+	if name == "help" {
+		if len(args) == 0 {
+			printUsage()
+			return exitOK
+		}
+		// e.g. help fetch is same as fetch -h
+		name, args = args[0], []string{"-h"}
 	}
-
-	// create folders that will host various files downloaded from quay
-	mkdirAll()
-
-	// list repos
-	log.Print("Will list all repos")
-
-	// We create a `NewLister` (refer `list.go`) and set
-	//`IsWriteToFile` false because we don't want to store the data
-	// in the files. It is not optimized for windows. It will break
-	// when IsWritetToFile is set to true. In some future commit.
-	l, err := gmetrics.NewLister(gmetrics.ListableConfig{
-		AuthToken:          *quayAuthToken,
-		BaseOutputFilePath: "",
-		Namespace:          *quayNamespace,
-		IsWriteToFile:      false,
-		Debug:              *debug,
-		Windows:            *windows,
-	})
-	//checking for errors
-	if err != nil {
-		log.Fatalf(
-			"Failed to initialise lister: %v",
-			err,
-		)
+	cmd, found := findCommand(name)
+	if !found {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage()
+		return exitUsage
 	}
 
-	// repolist contains repos in order of popularity
-	// We call the `ListReposAndWriteToFileOptionally( )` function
-	// to get all the repolist in the namespace as a JSON format.
-	// It returns all the repos in sorted order of popularity.
-	repolist, err := l.ListReposAndWriteToFileOptionally()
-	if err != nil {
-		log.Fatalf(
-			"Failed to list repos: %v",
+	err := cmd.run(args)
+	logRetryStats()
+	code := exitCode(err)
+	switch {
+	case code == exitOK:
+	case code == exitUsage:
+		fmt.Fprintf(
+			os.Stderr,
+			"%v\nRun '%s %s -h' for usage\n",
 			err,
+			programName(),
+			cmd.name,
 		)
+	default:
+		log.Printf("Failed to %s: %v%s", cmd.name, err, hint(err))
 	}
+	return code
+}
 
-	// download logs of all repos
-	log.Print("Will download logs of all repos")
-	for _, repo := range repolist.Items {
-		logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
-			AuthToken:          *quayAuthToken,
-			Namespace:          *quayNamespace,
-			Name:               repo.Name,
-			IsWriteToFile:      true,
-			BaseOutputFilePath: *logsFilePath,
-			Debug:              *debug,
-			Windows:            *windows,
-		})
-		if err != nil {
-			log.Fatalf(
-				"Failed to initialise logger: %v",
-				err,
-			)
-		}
-		_, err = logger.Log()
-		if err != nil {
-			log.Fatalf(
-				"Failed to download logs: %v",
-				err,
-			)
+// findCommand returns the command of the given name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
 		}
 	}
+	return command{}, false
+}
+
+// printUsage prints the commands of this binary
+func printUsage() {
+	w := os.Stderr
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", programName())
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(
+		w,
+		"\nRun '%s <command> -h' for the flags of a command.\n"+
+			"\nExit codes:\n"+
+			"  %d ok\n  %d failure\n  %d invalid command, flags or arguments\n"+
+			"  %d quay rejected the auth token\n  %d namespace or repo not found\n"+
+			"  %d quay unavailable or rate limited even after retries\n"+
+			"  %d failed for some of the repos\n",
+		programName(),
+		exitOK,
+		exitFailure,
+		exitUsage,
+		exitAuth,
+		exitNotFound,
+		exitUnavailable,
+		exitPartial,
+	)
+}
+
+// exitCode returns the exit code of the given error returned by a
+// command
+func exitCode(err error) int {
+	var usage *usageError
+	var partial *partialError
+	var unauthorized *gmetrics.UnauthorizedError
+	var forbidden *gmetrics.ForbiddenError
+	var notFound *gmetrics.NotFoundError
+	var rateLimited *gmetrics.RateLimitedError
+	var serverErr *gmetrics.ServerError
+	switch {
+	case err == nil || errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.As(err, &partial):
+		return exitPartial
+	case errors.As(err, &unauthorized), errors.As(err, &forbidden):
+		return exitAuth
+	case errors.As(err, &notFound):
+		return exitNotFound
+	case errors.As(err, &rateLimited), errors.As(err, &serverErr):
+		return exitUnavailable
+	default:
+		return exitFailure
+	}
+}
+
+// hint returns a suggestion to fix the given quay API error if any
+func hint(err error) string {
+	var unauthorized *gmetrics.UnauthorizedError
+	var forbidden *gmetrics.ForbiddenError
+	var rateLimited *gmetrics.RateLimitedError
+	var serverErr *gmetrics.ServerError
+	switch {
+	case errors.As(err, &unauthorized):
+		return ": Hint: verify quay-auth-token"
+	case errors.As(err, &forbidden):
+		return ": Hint: quay-auth-token needs the Administer Repositories scope"
+	case errors.As(err, &rateLimited):
+		return ": Hint: lower rate-limit or workers"
+	case errors.As(err, &serverErr):
+		return ": Hint: quay may be down"
+	default:
+		return ""
+	}
+}
+
+// logRetryStats logs the summary of quay API requests if any were
+// made
+func logRetryStats() {
+	stats := gmetrics.GetRetryStats()
+	if stats.Requests == 0 {
+		return
+	}
+	log.Printf(
+		"Quay API requests: Total %d: Retries %d: Rate limited %d: Gave up %d",
+		stats.Requests,
+		stats.Retries,
+		stats.RateLimited,
+		stats.GaveUp,
+	)
 }
@@ -0,0 +1,760 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+func TestMain(m *testing.M) {
+	// commands log their progress
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// newServer returns a fake quay server with a couple of repos of
+// openebs namespace
+func newServer() *quaytest.Server {
+	server := quaytest.NewServer(quaytest.ServerConfig{AuthToken: "token"})
+	now := time.Now().UTC()
+	for _, name := range []string{"jiva", "cstor"} {
+		server.AddRepo("openebs", gmetrics.Popular{Name: name}, gmetrics.Log{
+			IP:       "10.0.0.1",
+			Kind:     "pull_repo",
+			Datetime: now.Add(-time.Hour).Format(gmetrics.QuayTimeFormat),
+			Metadata: gmetrics.Metadata{
+				Namespace: "openebs",
+				Repo:      name,
+				Tag:       "latest",
+			},
+		})
+	}
+	return server
+}
+
+func TestRunExitCodes(t *testing.T) {
+	var tests = map[string]struct {
+		command string
+		flags   []string
+		// isNoDefaults when set to true does not add the default quay
+		// flags to the flags
+		isNoDefaults bool
+		failure      *quaytest.Failure
+		expect       int
+	}{
+		"help": {
+			command:      "help",
+			isNoDefaults: true,
+			expect:       exitOK,
+		},
+		"help of command": {
+			command:      "fetch",
+			flags:        []string{"-h"},
+			isNoDefaults: true,
+			expect:       exitOK,
+		},
+		"unknown command": {
+			command:      "download",
+			isNoDefaults: true,
+			expect:       exitUsage,
+		},
+		"unknown flag": {
+			command: "list",
+			flags:   []string{"--colour"},
+			expect:  exitUsage,
+		},
+		"unexpected argument": {
+			command: "list",
+			flags:   []string{"openebs"},
+			expect:  exitUsage,
+		},
+		"kinds": {
+			command:      "kinds",
+			flags:        []string{"--category=audit"},
+			isNoDefaults: true,
+			expect:       exitOK,
+		},
+		"kinds of unknown category": {
+			command:      "kinds",
+			flags:        []string{"--category=pulls"},
+			isNoDefaults: true,
+			expect:       exitUsage,
+		},
+		"missing token": {
+			command: "list",
+			flags:   []string{"--quay-auth-token="},
+			expect:  exitUsage,
+		},
+		"list": {
+			command: "list",
+			flags:   []string{"--format=json"},
+			expect:  exitOK,
+		},
+		"list with filters": {
+			command: "list",
+			flags:   []string{"--include=j*", "--exclude-regex=^c", "--public=false"},
+			expect:  exitOK,
+		},
+		"list with invalid regex": {
+			command: "list",
+			flags:   []string{"--include-regex=(jiva"},
+			expect:  exitUsage,
+		},
+		"list with invalid public": {
+			command: "list",
+			flags:   []string{"--public=maybe"},
+			expect:  exitUsage,
+		},
+		"invalid token": {
+			command: "list",
+			flags:   []string{"--quay-auth-token=invalid"},
+			expect:  exitAuth,
+		},
+		"fetch": {
+			command: "fetch",
+			flags:   []string{"--storage=memory"},
+			expect:  exitOK,
+		},
+		"fetch without command": {
+			flags:  []string{"--storage=memory"},
+			expect: exitOK,
+		},
+		"fetch selected repo": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--repo=jiva"},
+			expect:  exitOK,
+		},
+		"fetch filtered repos": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--exclude=cstor"},
+			expect:  exitOK,
+		},
+		"fetch selected kinds": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--kinds=pull_repo,audit"},
+			expect:  exitOK,
+		},
+		"fetch with negative workers": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--workers=-1"},
+			expect:  exitUsage,
+		},
+		"fetch unknown kind": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--kinds=pull"},
+			expect:  exitUsage,
+		},
+		"fetch with missing geoip db": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--geoip-db=missing.mmdb"},
+			expect:  exitUsage,
+		},
+		"fetch with truncated IPs": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--ip-privacy=truncate"},
+			expect:  exitOK,
+		},
+		"fetch with unknown IP privacy": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--ip-privacy=mask"},
+			expect:  exitUsage,
+		},
+		"fetch with hashed IPs without key": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--ip-privacy=hmac", "--ip-hmac-key-env=QUAY_LOGS_TEST_MISSING"},
+			expect:  exitUsage,
+		},
+		"anonymize without IP privacy": {
+			command:      "anonymize",
+			flags:        []string{"--storage=memory"},
+			isNoDefaults: true,
+			expect:       exitUsage,
+		},
+		"purge": {
+			command:      "purge",
+			flags:        []string{"--storage=memory", "--ip=10.0.0.0/24,10.1.0.7"},
+			isNoDefaults: true,
+			expect:       exitOK,
+		},
+		"purge without ip": {
+			command:      "purge",
+			flags:        []string{"--storage=memory"},
+			isNoDefaults: true,
+			expect:       exitUsage,
+		},
+		"purge cidr of truncated ips": {
+			command:      "purge",
+			flags:        []string{"--storage=memory", "--ip=10.0.0.0/28", "--ip-privacy=truncate"},
+			isNoDefaults: true,
+			expect:       exitUsage,
+		},
+		"purge invalid ip": {
+			command:      "purge",
+			flags:        []string{"--storage=memory", "--ip=10.0.0"},
+			isNoDefaults: true,
+			expect:       exitUsage,
+		},
+		"export unknown column": {
+			command:      "export",
+			flags:        []string{"--storage=memory", "--columns=datetime,metadata.repository"},
+			isNoDefaults: true,
+			expect:       exitUsage,
+		},
+		"fetch as ndjson": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--output-format=ndjson", "--compression=zstd"},
+			expect:  exitOK,
+		},
+		"fetch json with compression": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--compression=gzip"},
+			expect:  exitUsage,
+		},
+		"fetch to a file output": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--output=logs.ndjson"},
+			expect:  exitUsage,
+		},
+		"enrich without geoip db": {
+			command:      "enrich",
+			flags:        []string{"--storage=memory"},
+			isNoDefaults: true,
+			expect:       exitUsage,
+		},
+		"fetch missing repo": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--repo=jiva,maya"},
+			expect:  exitPartial,
+		},
+		"fetch only missing repo": {
+			command: "fetch",
+			flags:   []string{"--storage=memory", "--repo=maya"},
+			expect:  exitNotFound,
+		},
+		"fetch with quay down": {
+			command: "fetch",
+			flags:   []string{"--storage=memory"},
+			failure: &quaytest.Failure{
+				StatusCode: http.StatusServiceUnavailable,
+				Times:      -1,
+			},
+			expect: exitUnavailable,
+		},
+		"fetch with a failing repo": {
+			command: "fetch",
+			flags:   []string{"--storage=memory"},
+			failure: &quaytest.Failure{
+				Path:       "/cstor/logs",
+				StatusCode: http.StatusInternalServerError,
+				Times:      -1,
+			},
+			expect: exitPartial,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newServer()
+			defer server.Close()
+			if test.failure != nil {
+				server.Fail(*test.failure)
+			}
+			var args []string
+			if test.command != "" {
+				args = append(args, test.command)
+			}
+			if !test.isNoDefaults {
+				// flags of the test come later & hence take precedence
+				args = append(
+					args,
+					"--quay-url="+server.URL,
+					"--quay-namespace=openebs",
+					"--quay-auth-token=token",
+					"--max-retries=0",
+				)
+			}
+			args = append(args, test.flags...)
+			got := run(args)
+			if got != test.expect {
+				t.Fatalf("Expected exit code %d got %d", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestRunFetchConfig(t *testing.T) {
+	var tests = map[string]struct {
+		config string
+		flags  []string
+		expect int
+		// expectRepos are the repo folders expected in the output
+		// path of each namespace
+		expectRepos map[string][]string
+	}{
+		"config": {
+			config: `
+defaults:
+  quayURL: $URL
+  authToken: token
+  outputPath: $DIR/logs
+namespaces:
+- name: openebs
+  exclude: ["cstor"]
+- name: litmuschaos
+`,
+			expect: exitOK,
+			expectRepos: map[string][]string{
+				"openebs":     {"jiva"},
+				"litmuschaos": {"go-runner"},
+			},
+		},
+		"config with namespace flag": {
+			config: `
+defaults:
+  quayURL: $URL
+  authToken: token
+  outputPath: $DIR/logs
+namespaces:
+- name: openebs
+- name: litmuschaos
+`,
+			flags:  []string{"--quay-namespace=litmuschaos"},
+			expect: exitOK,
+			expectRepos: map[string][]string{
+				"openebs":     nil,
+				"litmuschaos": {"go-runner"},
+			},
+		},
+		"config with invalid token of a namespace": {
+			config: `
+defaults:
+  quayURL: $URL
+  authToken: token
+  outputPath: $DIR/logs
+namespaces:
+- name: openebs
+- name: litmuschaos
+  authToken: invalid
+`,
+			expect: exitPartial,
+			expectRepos: map[string][]string{
+				"openebs":     {"cstor", "jiva"},
+				"litmuschaos": nil,
+			},
+		},
+		"config with filter flag": {
+			config: `
+defaults:
+  quayURL: $URL
+  authToken: token
+  outputPath: $DIR/logs
+  include: ["cstor"]
+namespaces:
+- name: openebs
+`,
+			flags:  []string{"--include=jiva"},
+			expect: exitOK,
+			expectRepos: map[string][]string{
+				"openebs": {"jiva"},
+			},
+		},
+		"config with token flag": {
+			config: `
+defaults:
+  quayURL: $URL
+  authToken: invalid
+  outputPath: $DIR/logs
+namespaces:
+- name: openebs
+`,
+			flags:  []string{"--quay-auth-token=token"},
+			expect: exitOK,
+			expectRepos: map[string][]string{
+				"openebs": {"cstor", "jiva"},
+			},
+		},
+		"config with missing token file": {
+			config: `
+defaults:
+  quayURL: $URL
+  authToken: token
+  outputPath: $DIR/logs
+namespaces:
+- name: openebs
+  authTokenFile: /no/such/file
+`,
+			expect: exitUsage,
+		},
+		"config with unknown field": {
+			config: `
+defaults:
+  quayURL: $URL
+  authToken: token
+  outputPath: $DIR/logs
+namespaces:
+- name: openebs
+  colour: blue
+`,
+			expect: exitUsage,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newServer()
+			defer server.Close()
+			server.AddRepo("litmuschaos", gmetrics.Popular{Name: "go-runner"}, gmetrics.Log{
+				IP:       "10.0.0.2",
+				Kind:     "pull_repo",
+				Datetime: time.Now().UTC().Add(-time.Hour).Format(gmetrics.QuayTimeFormat),
+			})
+
+			dir, err := ioutil.TempDir("", "fetch-config")
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			defer os.RemoveAll(dir)
+			content := strings.NewReplacer(
+				"$URL", server.URL,
+				"$DIR", dir,
+			).Replace(test.config)
+			filename := filepath.Join(dir, "config.yaml")
+			err = ioutil.WriteFile(filename, []byte(content), 0644)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			args := append(
+				[]string{"fetch", "--config=" + filename, "--max-retries=0"},
+				test.flags...,
+			)
+			got := run(args)
+			if got != test.expect {
+				t.Fatalf("Expected exit code %d got %d", test.expect, got)
+			}
+			for namespace, expect := range test.expectRepos {
+				var repos []string
+				infos, _ := ioutil.ReadDir(filepath.Join(dir, "logs", namespace))
+				for _, info := range infos {
+					repos = append(repos, info.Name())
+				}
+				if !reflect.DeepEqual(repos, expect) {
+					t.Fatalf(
+						"Expected repos %v of namespace %q got %v",
+						expect,
+						namespace,
+						repos,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestRunTrend(t *testing.T) {
+	var tests = map[string]struct {
+		snapshots int
+		flags     []string
+		expect    int
+	}{
+		"latest two": {
+			snapshots: 3,
+			expect:    exitOK,
+		},
+		"from date": {
+			snapshots: 3,
+			flags:     []string{"--from=2020-08-06", "--to=2020-08-08T09:13:10Z", "--format=json"},
+			expect:    exitOK,
+		},
+		"list": {
+			snapshots: 3,
+			flags:     []string{"--list"},
+			expect:    exitOK,
+		},
+		"single snapshot": {
+			snapshots: 1,
+			expect:    exitFailure,
+		},
+		"no snapshot on date": {
+			snapshots: 3,
+			flags:     []string{"--from=2020-07-01"},
+			expect:    exitUsage,
+		},
+		"from after to": {
+			snapshots: 3,
+			flags:     []string{"--from=latest", "--to=2020-08-06"},
+			expect:    exitUsage,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "trend")
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			defer os.RemoveAll(dir)
+			day := time.Date(2020, 8, 6, 9, 13, 10, 0, time.UTC)
+			for i := 0; i < test.snapshots; i++ {
+				err = gmetrics.SaveSnapshot(storage.NewLocal(dir), gmetrics.Snapshot{
+					Namespace: "openebs",
+					Time:      day.AddDate(0, 0, i),
+					Repos: []gmetrics.Popular{
+						{Name: "jiva", Popularity: float64(10 * i)},
+						{Name: "cstor", Popularity: 15},
+					},
+				})
+				if err != nil {
+					t.Fatalf("Expected no error got %v", err)
+				}
+			}
+			args := append(
+				[]string{"trend", "--quay-namespace=openebs", "--logs-file-path=" + dir},
+				test.flags...,
+			)
+			got := run(args)
+			if got != test.expect {
+				t.Fatalf("Expected exit code %d got %d", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestRunFetchTakesSnapshot(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	got := run([]string{
+		"fetch",
+		"--quay-url=" + server.URL,
+		"--quay-namespace=openebs",
+		"--quay-auth-token=token",
+		"--logs-file-path=" + dir,
+		"--exclude=cstor",
+	})
+	if got != exitOK {
+		t.Fatalf("Expected exit code %d got %d", exitOK, got)
+	}
+	snapshots, err := gmetrics.LoadSnapshots(storage.NewLocal(dir), "openebs", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	// snapshots have all the repos irrespective of filters
+	if len(snapshots) != 1 || len(snapshots[0].Repos) != 2 {
+		t.Fatalf("Expected a snapshot of 2 repos got %+v", snapshots)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	got := run([]string{
+		"fetch",
+		"--quay-url=" + server.URL,
+		"--quay-namespace=openebs",
+		"--quay-auth-token=token",
+		"--logs-file-path=" + dir,
+	})
+	if got != exitOK {
+		t.Fatalf("Expected exit code %d got %d", exitOK, got)
+	}
+
+	var tests = map[string]struct {
+		flags  []string
+		expect int
+	}{
+		"tables": {
+			flags:  []string{"--by=repo,week"},
+			expect: exitOK,
+		},
+		"html & markdown": {
+			flags: []string{
+				"--html=" + filepath.Join(dir, "report.html"),
+				"--markdown=" + filepath.Join(dir, "report.md"),
+				"--title=OpenEBS pulls",
+			},
+			expect: exitOK,
+		},
+		"invalid dates": {
+			flags:  []string{"--start-date=2020-08-13", "--end-date=2020-08-01"},
+			expect: exitUsage,
+		},
+		"unknown dimension": {
+			flags:  []string{"--by=colour"},
+			expect: exitUsage,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			args := append([]string{"report", "--logs-file-path=" + dir}, test.flags...)
+			got := run(args)
+			if got != test.expect {
+				t.Fatalf("Expected exit code %d got %d", test.expect, got)
+			}
+		})
+	}
+	for _, name := range []string{"report.html", "report.md"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if !strings.Contains(string(data), "OpenEBS pulls") {
+			t.Fatalf("Expected title in %s got %s", name, data)
+		}
+	}
+}
+
+func TestRunExportDateRange(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	got := run([]string{
+		"fetch",
+		"--quay-url=" + server.URL,
+		"--quay-namespace=openebs",
+		"--quay-auth-token=token",
+		"--logs-file-path=" + dir,
+	})
+	if got != exitOK {
+		t.Fatalf("Expected exit code %d got %d", exitOK, got)
+	}
+
+	today := time.Now().UTC()
+	var tests = map[string]struct {
+		flags  []string
+		expect int
+	}{
+		"all dates": {
+			expect: 2,
+		},
+		"dates of the logs": {
+			flags: []string{
+				"--start-date=" + today.AddDate(0, 0, -2).Format(gmetrics.ISODateFormat),
+				"--end-date=" + today.Format(gmetrics.ISODateFormat),
+			},
+			expect: 2,
+		},
+		"dates after the logs": {
+			flags: []string{
+				"--start-date=" + today.AddDate(0, 0, 1).Format(gmetrics.ISODateFormat),
+			},
+		},
+		"dates before the logs": {
+			flags: []string{
+				"--end-date=" + today.AddDate(0, 0, -2).Format(gmetrics.ISODateFormat),
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			output := filepath.Join(dir, "logs.csv")
+			args := append([]string{
+				"export",
+				"--logs-file-path=" + dir,
+				"--output=" + output,
+			}, test.flags...)
+			got := run(args)
+			if got != exitOK {
+				t.Fatalf("Expected exit code %d got %d", exitOK, got)
+			}
+			data, err := ioutil.ReadFile(output)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			// first line is the header
+			rows := strings.Count(string(data), "\n") - 1
+			if rows != test.expect {
+				t.Fatalf("Expected %d rows got %d:\n%s", test.expect, rows, data)
+			}
+		})
+	}
+}
+
+func TestRunFetchStreamsToStdout(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stdout, err := ioutil.TempFile("", "stdout")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
+
+	original := os.Stdout
+	os.Stdout = stdout
+	got := run([]string{
+		"fetch",
+		"--quay-url=" + server.URL,
+		"--quay-namespace=openebs",
+		"--quay-auth-token=token",
+		"--logs-file-path=" + dir,
+		"--output=-",
+		"--compression=gzip",
+	})
+	os.Stdout = original
+	if got != exitOK {
+		t.Fatalf("Expected exit code %d got %d", exitOK, got)
+	}
+
+	raw, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	logs, err := gmetrics.DecodeLogList(raw, gmetrics.FormatNDJSONGzip)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(logs.Items) == 0 {
+		t.Fatalf("Expected streamed logs got none")
+	}
+	// logs are not stored when streamed
+	repos, err := gmetrics.ReadRepoLogs(storage.NewLocal(dir), false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(repos) != 0 {
+		t.Fatalf("Expected no stored logs got %+v", repos)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/logdb"
+)
+
+// runPurge removes the stored logs of the given IPs & CIDR ranges
+// e.g. to honour a request to erase the data of an organisation. An
+// audit record of the purge is stored along with the logs. Logs of
+// the embedded database are removed as well if it exists.
+func runPurge(args []string) error {
+	fs := newCommandFlags("purge")
+	stores := addStorageFlags(fs)
+	privacy := addPrivacyFlags(fs)
+	debug := addDebugFlag(fs)
+	ips := fs.String(
+		"ip",
+		"",
+		"comma separated IPs or CIDR ranges whose logs are removed e.g. 203.0.113.7,198.51.100.0/24; an IP removes its whole /24 with ip-privacy=truncate",
+	)
+	ipFile := fs.String(
+		"ip-file",
+		"",
+		"(optional) file having IPs or CIDR ranges whose logs are removed; one per line; lines starting with # are ignored",
+	)
+	dryRun := fs.Bool(
+		"dry-run",
+		false,
+		"when set to true the logs to remove are counted without modifying the storage",
+	)
+	dbPath := fs.String(
+		"db-path",
+		"./quay-logs.db",
+		"(optional) embedded database whose logs are removed as well; skipped if it does not exist",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	targets := splitList(*ips)
+	if *ipFile != "" {
+		more, err := readIPFile(*ipFile)
+		if err != nil {
+			return usageErrorf("Invalid ip-file: %v", err)
+		}
+		targets = append(targets, more...)
+	}
+	if len(targets) == 0 {
+		return usageErrorf("Missing ip or ip-file")
+	}
+	anonymizer, err := privacy.newAnonymizer()
+	if err != nil {
+		return err
+	}
+	matcher, err := gmetrics.NewIPMatcher(targets, anonymizer)
+	if err != nil {
+		return usageErrorf("Invalid ip: %v", err)
+	}
+	store, err := stores.newStorage()
+	if err != nil {
+		return err
+	}
+	// database is opened before the storage is modified so that a
+	// database locked by another process fails the purge early
+	var db *logdb.DB
+	if _, err := os.Stat(*dbPath); err == nil {
+		db, err = logdb.Open(logdb.Config{Path: *dbPath, Debug: *debug})
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+
+	log.Printf(
+		"Will purge logs: Storage %s: Targets %d: Dry run %t",
+		*stores.storageType,
+		len(targets),
+		*dryRun,
+	)
+	record, err := gmetrics.Purge(store, gmetrics.PurgeConfig{
+		Matcher:  matcher,
+		IsDryRun: *dryRun,
+		Debug:    *debug,
+	})
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to purge logs: Removed %d",
+			record.RemovedCount,
+		)
+	}
+	verb := "Purged"
+	if *dryRun {
+		verb = "Would purge"
+	}
+	for _, file := range record.Files {
+		log.Printf(
+			"%s logs file: Key %q: Removed %d: Deleted %t",
+			verb,
+			file.Key,
+			file.Removed,
+			file.IsDeleted,
+		)
+	}
+	log.Printf(
+		"%s logs: Files %d: Logs %d: Modified files %d: Removed %d",
+		verb,
+		record.FileCount,
+		record.LogCount,
+		len(record.Files),
+		record.RemovedCount,
+	)
+	if !*dryRun {
+		log.Printf("Stored audit record of purge: Key %q", record.Key())
+	}
+	if db == nil {
+		return nil
+	}
+	removed, err := db.PurgeLogs(func(entry gmetrics.Log) bool {
+		return matcher.Match(entry.IP)
+	}, *dryRun)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to purge logs of database: Storage is purged: Run purge again",
+		)
+	}
+	log.Printf("%s logs of database: Path %q: Removed %d", verb, *dbPath, removed)
+	return nil
+}
+
+// readIPFile returns the IPs or CIDR ranges of the given file
+func readIPFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var out []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, scanner.Err()
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/aggregate"
+	"github.com/mayadata.io/quay-logs/report"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// runReport prints tables of pull & push counts of the logs of the
+// storage grouped by the given dimensions
+//
+// It writes a usage report as HTML and / or Markdown as well if
+// their files are set.
+func runReport(args []string) error {
+	fs := newCommandFlags("report")
+	stores := addStorageFlags(fs)
+	dates := addDateFlags(fs)
+	debug := addDebugFlag(fs)
+	by := fs.String(
+		"by",
+		"namespace,repo,tag,kind,country,day",
+		"(optional) comma separated dimensions to report counts by; one or more of: namespace, repo, tag, kind, country, city, network, day, week, month",
+	)
+	top := fs.Int(
+		"top",
+		0,
+		"(optional) number of rows reported per dimension; 0 reports all rows; the HTML & Markdown reports default to 10 rows",
+	)
+	htmlFile := fs.String(
+		"html",
+		"",
+		"(optional) file of the usage report as a self-contained HTML page with charts e.g. report.html",
+	)
+	markdownFile := fs.String(
+		"markdown",
+		"",
+		"(optional) file of the usage report as Markdown e.g. report.md",
+	)
+	title := fs.String(
+		"title",
+		"",
+		"(optional) title of the HTML & Markdown reports",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	start, end, err := dates.parse()
+	if err != nil {
+		return err
+	}
+	var dimensions []aggregate.Dimension
+	for _, name := range splitList(*by) {
+		d, err := aggregate.ParseDimension(name)
+		if err != nil {
+			return usageErrorf("Invalid by: %v", err)
+		}
+		dimensions = append(dimensions, d)
+	}
+	store, err := stores.newStorage()
+	if err != nil {
+		return err
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, *debug)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to read logs",
+		)
+	}
+
+	if *htmlFile != "" || *markdownFile != "" {
+		snapshots, err := latestSnapshots(store, repos)
+		if err != nil {
+			return err
+		}
+		r := report.Build(report.Config{
+			Title: *title,
+			Start: start,
+			End:   end,
+			Top:   *top,
+		}, repos, snapshots)
+		if *htmlFile != "" {
+			err = writeReportFile(*htmlFile, r, report.WriteHTML)
+			if err != nil {
+				return err
+			}
+		}
+		if *markdownFile != "" {
+			err = writeReportFile(*markdownFile, r, report.WriteMarkdown)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	a := aggregate.NewAggregator()
+	for _, repo := range repos {
+		for _, entry := range repo.Items {
+			if isInDateRange(entry, start, end) {
+				a.Add(entry)
+			}
+		}
+	}
+
+	total := a.Total()
+	fmt.Printf(
+		"Logs %d: Pulls %d: Pushes %d\n",
+		total.Total,
+		total.Pulls,
+		total.Pushes,
+	)
+	for _, d := range dimensions {
+		fmt.Println()
+		err = aggregate.WriteTable(os.Stdout, d, a.Counts(d), *top)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"Failed to print report",
+			)
+		}
+	}
+	return nil
+}
+
+// isInDateRange returns true if the given log is from the given
+// dates. Both dates are inclusive & zero dates mean no limit. Logs
+// whose datetime can not be parsed are in range only if no dates
+// are given.
+func isInDateRange(entry gmetrics.Log, start, end time.Time) bool {
+	if start.IsZero() && end.IsZero() {
+		return true
+	}
+	t, err := entry.Time()
+	if err != nil {
+		return false
+	}
+	return (start.IsZero() || !t.Before(start)) &&
+		(end.IsZero() || t.Before(end.AddDate(0, 0, 1)))
+}
+
+// latestSnapshots returns the latest popularity snapshot of every
+// namespace of the given repos. Namespaces without snapshots are
+// skipped.
+func latestSnapshots(store storage.Storage, repos []gmetrics.RepoLogs) ([]gmetrics.Snapshot, error) {
+	var out []gmetrics.Snapshot
+	seen := map[string]bool{}
+	for _, repo := range repos {
+		if repo.Namespace == "" || seen[repo.Namespace] {
+			continue
+		}
+		seen[repo.Namespace] = true
+		times, err := gmetrics.ListSnapshots(store, repo.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if len(times) == 0 {
+			continue
+		}
+		snapshot, err := gmetrics.LoadSnapshot(store, repo.Namespace, times[len(times)-1])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, snapshot)
+	}
+	return out, nil
+}
+
+// writeReportFile writes the given report to the given file with the
+// given writer
+func writeReportFile(
+	filename string,
+	r report.Report,
+	write func(io.Writer, report.Report) error,
+) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to create report file",
+		)
+	}
+	defer file.Close()
+	err = write(file, r)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote report: File %q", filename)
+	return nil
+}
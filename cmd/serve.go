@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mayadata.io/quay-logs/exporter"
+)
+
+// runServe runs an http server that exposes prometheus metrics of
+// the namespace. Metrics are refreshed from quay at every refresh
+// interval.
+func runServe(args []string) error {
+	fs := newCommandFlags("serve")
+	quay := addQuayFlags(fs)
+	debug := addDebugFlag(fs)
+	listenAddress := fs.String(
+		"listen-address",
+		":9796",
+		"(optional) address on which metrics are exposed at /metrics",
+	)
+	refreshInterval := fs.Duration(
+		"refresh-interval",
+		5*time.Minute,
+		"(optional) interval at which metrics are refreshed from quay",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	err = quay.apply()
+	if err != nil {
+		return err
+	}
+	e, err := exporter.New(exporter.Config{
+		QuayURL:          *quay.url,
+		Namespace:        *quay.namespace,
+		AuthToken:        *quay.authToken,
+		Interval:         *refreshInterval,
+		Debug:            *debug,
+		AllowPartialList: *quay.allowPartialList,
+	})
+	if err != nil {
+		return usageErrorf("Invalid exporter config: %v", err)
+	}
+	go e.Run(context.Background())
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e.Handler())
+	log.Printf("Will serve metrics: Address %s", *listenAddress)
+	err = http.ListenAndServe(*listenAddress, mux)
+	return errors.Wrapf(
+		err,
+		"Failed to serve metrics: Address %s",
+		*listenAddress,
+	)
+}
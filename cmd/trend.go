@@ -0,0 +1,246 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// selectLatest selects the newest snapshot
+const selectLatest string = "latest"
+
+// runTrend compares two popularity snapshots of the namespace. The
+// two newest snapshots are compared by default.
+func runTrend(args []string) error {
+	fs := newCommandFlags("trend")
+	stores := addStorageFlags(fs)
+	namespace := fs.String(
+		"quay-namespace",
+		os.Getenv("QUAY-NAMESPACE"),
+		"namespace whose snapshots are compared",
+	)
+	from := fs.String(
+		"from",
+		"",
+		"(optional) older snapshot; one of: latest, a time e.g. 2020-08-06T09:13:10Z or a date e.g. 2020-08-06 that selects its newest snapshot; defaults to the snapshot before to",
+	)
+	to := fs.String(
+		"to",
+		selectLatest,
+		"(optional) newer snapshot; same values as from",
+	)
+	top := fs.Int(
+		"top",
+		0,
+		"(optional) number of repos printed; 0 prints all repos",
+	)
+	format := fs.String(
+		"format",
+		formatTable,
+		"(optional) output format; one of: table, json",
+	)
+	isList := fs.Bool(
+		"list",
+		false,
+		"(optional) when set to true the times of the snapshots are printed instead",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	if *namespace == "" {
+		return usageErrorf("Missing quay namespace")
+	}
+	if *format != formatTable && *format != formatJSON {
+		return usageErrorf("Unsupported format %q", *format)
+	}
+	store, err := stores.newStorage()
+	if err != nil {
+		return err
+	}
+
+	times, err := gmetrics.ListSnapshots(store, *namespace)
+	if err != nil {
+		return err
+	}
+	if *isList {
+		for _, t := range times {
+			fmt.Println(t.Format(time.RFC3339))
+		}
+		return nil
+	}
+	if len(times) == 0 {
+		return errors.Errorf(
+			"No snapshots of namespace %q: Run fetch to take snapshots",
+			*namespace,
+		)
+	}
+	toIndex, err := selectSnapshot(times, *to)
+	if err != nil {
+		return usageErrorf("Invalid to: %v", err)
+	}
+	fromIndex := toIndex - 1
+	if *from != "" {
+		fromIndex, err = selectSnapshot(times, *from)
+		if err != nil {
+			return usageErrorf("Invalid from: %v", err)
+		}
+	}
+	if fromIndex < 0 {
+		return errors.Errorf(
+			"No snapshot of namespace %q before %s: Snapshots %d",
+			*namespace,
+			times[toIndex].Format(time.RFC3339),
+			len(times),
+		)
+	}
+	if fromIndex > toIndex {
+		return usageErrorf(
+			"Invalid snapshots: From %s is after to %s",
+			times[fromIndex].Format(time.RFC3339),
+			times[toIndex].Format(time.RFC3339),
+		)
+	}
+
+	// history has the snapshots from the older till the newer one
+	history, err := gmetrics.LoadSnapshots(store, *namespace, times[fromIndex], times[toIndex])
+	if err != nil {
+		return err
+	}
+	older, newer := history[0], history[len(history)-1]
+	trends := gmetrics.CompareSnapshots(older, newer, history)
+	if *top > 0 && len(trends) > *top {
+		trends = trends[:*top]
+	}
+	if *format == formatJSON {
+		return writeTrendsJSON(os.Stdout, older, newer, trends)
+	}
+	fmt.Printf(
+		"Namespace %s: From %s: To %s: Snapshots %d\n\n",
+		*namespace,
+		older.Time.Format(time.RFC3339),
+		newer.Time.Format(time.RFC3339),
+		len(history),
+	)
+	return writeTrendsTable(os.Stdout, trends)
+}
+
+// selectSnapshot returns the index of the snapshot selected by the
+// given value among the given times of snapshots
+func selectSnapshot(times []time.Time, value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == selectLatest {
+		return len(times) - 1, nil
+	}
+	for _, layout := range []string{time.RFC3339, gmetrics.SnapshotTimeFormat} {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		for i, snapshot := range times {
+			if snapshot.Equal(t) {
+				return i, nil
+			}
+		}
+		return 0, errors.Errorf("No snapshot at %s", value)
+	}
+	day, err := gmetrics.ParseDate(value)
+	if err != nil {
+		return 0, errors.Errorf(
+			"Invalid snapshot %q: Must be latest, a time or a date",
+			value,
+		)
+	}
+	// newest snapshot of the day
+	for i := len(times) - 1; i >= 0; i-- {
+		if !times[i].Before(day) && times[i].Before(day.AddDate(0, 0, 1)) {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("No snapshot on %s", value)
+}
+
+// writeTrendsJSON prints the given trends as JSON
+func writeTrendsJSON(w io.Writer, from, to gmetrics.Snapshot, trends []gmetrics.RepoTrend) error {
+	type trend struct {
+		gmetrics.RepoTrend
+		Sparkline string `json:"sparkline"`
+	}
+	out := struct {
+		Namespace string    `json:"namespace"`
+		From      time.Time `json:"from"`
+		To        time.Time `json:"to"`
+		Repos     []trend   `json:"repositories"`
+	}{
+		Namespace: to.Namespace,
+		From:      from.Time,
+		To:        to.Time,
+		Repos:     []trend{},
+	}
+	for _, t := range trends {
+		out.Repos = append(out.Repos, trend{RepoTrend: t, Sparkline: gmetrics.Sparkline(t.History)})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// writeTrendsTable prints the given trends as a table
+func writeTrendsTable(w io.Writer, trends []gmetrics.RepoTrend) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tCHANGE\tREPO\tSCORE\tDELTA\tHISTORY")
+	for _, t := range trends {
+		rank := "-"
+		if t.ToRank > 0 {
+			rank = fmt.Sprint(t.ToRank)
+		}
+		var change string
+		switch {
+		case t.Status == gmetrics.TrendNew:
+			change = "new"
+		case t.Status == gmetrics.TrendRemoved:
+			change = "removed"
+		case t.RankChange > 0:
+			change = fmt.Sprintf("↑%d", t.RankChange)
+		case t.RankChange < 0:
+			change = fmt.Sprintf("↓%d", -t.RankChange)
+		default:
+			change = "="
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%g\t%+g\t%s\n",
+			rank,
+			change,
+			t.Name,
+			t.ToScore,
+			t.ScoreDelta,
+			gmetrics.Sparkline(t.History),
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultWorkers is the number of repos whose logs are collected
+// concurrently when not configured
+const DefaultWorkers int = 4
+
+// CollectorConfig is used to initialise a Collector instance
+type CollectorConfig struct {
+	// Logger is the config used to create the logger of every repo.
+	// Name is set to the name of the repo.
+	Logger LoggableConfig
+
+	// Workers is the number of repos whose logs are collected
+	// concurrently. Defaults to DefaultWorkers.
+	Workers int
+
+	// State is optional. When set logs older than the high water
+	// mark of the repo are skipped & the state is saved after the
+	// logs of every repo are collected.
+	State *SyncState
+}
+
+// RepoResult is the outcome of collecting logs of a repo
+type RepoResult struct {
+	Name     string
+	Logs     LogList
+	Duration time.Duration
+	Err      error
+}
+
+// Collector collects logs of several repos of a namespace
+// concurrently using a bounded pool of workers
+type Collector struct {
+	CollectorConfig
+}
+
+// NewCollector returns a new instance of Collector
+func NewCollector(config CollectorConfig) (*Collector, error) {
+	if config.Workers < 0 {
+		return nil, errors.Errorf(
+			"Invalid workers %d: Must not be negative",
+			config.Workers,
+		)
+	}
+	if config.Workers == 0 {
+		config.Workers = DefaultWorkers
+	}
+	return &Collector{
+		CollectorConfig: config,
+	}, nil
+}
+
+// Collect collects logs of the given repos
+//
+// Results are returned in the order of the given repos irrespective
+// of the order in which these got collected. A failure to collect
+// logs of a repo does not stop the logs of other repos from being
+// collected.
+func (c *Collector) Collect(repos []Popular) []RepoResult {
+	results := make([]RepoResult, len(repos))
+	indexes := make(chan int)
+
+	var done int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < c.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = c.collectRepo(repos[i].Name)
+
+				mu.Lock()
+				done++
+				c.logProgress(done, len(repos), results[i])
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range repos {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// collectRepo collects logs of the given repo & updates the high
+// water mark of the repo
+func (c *Collector) collectRepo(name string) RepoResult {
+	started := time.Now()
+	result := RepoResult{
+		Name: name,
+	}
+
+	config := c.Logger
+	config.Name = name
+	if c.State != nil {
+		config.Since = c.State.HighWaterMark(config.Namespace, name, config.Kinds)
+		config.Seen = c.State.SeenAtHighWaterMark(config.Namespace, name, config.Kinds)
+	}
+	logger, err := NewLogger(config)
+	if err != nil {
+		result.Err = errors.Wrapf(err, "Failed to initialise logger")
+		result.Duration = time.Since(started)
+		return result
+	}
+	result.Logs, result.Err = logger.Log()
+	if result.Err == nil && c.State != nil {
+		// state is saved after every repo so that the logs downloaded
+		// so far are not downloaded again if this run fails midway
+		//
+		// NOTE:
+		//	The newest log received is used instead of the newest
+		// log kept since the latter may be older when kinds are
+		// filtered
+		newest, seen := logger.Newest()
+		c.State.Update(config.Namespace, name, config.Kinds, newest, seen)
+		result.Err = c.State.Save()
+	}
+	result.Duration = time.Since(started)
+	return result
+}
+
+// logProgress logs the progress after the logs of a repo are
+// collected
+func (c *Collector) logProgress(done int, total int, result RepoResult) {
+	if result.Err != nil {
+		log.Printf(
+			"[%d/%d] Failed to collect logs: Namespace %q: Name %q: %v",
+			done,
+			total,
+			c.Logger.Namespace,
+			result.Name,
+			result.Err,
+		)
+		return
+	}
+	log.Printf(
+		"[%d/%d] Collected logs: Namespace %q: Name %q: Logs %d: Took %s",
+		done,
+		total,
+		c.Logger.Namespace,
+		result.Name,
+		len(result.Logs.Items),
+		result.Duration.Round(time.Millisecond),
+	)
+}
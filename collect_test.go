@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+func TestCollectorCollectsConcurrently(t *testing.T) {
+	server := quaytest.NewServer(quaytest.ServerConfig{
+		Clock:   quaytest.NewClock(now),
+		Latency: 10 * time.Millisecond,
+	})
+	defer server.Close()
+	var repos []gmetrics.Popular
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("repo-%d", i)
+		repos = append(repos, gmetrics.Popular{Name: name})
+		// repos have distinct number of logs to tell apart results
+		server.AddRepo(
+			"openebs",
+			gmetrics.Popular{Name: name},
+			newPullLogs("openebs", name, now.Add(-24*time.Hour), i+1)...,
+		)
+	}
+	server.Fail(quaytest.Failure{
+		Path:       "/repo-3/logs",
+		StatusCode: http.StatusNotFound,
+		Times:      -1,
+	})
+
+	c, err := gmetrics.NewCollector(gmetrics.CollectorConfig{
+		Logger: gmetrics.LoggableConfig{
+			QuayURL:   server.URL,
+			Namespace: "openebs",
+			Clock:     quaytest.NewClock(now),
+		},
+		Workers: 3,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	results := c.Collect(repos)
+
+	if got := server.MaxInFlight(); got < 2 || got > 3 {
+		t.Fatalf("Expected 2 to 3 concurrent requests got %d", got)
+	}
+	if len(results) != len(repos) {
+		t.Fatalf("Expected %d results got %d", len(repos), len(results))
+	}
+	for i, result := range results {
+		if result.Name != repos[i].Name {
+			t.Fatalf("Expected result %d of %q got %q", i, repos[i].Name, result.Name)
+		}
+		if i == 3 {
+			if result.Err == nil {
+				t.Fatalf("Expected error of %q got none", result.Name)
+			}
+			continue
+		}
+		// failure of a repo does not abort the others
+		if result.Err != nil {
+			t.Fatalf("Expected no error of %q got %v", result.Name, result.Err)
+		}
+		if len(result.Logs.Items) != i+1 {
+			t.Fatalf("Expected %d logs of %q got %d", i+1, result.Name, len(result.Logs.Items))
+		}
+	}
+}
+
+func TestCollectorKeepsHighWaterMarkPerKinds(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(25)
+	defer server.Close()
+	// pushes are newer than the pulls
+	var pushes []gmetrics.Log
+	for _, entry := range newPullLogs("openebs", "jiva", now.Add(-10*time.Hour), 3) {
+		entry.Kind = gmetrics.KindPushRepo
+		pushes = append(pushes, entry)
+	}
+	server.AddLogs("openebs", "jiva", pushes...)
+
+	state, err := gmetrics.LoadSyncState(store)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	collect := func(kinds ...gmetrics.LogKind) int {
+		c, err := gmetrics.NewCollector(gmetrics.CollectorConfig{
+			Logger: gmetrics.LoggableConfig{
+				QuayURL:       server.URL,
+				Namespace:     "openebs",
+				IsWriteToFile: true,
+				Storage:       store,
+				Clock:         quaytest.NewClock(now),
+				Kinds:         kinds,
+			},
+			State: state,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		results := c.Collect([]gmetrics.Popular{{Name: "jiva"}})
+		if len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("Expected 1 result with no error got %+v", results)
+		}
+		return len(results[0].Logs.Items)
+	}
+
+	// pushes are not wanted yet these tell the newest log received
+	if got := collect(gmetrics.KindPullRepo); got != 25 {
+		t.Fatalf("Expected 25 pull logs got %d", got)
+	}
+	newest := now.Add(-8 * time.Hour)
+	mark := state.HighWaterMark("openebs", "jiva", []gmetrics.LogKind{gmetrics.KindPullRepo})
+	if !mark.Equal(newest) {
+		t.Fatalf("Expected high water mark %s got %s", newest, mark)
+	}
+	// logs of other kinds are not skipped by the above download
+	if got := collect(); got != 3 {
+		t.Fatalf("Expected 3 push logs got %d", got)
+	}
+	if got := collect(); got != 0 {
+		t.Fatalf("Expected no new logs got %d", got)
+	}
+}
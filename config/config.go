@@ -0,0 +1,264 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config loads the YAML or JSON file that lists the quay
+// namespaces to collect along with their collection profiles.
+//
+// A config file looks like:
+//
+//	defaults:
+//	  quayURL: https://quay.io
+//	  authTokenEnv: QUAY_AUTH_TOKEN
+//	  outputPath: ./logs
+//	namespaces:
+//	- name: openebs
+//	  exclude: ["*-ci"]
+//	  isPublic: true
+//	  minPopularity: 1
+//	- name: litmuschaos
+//	  authTokenFile: /etc/quay/litmuschaos-token
+//	  include: ["go-*"]
+//	  startDate: 2020-08-01
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// Profile decides how the logs of a namespace are collected. Empty
+// fields fall back to the defaults of the config file & then to the
+// flags of the binary.
+type Profile struct {
+	// QuayURL is the base URL of the quay instance
+	QuayURL string `json:"quayURL,omitempty" yaml:"quayURL,omitempty"`
+
+	// AuthToken is the quay auth token. Prefer AuthTokenEnv or
+	// AuthTokenFile to keep tokens out of the config file.
+	AuthToken string `json:"authToken,omitempty" yaml:"authToken,omitempty"`
+
+	// AuthTokenEnv is the environment variable that has the quay
+	// auth token
+	AuthTokenEnv string `json:"authTokenEnv,omitempty" yaml:"authTokenEnv,omitempty"`
+
+	// AuthTokenFile is the file that has the quay auth token
+	AuthTokenFile string `json:"authTokenFile,omitempty" yaml:"authTokenFile,omitempty"`
+
+	// RepoFilter selects the repos whose logs are collected
+	gmetrics.RepoFilter `json:",inline" yaml:",inline"`
+
+	// OutputPath is where the logs are stored i.e. the folder of
+	// local storage or the key prefix of s3 storage
+	OutputPath string `json:"outputPath,omitempty" yaml:"outputPath,omitempty"`
+
+	// StartDate & EndDate select the date range of logs e.g.
+	// 2020-08-06 or Aug-06-2020. Both are inclusive.
+	StartDate string `json:"startDate,omitempty" yaml:"startDate,omitempty"`
+	EndDate   string `json:"endDate,omitempty" yaml:"endDate,omitempty"`
+}
+
+// Namespace is a quay namespace along with its profile
+type Namespace struct {
+	Name    string `json:"name" yaml:"name"`
+	Profile `json:",inline" yaml:",inline"`
+}
+
+// Config lists the namespaces to collect
+type Config struct {
+	// Defaults apply to all the namespaces
+	Defaults Profile `json:"defaults,omitempty" yaml:"defaults,omitempty"`
+
+	Namespaces []Namespace `json:"namespaces" yaml:"namespaces"`
+}
+
+// Load reads the config of the given YAML or JSON file. The defaults
+// are applied to the namespaces of the returned config.
+func Load(filename string) (*Config, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to read config: %s",
+			filename,
+		)
+	}
+	config, err := Parse(raw)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Invalid config: %s",
+			filename,
+		)
+	}
+	return config, nil
+}
+
+// Parse parses the given YAML or JSON content. JSON is parsed as
+// YAML since YAML is a superset of JSON. The defaults are applied to
+// the namespaces of the returned config.
+func Parse(raw []byte) (*Config, error) {
+	var config Config
+	err := yaml.UnmarshalStrict(raw, &config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal config")
+	}
+	seen := map[string]bool{}
+	for i := range config.Namespaces {
+		ns := &config.Namespaces[i]
+		if ns.Name == "" {
+			return nil, errors.Errorf("Missing name of namespace %d", i+1)
+		}
+		if seen[ns.Name] {
+			return nil, errors.Errorf("Duplicate namespace %q", ns.Name)
+		}
+		seen[ns.Name] = true
+		ns.Profile = ns.Profile.withDefaults(config.Defaults)
+		err = ns.Profile.validate()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid namespace %q", ns.Name)
+		}
+	}
+	return &config, nil
+}
+
+// Namespace returns the namespace of the given name
+func (c *Config) Namespace(name string) (Namespace, bool) {
+	for _, ns := range c.Namespaces {
+		if ns.Name == name {
+			return ns, true
+		}
+	}
+	return Namespace{}, false
+}
+
+// withDefaults returns this profile with its empty fields set from
+// the given defaults
+func (p Profile) withDefaults(defaults Profile) Profile {
+	if p.QuayURL == "" {
+		p.QuayURL = defaults.QuayURL
+	}
+	if p.AuthToken == "" && p.AuthTokenEnv == "" && p.AuthTokenFile == "" {
+		// token sources are defaulted together since a namespace
+		// should not mix these
+		p.AuthToken = defaults.AuthToken
+		p.AuthTokenEnv = defaults.AuthTokenEnv
+		p.AuthTokenFile = defaults.AuthTokenFile
+	}
+	if len(p.Include) == 0 {
+		p.Include = defaults.Include
+	}
+	if len(p.Exclude) == 0 {
+		p.Exclude = defaults.Exclude
+	}
+	if len(p.IncludeRegex) == 0 {
+		p.IncludeRegex = defaults.IncludeRegex
+	}
+	if len(p.ExcludeRegex) == 0 {
+		p.ExcludeRegex = defaults.ExcludeRegex
+	}
+	if p.IsPublic == nil {
+		p.IsPublic = defaults.IsPublic
+	}
+	if len(p.States) == 0 {
+		p.States = defaults.States
+	}
+	if p.MinPopularity == nil {
+		p.MinPopularity = defaults.MinPopularity
+	}
+	if p.OutputPath == "" {
+		p.OutputPath = defaults.OutputPath
+	}
+	if p.StartDate == "" {
+		p.StartDate = defaults.StartDate
+	}
+	if p.EndDate == "" {
+		p.EndDate = defaults.EndDate
+	}
+	return p
+}
+
+// validate returns an error if the fields of this profile are
+// malformed
+func (p Profile) validate() error {
+	err := p.RepoFilter.Validate()
+	if err != nil {
+		return err
+	}
+	_, _, err = p.DateRange()
+	return err
+}
+
+// DateRange returns the parsed start & end dates. Zero time is
+// returned for dates that are not set.
+func (p Profile) DateRange() (start time.Time, end time.Time, err error) {
+	if p.StartDate != "" {
+		start, err = gmetrics.ParseDate(p.StartDate)
+		if err != nil {
+			return start, end, errors.Wrapf(err, "Invalid start date")
+		}
+	}
+	if p.EndDate != "" {
+		end, err = gmetrics.ParseDate(p.EndDate)
+		if err != nil {
+			return start, end, errors.Wrapf(err, "Invalid end date")
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && start.After(end) {
+		return start, end, errors.Errorf(
+			"Invalid date range: Start %s is after end %s",
+			p.StartDate,
+			p.EndDate,
+		)
+	}
+	return start, end, nil
+}
+
+// Token returns the quay auth token of this profile. An empty token
+// is returned if the profile has no token source.
+func (p Profile) Token() (string, error) {
+	switch {
+	case p.AuthToken != "":
+		return p.AuthToken, nil
+	case p.AuthTokenEnv != "":
+		token := os.Getenv(p.AuthTokenEnv)
+		if token == "" {
+			return "", errors.Errorf(
+				"Missing quay auth token: Env %q is not set",
+				p.AuthTokenEnv,
+			)
+		}
+		return token, nil
+	case p.AuthTokenFile != "":
+		raw, err := ioutil.ReadFile(p.AuthTokenFile)
+		if err != nil {
+			return "", errors.Wrapf(
+				err,
+				"Failed to read quay auth token: File %q",
+				p.AuthTokenFile,
+			)
+		}
+		return strings.TrimSpace(string(raw)), nil
+	default:
+		return "", nil
+	}
+}
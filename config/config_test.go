@@ -0,0 +1,217 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/config"
+)
+
+func TestParse(t *testing.T) {
+	popularity, noPopularity := 5.0, 0.0
+	var tests = map[string]struct {
+		raw    string
+		isErr  bool
+		expect []config.Namespace
+	}{
+		"yaml with defaults": {
+			raw: `
+defaults:
+  quayURL: https://quay.example.com
+  authTokenEnv: QUAY_AUTH_TOKEN
+  exclude: ["*-ci"]
+  outputPath: ./logs
+namespaces:
+- name: openebs
+- name: litmuschaos
+  authTokenFile: /etc/quay/token
+  include: ["go-*"]
+  outputPath: ./litmus
+  startDate: 2020-08-01
+`,
+			expect: []config.Namespace{
+				{
+					Name: "openebs",
+					Profile: config.Profile{
+						QuayURL:      "https://quay.example.com",
+						AuthTokenEnv: "QUAY_AUTH_TOKEN",
+						RepoFilter:   gmetrics.RepoFilter{Exclude: []string{"*-ci"}},
+						OutputPath:   "./logs",
+					},
+				},
+				{
+					Name: "litmuschaos",
+					Profile: config.Profile{
+						QuayURL:       "https://quay.example.com",
+						AuthTokenFile: "/etc/quay/token",
+						RepoFilter: gmetrics.RepoFilter{
+							Include: []string{"go-*"},
+							Exclude: []string{"*-ci"},
+						},
+						OutputPath: "./litmus",
+						StartDate:  "2020-08-01",
+					},
+				},
+			},
+		},
+		"json": {
+			raw: `{"namespaces": [{"name": "openebs", "authToken": "token", "endDate": "Aug-13-2020"}]}`,
+			expect: []config.Namespace{
+				{
+					Name: "openebs",
+					Profile: config.Profile{
+						AuthToken: "token",
+						EndDate:   "Aug-13-2020",
+					},
+				},
+			},
+		},
+		"explicit zero min popularity": {
+			raw: `
+defaults:
+  minPopularity: 5
+namespaces:
+- name: openebs
+- name: litmuschaos
+  minPopularity: 0
+`,
+			expect: []config.Namespace{
+				{
+					Name: "openebs",
+					Profile: config.Profile{
+						RepoFilter: gmetrics.RepoFilter{MinPopularity: &popularity},
+					},
+				},
+				{
+					Name: "litmuschaos",
+					Profile: config.Profile{
+						RepoFilter: gmetrics.RepoFilter{MinPopularity: &noPopularity},
+					},
+				},
+			},
+		},
+		"missing name": {
+			raw:   "namespaces:\n- include: [jiva]\n",
+			isErr: true,
+		},
+		"duplicate name": {
+			raw:   "namespaces:\n- name: openebs\n- name: openebs\n",
+			isErr: true,
+		},
+		"unknown field": {
+			raw:   "namespaces:\n- name: openebs\n  colour: blue\n",
+			isErr: true,
+		},
+		"invalid pattern": {
+			raw:   "namespaces:\n- name: openebs\n  include: [\"[jiva\"]\n",
+			isErr: true,
+		},
+		"invalid date": {
+			raw:   "namespaces:\n- name: openebs\n  startDate: yesterday\n",
+			isErr: true,
+		},
+		"invalid date range": {
+			raw:   "namespaces:\n- name: openebs\n  startDate: 2020-08-13\n  endDate: 2020-08-06\n",
+			isErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := config.Parse([]byte(test.raw))
+			if test.isErr {
+				if err == nil {
+					t.Fatalf("Expected error got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if !reflect.DeepEqual(got.Namespaces, test.expect) {
+				t.Fatalf("Expected namespaces %+v got %+v", test.expect, got.Namespaces)
+			}
+		})
+	}
+}
+
+func TestProfileToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	err = ioutil.WriteFile(tokenFile, []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	os.Setenv("CONFIG_TEST_TOKEN", "from-env")
+	defer os.Unsetenv("CONFIG_TEST_TOKEN")
+
+	var tests = map[string]struct {
+		profile config.Profile
+		isErr   bool
+		expect  string
+	}{
+		"inline": {
+			profile: config.Profile{AuthToken: "inline"},
+			expect:  "inline",
+		},
+		"env": {
+			profile: config.Profile{AuthTokenEnv: "CONFIG_TEST_TOKEN"},
+			expect:  "from-env",
+		},
+		"unset env": {
+			profile: config.Profile{AuthTokenEnv: "CONFIG_TEST_UNSET_TOKEN"},
+			isErr:   true,
+		},
+		"file": {
+			profile: config.Profile{AuthTokenFile: tokenFile},
+			expect:  "from-file",
+		},
+		"missing file": {
+			profile: config.Profile{AuthTokenFile: filepath.Join(dir, "none")},
+			isErr:   true,
+		},
+		"no source": {
+			expect: "",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.profile.Token()
+			if test.isErr {
+				if err == nil {
+					t.Fatalf("Expected error got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if got != test.expect {
+				t.Fatalf("Expected token %q got %q", test.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParseDate parses the given date in either MonDDYYYYDateFormat
+// i.e. `Aug-06-2020` or ISODateFormat i.e. `2020-08-06`
+//
+// The returned time is the start of the day in UTC.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{MonDDYYYYDateFormat, ISODateFormat} {
+		t, err := time.ParseInLocation(layout, value, time.UTC)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf(
+		"Invalid date %q: Supported formats %q & %q",
+		value,
+		MonDDYYYYDateFormat,
+		ISODateFormat,
+	)
+}
+
+// ParseQuayTime parses the timestamps found in quay API responses
+// e.g. `Thu, 06 Aug 2020 09:13:10 -0000`
+func ParseQuayTime(value string) (time.Time, error) {
+	t, err := time.Parse(QuayTimeFormat, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(
+			err,
+			"Invalid quay time %q",
+			value,
+		)
+	}
+	return t.UTC(), nil
+}
+
+// truncateToDay returns the start of the day of the given time in UTC
+func truncateToDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,332 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mayadata.io/quay-logs/storage"
+	"github.com/pkg/errors"
+)
+
+// Fingerprint returns a stable identity of this log. Logs having the
+// same IP, kind, datetime, namespace, repo & tag are considered to
+// be the same event.
+func (l Log) Fingerprint() string {
+	datetime := l.Datetime
+	if t, err := l.Time(); err == nil {
+		// same instant may be formatted differently
+		datetime = t.Format(QuayTimeFormat)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(
+		[]string{
+			l.IP,
+			string(l.Kind),
+			datetime,
+			l.Metadata.Namespace,
+			l.Metadata.Repo,
+			l.Metadata.Tag,
+		},
+		"\x00",
+	)))
+	return hex.EncodeToString(sum[:])
+}
+
+// LogIndex is a set of log fingerprints. It is used to store each
+// log only once.
+//
+// LogIndex is safe for concurrent use.
+type LogIndex struct {
+	fingerprints map[string]struct{}
+	mu           sync.Mutex
+}
+
+// NewLogIndex returns a new empty instance of LogIndex
+func NewLogIndex() *LogIndex {
+	return &LogIndex{
+		fingerprints: map[string]struct{}{},
+	}
+}
+
+// Add adds the given log to this index. It returns false if the log
+// was already present.
+func (i *LogIndex) Add(entry Log) bool {
+	fingerprint := entry.Fingerprint()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, found := i.fingerprints[fingerprint]; found {
+		return false
+	}
+	i.fingerprints[fingerprint] = struct{}{}
+	return true
+}
+
+// Len returns the number of logs in this index
+func (i *LogIndex) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return len(i.fingerprints)
+}
+
+// logCounts counts logs by their fingerprints. Unlike LogIndex it
+// tells apart the events that share a fingerprint e.g. pulls of the
+// same second from IPs that were truncated or dropped.
+//
+// logCounts is safe for concurrent use.
+type logCounts struct {
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+// newLogCounts returns a logCounts of the given fingerprints
+func newLogCounts(fingerprints []string) *logCounts {
+	counts := &logCounts{
+		counts: map[string]int{},
+	}
+	for _, fingerprint := range fingerprints {
+		counts.counts[fingerprint]++
+	}
+	return counts
+}
+
+// loadLogCounts returns a logCounts of all the logs stored in the
+// given storage under the given prefix e.g. `namespace/name/`
+func loadLogCounts(store storage.Storage, prefix string) (*logCounts, error) {
+	counts := newLogCounts(nil)
+	keys, err := ListJSONKeys(store, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		got, err := ReadLogList(store, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range got.Items {
+			counts.counts[entry.Fingerprint()]++
+		}
+	}
+	return counts, nil
+}
+
+// take returns true if a log with the given fingerprint is counted.
+// The log is then uncounted so that it matches only once.
+func (c *logCounts) take(fingerprint string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts[fingerprint] == 0 {
+		return false
+	}
+	c.counts[fingerprint]--
+	return true
+}
+
+// ReadLogListFile reads the given json or ndjson file into a LogList
+func ReadLogListFile(filename string) (LogList, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return LogList{}, errors.Wrapf(
+			err,
+			"Failed to read logs file %s",
+			filename,
+		)
+	}
+	return unmarshalLogList(raw, filename)
+}
+
+// ReadLogList reads the file of the given key into a LogList
+func ReadLogList(store storage.Storage, key string) (LogList, error) {
+	raw, err := store.Get(key)
+	if err != nil {
+		return LogList{}, errors.Wrapf(
+			err,
+			"Failed to read logs file %s",
+			key,
+		)
+	}
+	return unmarshalLogList(raw, key)
+}
+
+// unmarshalLogList unmarshals the given content of the given file
+// in the format of the file's extension
+func unmarshalLogList(raw []byte, filename string) (LogList, error) {
+	format, _ := LogFileFormatOf(filename)
+	out, err := DecodeLogList(raw, format)
+	if err != nil {
+		return LogList{}, errors.Wrapf(
+			err,
+			"Failed to unmarshal logs file %s",
+			filename,
+		)
+	}
+	return out, nil
+}
+
+// DedupResult summarises the deduplication of a folder
+type DedupResult struct {
+	FileCount         int
+	RewrittenCount    int
+	RemovedCount      int
+	LogCount          int
+	DuplicateLogCount int
+}
+
+// Dedup removes duplicate logs from all the files of logs of the
+// given storage in place
+//
+// Files written by the same fetch of a repo i.e. the pages of a run
+// are considered together. Like fetch, logs are counted by their
+// fingerprints so that the distinct events of the same second whose
+// IPs were truncated or dropped are retained. Logs of a fingerprint
+// are retained in the run having most of these in the lexical order
+// of keys & are removed from the other runs. Files are rewritten
+// atomically & files left with no logs are removed.
+func Dedup(store storage.Storage, debug bool) (DedupResult, error) {
+	var result DedupResult
+	keys, err := ListJSONKeys(store, "")
+	if err != nil {
+		return result, err
+	}
+	runs := groupRunKeys(keys)
+	// retainers has the run that retains the logs of a fingerprint
+	retainers := map[string]runCount{}
+	for run, runKeys := range runs {
+		counts := map[string]int{}
+		for _, key := range runKeys {
+			got, err := ReadLogList(store, key)
+			if err != nil {
+				return result, err
+			}
+			for _, entry := range got.Items {
+				counts[entry.Fingerprint()]++
+			}
+		}
+		for fingerprint, count := range counts {
+			if count > retainers[fingerprint].count {
+				retainers[fingerprint] = runCount{run: run, count: count}
+			}
+		}
+	}
+	for run, runKeys := range runs {
+		for _, key := range runKeys {
+			err = dedupFile(store, key, &result, debug, func(entry Log) bool {
+				return retainers[entry.Fingerprint()].run != run
+			})
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// runCount is the number of logs of a fingerprint in a run
+type runCount struct {
+	run   int
+	count int
+}
+
+// dedupFile removes the logs of the file of the given key that are
+// duplicates as per the given function
+func dedupFile(
+	store storage.Storage,
+	key string,
+	result *DedupResult,
+	debug bool,
+	isDuplicate func(Log) bool,
+) error {
+	got, err := ReadLogList(store, key)
+	if err != nil {
+		return err
+	}
+	result.FileCount++
+	var unique []Log
+	for _, entry := range got.Items {
+		result.LogCount++
+		if isDuplicate(entry) {
+			result.DuplicateLogCount++
+			continue
+		}
+		unique = append(unique, entry)
+	}
+	if len(unique) == len(got.Items) {
+		return nil
+	}
+	if len(unique) == 0 {
+		err = store.Delete(key)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"Failed to remove duplicate logs file %s",
+				key,
+			)
+		}
+		result.RemovedCount++
+		if debug {
+			log.Printf("Removed duplicate logs file: %s", key)
+		}
+		return nil
+	}
+	got.Items = unique
+	err = WriteLogList(store, key, got)
+	if err != nil {
+		return err
+	}
+	result.RewrittenCount++
+	if debug {
+		log.Printf("Removed duplicate logs from file: %s", key)
+	}
+	return nil
+}
+
+// runKeyRegex matches the page index & extension of the keys of the
+// files of logs e.g. `-3.json` of `ns/name/Aug-13-2020-09:13:10-3.json`
+var runKeyRegex = regexp.MustCompile(`-[0-9]+\.[a-z.]+$`)
+
+// runOfKey returns the fetch run that wrote the file of the given
+// key. Pages of a run differ only by their index.
+func runOfKey(key string) string {
+	return runKeyRegex.ReplaceAllString(key, "")
+}
+
+// groupRunKeys groups the given keys by the fetch runs that wrote
+// them. Groups are in the order of their first keys.
+func groupRunKeys(keys []string) [][]string {
+	var groups [][]string
+	index := map[string]int{}
+	for _, key := range keys {
+		run := runOfKey(key)
+		i, found := index[run]
+		if !found {
+			i = len(groups)
+			index[run] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], key)
+	}
+	return groups
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"testing"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// putLogFiles stores the given logs per key
+func putLogFiles(t *testing.T, store storage.Storage, files map[string][]gmetrics.Log) {
+	for key, logs := range files {
+		err := gmetrics.WriteLogList(store, key, gmetrics.LogList{Items: logs})
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+	}
+}
+
+func TestDedupCountsLogsOfSameSecond(t *testing.T) {
+	// pulls of the same second from a network whose IPs were
+	// truncated look alike
+	pull := newPullLogs("openebs", "jiva", now, 1)[0]
+	pull.IP = "10.0.0.0"
+	store := storage.NewMemory()
+	putLogFiles(t, store, map[string][]gmetrics.Log{
+		// first run got 3 pulls split across its pages
+		"openebs/jiva/Aug-13-2020-09:13:10-0.json": {pull, pull},
+		"openebs/jiva/Aug-13-2020-09:13:10-1.json": {pull},
+		// overlapping run got the same 3 pulls
+		"openebs/jiva/Aug-13-2020-10:13:10-0.json": {pull, pull, pull},
+		// later run got a 4th pull of the same second
+		"openebs/jiva/Aug-13-2020-11:13:10-0.json": {pull, pull, pull, pull},
+	})
+
+	got, err := gmetrics.Dedup(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if got.FileCount != 4 || got.LogCount != 10 || got.DuplicateLogCount != 6 {
+		t.Fatalf("Expected 6 of 10 logs as duplicates got %+v", got)
+	}
+	// pulls are retained by the run having most of these
+	if got.RemovedCount != 3 || got.RewrittenCount != 0 {
+		t.Fatalf("Expected 3 removed files got %+v", got)
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(repos) != 1 || len(repos[0].Items) != 4 {
+		t.Fatalf("Expected 4 distinct pulls got %+v", repos)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	logs := newPullLogs("openebs", "jiva", now, 4)
+	var tests = map[string]struct {
+		files          map[string][]gmetrics.Log
+		expectLogs     int
+		expectDupes    int
+		expectRemoved  int
+		expectRewrites int
+	}{
+		"duplicate across files": {
+			files: map[string][]gmetrics.Log{
+				"openebs/jiva/Aug-13-2020-09:13:10-0.json": {logs[0], logs[1]},
+				"openebs/jiva/Aug-13-2020-10:13:10-0.json": {logs[1], logs[2]},
+			},
+			expectLogs:     3,
+			expectDupes:    1,
+			expectRewrites: 1,
+		},
+		// logs of a file are distinct events even if these look
+		// alike; only the copies of these in other runs are removed
+		"duplicate within a file": {
+			files: map[string][]gmetrics.Log{
+				"openebs/jiva/Aug-13-2020-09:13:10-0.json": {logs[0], logs[0], logs[1]},
+				"openebs/jiva/Aug-13-2020-10:13:10-0.json": {logs[0], logs[0], logs[0], logs[2]},
+			},
+			expectLogs:     5,
+			expectDupes:    2,
+			expectRewrites: 1,
+		},
+		"file left with no logs": {
+			files: map[string][]gmetrics.Log{
+				"openebs/jiva/Aug-13-2020-09:13:10-0.json": {logs[0], logs[1], logs[2]},
+				"openebs/jiva/Aug-13-2020-10:13:10-0.json": {logs[2], logs[0]},
+				"openebs/jiva/Aug-13-2020-10:13:10-1.json": {logs[3]},
+			},
+			expectLogs:    4,
+			expectDupes:   2,
+			expectRemoved: 1,
+		},
+		"no duplicates": {
+			files: map[string][]gmetrics.Log{
+				"openebs/jiva/Aug-13-2020-09:13:10-0.json": {logs[0], logs[1]},
+				"openebs/jiva/Aug-13-2020-09:13:10-1.json": {logs[2], logs[3]},
+			},
+			expectLogs: 4,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			store := storage.NewMemory()
+			putLogFiles(t, store, mock.files)
+			got, err := gmetrics.Dedup(store, false)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if got.FileCount != len(mock.files) ||
+				got.DuplicateLogCount != mock.expectDupes ||
+				got.RemovedCount != mock.expectRemoved ||
+				got.RewrittenCount != mock.expectRewrites {
+				t.Fatalf(
+					"Expected %d duplicates, %d removed & %d rewritten files got %+v",
+					mock.expectDupes,
+					mock.expectRemoved,
+					mock.expectRewrites,
+					got,
+				)
+			}
+			keys, err := gmetrics.ListJSONKeys(store, "")
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if len(keys) != len(mock.files)-mock.expectRemoved {
+				t.Fatalf("Expected %d files left got %q", len(mock.files)-mock.expectRemoved, keys)
+			}
+			repos, err := gmetrics.ReadRepoLogs(store, false)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if len(repos) != 1 || len(repos[0].Items) != mock.expectLogs {
+				t.Fatalf("Expected %d logs got %+v", mock.expectLogs, repos)
+			}
+
+			// dedup again finds no duplicates
+			again, err := gmetrics.Dedup(store, false)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if again.DuplicateLogCount != 0 {
+				t.Fatalf("Expected no duplicates got %+v", again)
+			}
+		})
+	}
+}
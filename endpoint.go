@@ -0,0 +1,50 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"strings"
+)
+
+const (
+	// DefaultQuayURL is the quay instance used when no base URL
+	// is configured
+	DefaultQuayURL string = "https://quay.io"
+
+	// QuayAPIVersion is the version of quay API this package
+	// is coded against
+	QuayAPIVersion string = "v1"
+)
+
+// QuayAPIURL returns the absolute URL of the given quay API
+// resource e.g. `repository/{namespace}/{name}/logs`
+//
+// The base URL may be provided with or without the API path i.e.
+// `https://quay.example.com`, `https://quay.example.com/api` &
+// `https://quay.example.com/api/v1/` all result in the same URL.
+// An empty base URL defaults to DefaultQuayURL.
+func QuayAPIURL(baseURL string, resource string) string {
+	base := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if base == "" {
+		base = DefaultQuayURL
+	}
+	// strip the API path if any since it gets added below
+	base = strings.TrimSuffix(base, "/api/"+QuayAPIVersion)
+	base = strings.TrimSuffix(base, "/api")
+
+	return base + "/api/" + QuayAPIVersion + "/" + strings.TrimLeft(resource, "/")
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gopkg.in/resty.v1"
+)
+
+// QuayErrorBody is the error returned by quay APIs in the response
+// body e.g.
+//
+//	{
+//	  "status": 403,
+//	  "error_message": "Unauthorized",
+//	  "title": "insufficient_scope",
+//	  "error_type": "insufficient_scope",
+//	  "detail": "Unauthorized",
+//	  "type": "https://quay.io/api/v1/error/insufficient_scope"
+//	}
+type QuayErrorBody struct {
+	Status       int    `json:"status,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	Title        string `json:"title,omitempty"`
+	ErrorType    string `json:"error_type,omitempty"`
+	Detail       string `json:"detail,omitempty"`
+	Type         string `json:"type,omitempty"`
+}
+
+// APIError is returned when quay responds with a status code other
+// than 2xx
+//
+// Specific status codes result in one of UnauthorizedError,
+// ForbiddenError, NotFoundError, RateLimitedError or ServerError.
+// All of these unwrap to APIError. Callers can branch on these via
+// errors.As.
+type APIError struct {
+	StatusCode int
+	URL        string
+	Body       QuayErrorBody
+	// RawBody is the response body if it could not be decoded
+	RawBody string
+}
+
+// Error implements error interface
+func (e *APIError) Error() string {
+	msg := e.Body.ErrorMessage
+	if msg == "" {
+		msg = e.Body.Detail
+	}
+	if msg == "" {
+		msg = e.RawBody
+	}
+	if e.Body.ErrorType != "" {
+		msg = fmt.Sprintf("%s: %s", e.Body.ErrorType, msg)
+	}
+	return fmt.Sprintf(
+		"Quay API error: URL %q: StatusCode %d: %s",
+		e.URL,
+		e.StatusCode,
+		msg,
+	)
+}
+
+// UnauthorizedError is returned for 401 responses i.e. the auth
+// token is missing or invalid
+type UnauthorizedError struct {
+	*APIError
+}
+
+// Unwrap returns the underlying APIError
+func (e *UnauthorizedError) Unwrap() error {
+	return e.APIError
+}
+
+// ForbiddenError is returned for 403 responses e.g. the auth token
+// does not have the required scope
+type ForbiddenError struct {
+	*APIError
+}
+
+// Unwrap returns the underlying APIError
+func (e *ForbiddenError) Unwrap() error {
+	return e.APIError
+}
+
+// NotFoundError is returned for 404 responses e.g. the repo does
+// not exist anymore
+type NotFoundError struct {
+	*APIError
+}
+
+// Unwrap returns the underlying APIError
+func (e *NotFoundError) Unwrap() error {
+	return e.APIError
+}
+
+// RateLimitedError is returned for 429 responses that persist
+// after all the retries
+type RateLimitedError struct {
+	*APIError
+	// RetryAfter is the delay requested by quay if any
+	RetryAfter time.Duration
+}
+
+// Unwrap returns the underlying APIError
+func (e *RateLimitedError) Unwrap() error {
+	return e.APIError
+}
+
+// ServerError is returned for 5xx responses that persist after all
+// the retries
+type ServerError struct {
+	*APIError
+}
+
+// Unwrap returns the underlying APIError
+func (e *ServerError) Unwrap() error {
+	return e.APIError
+}
+
+// checkResponse returns a typed error if the given response is not
+// successful
+func checkResponse(resp *resty.Response) error {
+	if resp.StatusCode() >= 200 && resp.StatusCode() < 300 {
+		return nil
+	}
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode(),
+	}
+	if resp.Request != nil && resp.Request.RawRequest != nil {
+		apiErr.URL = resp.Request.RawRequest.URL.String()
+	}
+	err := json.Unmarshal(resp.Body(), &apiErr.Body)
+	if err != nil || apiErr.Body == (QuayErrorBody{}) {
+		apiErr.RawBody = string(resp.Body())
+		if apiErr.RawBody == "" {
+			// older quay versions send the error as a header
+			apiErr.RawBody = resp.Header().Get("error")
+		}
+	}
+
+	switch {
+	case resp.StatusCode() == http.StatusUnauthorized:
+		return &UnauthorizedError{apiErr}
+	case resp.StatusCode() == http.StatusForbidden:
+		return &ForbiddenError{apiErr}
+	case resp.StatusCode() == http.StatusNotFound:
+		return &NotFoundError{apiErr}
+	case resp.StatusCode() == http.StatusTooManyRequests:
+		after, _ := retryAfter(resp.Header(), time.Now())
+		return &RateLimitedError{APIError: apiErr, RetryAfter: after}
+	case resp.StatusCode() >= 500:
+		return &ServerError{apiErr}
+	default:
+		return apiErr
+	}
+}
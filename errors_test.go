@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+)
+
+func TestAPIErrors(t *testing.T) {
+	var tests = map[string]struct {
+		failure       quaytest.Failure
+		check         func(error) bool
+		expectMessage string
+	}{
+		"unauthorized": {
+			failure: quaytest.Failure{StatusCode: http.StatusUnauthorized},
+			check: func(err error) bool {
+				var target *gmetrics.UnauthorizedError
+				return errors.As(err, &target)
+			},
+			expectMessage: "StatusCode 401: injected_failure: Unauthorized",
+		},
+		"not found": {
+			failure: quaytest.Failure{StatusCode: http.StatusNotFound},
+			check: func(err error) bool {
+				var target *gmetrics.NotFoundError
+				return errors.As(err, &target) && target.StatusCode == http.StatusNotFound
+			},
+			expectMessage: "StatusCode 404",
+		},
+		"rate limited after retries": {
+			failure: quaytest.Failure{
+				StatusCode: http.StatusTooManyRequests,
+				Headers:    map[string]string{"Retry-After": "2"},
+				Times:      -1,
+			},
+			check: func(err error) bool {
+				var target *gmetrics.RateLimitedError
+				return errors.As(err, &target) && target.RetryAfter == 2*time.Second
+			},
+			expectMessage: "StatusCode 429",
+		},
+		"other status unwraps to api error": {
+			failure: quaytest.Failure{
+				StatusCode: http.StatusBadRequest,
+				Body:       "bad request",
+			},
+			check: func(err error) bool {
+				var target *gmetrics.APIError
+				var notFound *gmetrics.NotFoundError
+				return errors.As(err, &target) &&
+					!errors.As(err, &notFound) &&
+					target.RawBody == "bad request"
+			},
+			expectMessage: "StatusCode 400: bad request",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			server := newLogsServer(1)
+			defer server.Close()
+			server.Fail(mock.failure)
+
+			logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+				QuayURL:   server.URL,
+				Namespace: "openebs",
+				Name:      "jiva",
+			})
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			_, err = logger.Log()
+			if !mock.check(err) {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !strings.Contains(err.Error(), mock.expectMessage) {
+				t.Fatalf("Expected message %q got %q", mock.expectMessage, err.Error())
+			}
+		})
+	}
+}
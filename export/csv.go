@@ -0,0 +1,304 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package export flattens quay logs & popularity of repos into CSV.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yukithm/json2csv"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// UnknownColumnError is returned when a column to write is not a
+// field of the records
+type UnknownColumnError struct {
+	Column string
+}
+
+// Error implements error interface
+func (e *UnknownColumnError) Error() string {
+	return fmt.Sprintf("Unknown column %q", e.Column)
+}
+
+var (
+	// logColumns are the columns of logs
+	logColumns = columnsOf(reflect.TypeOf(gmetrics.Log{}))
+
+	// popularColumns are the columns of repos
+	popularColumns = columnsOf(reflect.TypeOf(gmetrics.Popular{}))
+)
+
+// ValidateLogColumns returns UnknownColumnError if any of the given
+// columns is not a column of logs
+func ValidateLogColumns(columns []string) error {
+	return validateColumns(columns, logColumns)
+}
+
+// ValidatePopularColumns returns UnknownColumnError if any of the
+// given columns is not a column of repos
+func ValidatePopularColumns(columns []string) error {
+	return validateColumns(columns, popularColumns)
+}
+
+// WriteLogsCSV writes the given logs as CSV
+//
+// Nested fields are flattened into columns named in dot notation
+// e.g. `metadata.resolved_ip.country_iso_code`. Only the given
+// columns are written in the given order if any; otherwise all
+// columns are written in the lexical order.
+func WriteLogsCSV(w io.Writer, logs []gmetrics.Log, columns []string) error {
+	if logs == nil {
+		logs = []gmetrics.Log{}
+	}
+	return writeCSV(w, logs, columns, logColumns)
+}
+
+// WritePopularCSV writes the given repos with their popularity
+// as CSV
+//
+// Only the given columns are written in the given order if any;
+// otherwise all columns are written in the lexical order.
+func WritePopularCSV(w io.Writer, items []gmetrics.Popular, columns []string) error {
+	if items == nil {
+		items = []gmetrics.Popular{}
+	}
+	return writeCSV(w, items, columns, popularColumns)
+}
+
+// WriteRepoLogsCSVFiles writes the logs of every repo to its own
+// CSV file i.e. `<folder>/<namespace>/<repo>.csv`
+//
+// Logs stored outside of a repo folder i.e. not at
+// `<namespace>/<repo>/` are skipped.
+func WriteRepoLogsCSVFiles(folder string, repos []gmetrics.RepoLogs, columns []string) error {
+	err := ValidateLogColumns(columns)
+	if err != nil {
+		return err
+	}
+	for _, repo := range repos {
+		if repo.Namespace == "" || repo.Name == "" {
+			log.Printf(
+				"Skipped logs outside of a repo folder: Logs %d",
+				len(repo.Items),
+			)
+			continue
+		}
+		dir := filepath.Join(folder, repo.Namespace)
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"Failed to create export folder %s",
+				dir,
+			)
+		}
+		filename := filepath.Join(dir, repo.Name+".csv")
+		err = writeCSVFile(filename, func(w io.Writer) error {
+			return WriteLogsCSV(w, repo.Items, columns)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSVFile creates the given file & writes CSV to it using the
+// given writer function
+func writeCSVFile(filename string, write func(io.Writer) error) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to create CSV file %s",
+			filename,
+		)
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to write CSV file %s",
+			filename,
+		)
+	}
+	return nil
+}
+
+// writeCSV flattens the given records via their JSON representation
+// & writes them as CSV
+//
+// Known are the columns of the records. Columns are written in the
+// given order if any.
+func writeCSV(w io.Writer, records interface{}, columns []string, known map[string]bool) error {
+	err := validateColumns(columns, known)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(records)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal records")
+	}
+	var data []interface{}
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal records")
+	}
+	rows, err := json2csv.JSON2CSV(data)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to flatten records")
+	}
+	if len(columns) == 0 {
+		out := json2csv.NewCSVWriter(w)
+		out.HeaderStyle = json2csv.DotNotationStyle
+		err = out.WriteCSV(rows)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to write CSV")
+		}
+		return nil
+	}
+
+	// NOTE:
+	//	json2csv sorts the columns. Hence the selected columns are
+	// written here to retain their order.
+	out := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = strings.TrimSpace(column)
+	}
+	err = out.Write(header)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write CSV")
+	}
+	for _, row := range rows {
+		err = out.Write(selectColumns(row, header))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to write CSV")
+		}
+	}
+	out.Flush()
+	err = out.Error()
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write CSV")
+	}
+	return nil
+}
+
+// selectColumns returns the values of the given columns of the given
+// row. Columns that the row does not have are empty.
+func selectColumns(row json2csv.KeyValue, columns []string) []string {
+	out := make([]string, len(columns))
+	for i, column := range columns {
+		// rows are keyed by JSON pointer e.g. /metadata/repo
+		key := "/" + strings.Replace(column, ".", "/", -1)
+		if value, found := row[key]; found && value != nil {
+			out[i] = fmt.Sprintf("%v", value)
+		}
+	}
+	return out
+}
+
+// validateColumns returns UnknownColumnError if any of the given
+// columns is not known
+//
+// Items of a list are known by their index e.g. `metadata.tags.0`.
+func validateColumns(columns []string, known map[string]bool) error {
+	for _, column := range columns {
+		column = strings.TrimSpace(column)
+		parts := strings.Split(column, ".")
+		for i, part := range parts {
+			if isIndex(part) {
+				parts[i] = listItem
+			}
+		}
+		if !known[strings.Join(parts, ".")] {
+			return &UnknownColumnError{Column: column}
+		}
+	}
+	return nil
+}
+
+// isIndex returns true if the given value is an index of a list
+func isIndex(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// listItem stands for the index of an item of a list in the known
+// columns
+const listItem string = "*"
+
+// columnsOf returns the columns of the given type of records i.e.
+// the JSON names of its fields in dot notation. Nested fields are
+// flattened.
+func columnsOf(t reflect.Type) map[string]bool {
+	out := map[string]bool{}
+	addColumns(out, t, "")
+	return out
+}
+
+// addColumns adds the columns of the given type prefixed by the given
+// prefix to the given columns
+func addColumns(columns map[string]bool, t reflect.Type, prefix string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		addColumns(columns, t.Elem(), prefix+"."+listItem)
+		return
+	}
+	if t.Kind() != reflect.Struct {
+		columns[prefix] = true
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "-" {
+			// unexported or not marshaled
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		addColumns(columns, field.Type, name)
+	}
+}
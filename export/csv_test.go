@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/export"
+	"github.com/mayadata.io/quay-logs/quaytest"
+)
+
+// newEnrichedLog returns a pull log of the given repo that is
+// enriched with the given country
+func newEnrichedLog(repo string, country string) gmetrics.Log {
+	entry := quaytest.NewLog(quaytest.LogConfig{
+		Repo:    repo,
+		Tag:     "latest",
+		IP:      "10.0.0.1",
+		Country: "US",
+		Time:    time.Date(2020, 8, 13, 9, 13, 10, 0, time.UTC),
+	})
+	entry.Metadata.Tags = []string{"latest", "2.0.0"}
+	entry.Geo = &gmetrics.Geo{
+		CountryISOCode: country,
+		City:           "Berlin",
+		ASN:            3320,
+	}
+	return entry
+}
+
+func TestWriteLogsCSV(t *testing.T) {
+	var tests = map[string]struct {
+		columns []string
+		expect  string
+	}{
+		"columns in the given order": {
+			columns: []string{"kind", "datetime", "ip"},
+			expect: "kind,datetime,ip\n" +
+				"pull_repo,\"Thu, 13 Aug 2020 09:13:10 +0000\",10.0.0.1\n",
+		},
+		"nested columns": {
+			columns: []string{"metadata.repo", "metadata.resolved_ip.country_iso_code", "metadata.tags.1"},
+			expect:  "metadata.repo,metadata.resolved_ip.country_iso_code,metadata.tags.1\njiva,US,2.0.0\n",
+		},
+		"geo columns": {
+			columns: []string{"geo.country_iso_code", "geo.city", "geo.asn", "geo.organization"},
+			expect:  "geo.country_iso_code,geo.city,geo.asn,geo.organization\nDE,Berlin,3320,\n",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := export.WriteLogsCSV(&buf, []gmetrics.Log{newEnrichedLog("jiva", "DE")}, mock.columns)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if buf.String() != mock.expect {
+				t.Fatalf("Expected %q got %q", mock.expect, buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteLogsCSVAllColumns(t *testing.T) {
+	var buf bytes.Buffer
+	err := export.WriteLogsCSV(&buf, []gmetrics.Log{newEnrichedLog("jiva", "DE")}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	header := bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0]
+	for _, column := range []string{"datetime", "geo.asn", "metadata.resolved_ip.country_iso_code"} {
+		if !bytes.Contains(header, []byte(column)) {
+			t.Fatalf("Expected column %q got %s", column, header)
+		}
+	}
+}
+
+func TestWriteCSVUnknownColumn(t *testing.T) {
+	var unknown *export.UnknownColumnError
+	err := export.WriteLogsCSV(ioutil.Discard, nil, []string{"datetime", "metadata.repository"})
+	if !errors.As(err, &unknown) || unknown.Column != "metadata.repository" {
+		t.Fatalf("Expected unknown column error got %v", err)
+	}
+	err = export.WritePopularCSV(ioutil.Discard, nil, []string{"name", "kind", "stars"})
+	if !errors.As(err, &unknown) || unknown.Column != "stars" {
+		t.Fatalf("Expected unknown column error got %v", err)
+	}
+	err = export.WritePopularCSV(ioutil.Discard, nil, []string{"name", "popularity"})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+}
+
+func TestWriteRepoLogsCSVFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export-test")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = export.WriteRepoLogsCSVFiles(dir, []gmetrics.RepoLogs{
+		{Namespace: "openebs", Name: "jiva", Items: []gmetrics.Log{newEnrichedLog("jiva", "DE")}},
+		// logs outside of a repo folder
+		{Items: []gmetrics.Log{newEnrichedLog("cstor", "IN")}},
+	}, []string{"metadata.repo", "geo.country_iso_code"})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "openebs", "jiva.csv"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if string(raw) != "metadata.repo,geo.country_iso_code\njiva,DE\n" {
+		t.Fatalf("Expected logs of jiva got %q", raw)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected only the openebs folder got %v", files)
+	}
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package exporter exposes quay logs & popularity of repos as
+// prometheus metrics.
+package exporter
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// metricNamespace prefixes the names of all the metrics
+const metricNamespace string = "quay"
+
+// unknownLabel is the label value used when a log lacks the
+// corresponding property e.g. a log without a country
+const unknownLabel string = "unknown"
+
+// Config is used to initialise an Exporter instance
+type Config struct {
+	QuayURL   string
+	Namespace string
+	AuthToken string
+	// Interval is the duration between two refreshes
+	Interval time.Duration
+	Debug    bool
+	// AllowPartialList when set to true refreshes the repos listed
+	// even if quay may have truncated the repo list. The refresh
+	// fails otherwise.
+	AllowPartialList bool
+}
+
+// Exporter periodically fetches repos & their logs from quay &
+// exposes them as prometheus metrics
+type Exporter struct {
+	Config
+
+	registry    *prometheus.Registry
+	pulls       *prometheus.CounterVec
+	logs        *prometheus.CounterVec
+	popularity  *prometheus.GaugeVec
+	apiErrors   *prometheus.CounterVec
+	lastSuccess prometheus.Gauge
+	duration    prometheus.Gauge
+
+	// highWaterMarks has the newest logs counted per repo. Logs are
+	// counted only once across refreshes.
+	highWaterMarks map[string]highWaterMark
+}
+
+// highWaterMark has the datetime of the newest log counted for a
+// repo & the fingerprints of the logs counted at that second
+type highWaterMark struct {
+	since time.Time
+	seen  []string
+}
+
+// New returns a new instance of Exporter
+func New(config Config) (*Exporter, error) {
+	if config.Namespace == "" {
+		return nil, errors.Errorf("Missing quay namespace")
+	}
+	if config.Interval <= 0 {
+		return nil, errors.Errorf(
+			"Invalid refresh interval %s: Must be greater than 0",
+			config.Interval,
+		)
+	}
+	e := &Exporter{
+		Config:   config,
+		registry: prometheus.NewRegistry(),
+		pulls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricNamespace,
+				Name:      "repo_pulls_total",
+				Help:      "Number of pulls of a repo by tag & country",
+			},
+			[]string{"namespace", "repo", "tag", "country"},
+		),
+		logs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricNamespace,
+				Name:      "repo_logs_total",
+				Help:      "Number of logs of a repo by kind",
+			},
+			[]string{"namespace", "repo", "kind"},
+		),
+		popularity: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: metricNamespace,
+				Name:      "repo_popularity",
+				Help:      "Popularity score of a repo as ranked by quay",
+			},
+			[]string{"namespace", "repo"},
+		),
+		apiErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricNamespace,
+				Subsystem: "collector",
+				Name:      "api_errors_total",
+				Help:      "Number of failed quay API operations by status code",
+			},
+			[]string{"operation", "status"},
+		),
+		lastSuccess: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: metricNamespace,
+				Subsystem: "collector",
+				Name:      "last_success_timestamp_seconds",
+				Help:      "Unix time of the last refresh that fetched all repos successfully",
+			},
+		),
+		duration: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: metricNamespace,
+				Subsystem: "collector",
+				Name:      "last_refresh_duration_seconds",
+				Help:      "Duration of the last refresh",
+			},
+		),
+		highWaterMarks: map[string]highWaterMark{},
+	}
+	e.registry.MustRegister(
+		e.pulls,
+		e.logs,
+		e.popularity,
+		e.apiErrors,
+		e.lastSuccess,
+		e.duration,
+	)
+	return e, nil
+}
+
+// Handler returns the http handler that serves the metrics
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// Run refreshes the metrics at every interval till the given
+// context is cancelled. The first refresh happens immediately.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		err := e.Refresh()
+		if err != nil {
+			log.Printf("Failed to refresh metrics: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh lists the repos of the namespace & counts the logs of
+// each repo that are newer than the ones counted earlier
+//
+// A failure to fetch logs of a repo does not stop the logs of other
+// repos from being counted.
+func (e *Exporter) Refresh() error {
+	started := time.Now()
+	defer func() {
+		e.duration.Set(time.Since(started).Seconds())
+	}()
+
+	l, err := gmetrics.NewLister(gmetrics.ListableConfig{
+		QuayURL:          e.QuayURL,
+		Namespace:        e.Namespace,
+		AuthToken:        e.AuthToken,
+		Debug:            e.Debug,
+		AllowPartialList: e.AllowPartialList,
+	})
+	if err != nil {
+		return err
+	}
+	repolist, err := l.ListReposAndWriteToFileOptionally()
+	if err != nil {
+		e.apiErrors.WithLabelValues("list", errorStatus(err)).Inc()
+		return errors.Wrapf(
+			err,
+			"Failed to list repos: Namespace %q",
+			e.Namespace,
+		)
+	}
+	// gauges of the repos that were removed since the previous
+	// refresh are dropped
+	e.popularity.Reset()
+	for _, repo := range repolist.Items {
+		e.popularity.WithLabelValues(e.Namespace, repo.Name).Set(repo.Popularity)
+	}
+
+	var failedCount int
+	for _, repo := range repolist.Items {
+		err = e.refreshRepo(repo.Name)
+		if err != nil {
+			failedCount++
+			e.apiErrors.WithLabelValues("logs", errorStatus(err)).Inc()
+			log.Printf("Failed to refresh repo logs: %v", err)
+		}
+	}
+	if failedCount > 0 {
+		return errors.Errorf(
+			"Failed to refresh logs of %d of %d repos: Namespace %q",
+			failedCount,
+			len(repolist.Items),
+			e.Namespace,
+		)
+	}
+	e.lastSuccess.SetToCurrentTime()
+	if e.Debug {
+		log.Printf(
+			"Refreshed metrics: Namespace %q: Repos %d: Took %s",
+			e.Namespace,
+			len(repolist.Items),
+			time.Since(started),
+		)
+	}
+	return nil
+}
+
+// refreshRepo counts the new logs of the given repo
+func (e *Exporter) refreshRepo(name string) error {
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:   e.QuayURL,
+		Namespace: e.Namespace,
+		Name:      name,
+		AuthToken: e.AuthToken,
+		Debug:     e.Debug,
+		Since:     e.highWaterMarks[name].since,
+		Seen:      e.highWaterMarks[name].seen,
+	})
+	if err != nil {
+		return err
+	}
+	got, err := logger.Log()
+	if err != nil {
+		return err
+	}
+	for _, entry := range got.Items {
+		e.logs.WithLabelValues(e.Namespace, name, orUnknown(string(entry.Kind))).Inc()
+		if entry.Kind != gmetrics.KindPullRepo {
+			continue
+		}
+		e.pulls.WithLabelValues(
+			e.Namespace,
+			name,
+			orUnknown(entry.Metadata.Tag),
+			orUnknown(entry.Country()),
+		).Inc()
+	}
+	// NOTE:
+	//	Logs at the high water mark are not counted again while the
+	// other logs of that second are
+	newest, seen := logger.Newest()
+	if !newest.IsZero() && !newest.Before(e.highWaterMarks[name].since) {
+		e.highWaterMarks[name] = highWaterMark{since: newest, seen: seen}
+	}
+	return nil
+}
+
+// errorStatus returns the http status code of the given quay API
+// error. Errors without a status code e.g. network errors result in
+// "error".
+func errorStatus(err error) string {
+	var apiErr *gmetrics.APIError
+	if errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.StatusCode)
+	}
+	return "error"
+}
+
+// orUnknown returns unknownLabel if the given value is empty
+func orUnknown(value string) string {
+	if value == "" {
+		return unknownLabel
+	}
+	return value
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/exporter"
+	"github.com/mayadata.io/quay-logs/quaytest"
+)
+
+// now is the time of the fake clock used by these tests
+var now = time.Date(2020, 8, 13, 9, 13, 10, 0, time.UTC)
+
+// newExporter returns a fake quay server with the repos jiva & cstor
+// & an exporter of its openebs namespace
+func newExporter(t *testing.T) (*quaytest.Server, *exporter.Exporter) {
+	server := quaytest.NewServer(quaytest.ServerConfig{
+		Clock: quaytest.NewClock(now),
+	})
+	server.AddRepo(
+		"openebs",
+		gmetrics.Popular{Name: "jiva", Popularity: 10},
+		quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", IP: "10.0.0.1", Country: "US", Time: now.Add(-time.Hour)}),
+		quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", IP: "10.0.0.2", Country: "US", Time: now.Add(-2 * time.Hour)}),
+		quaytest.NewLog(quaytest.LogConfig{Kind: gmetrics.KindPushRepo, Repo: "jiva", Tag: "latest", IP: "10.0.0.3", Country: "US", Time: now.Add(-3 * time.Hour)}),
+	)
+	server.AddRepo(
+		"openebs",
+		gmetrics.Popular{Name: "cstor", Popularity: 5},
+		quaytest.NewLog(quaytest.LogConfig{Repo: "cstor", Tag: "latest", IP: "10.0.0.1", Country: "US", Time: now.Add(-time.Hour)}),
+	)
+	e, err := exporter.New(exporter.Config{
+		QuayURL:   server.URL,
+		Namespace: "openebs",
+		Interval:  time.Minute,
+	})
+	if err != nil {
+		server.Close()
+		t.Fatalf("Expected no error got %v", err)
+	}
+	return server, e
+}
+
+// scrape returns the metrics served by the given exporter
+func scrape(t *testing.T, e *exporter.Exporter) string {
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d got %d", http.StatusOK, w.Code)
+	}
+	return w.Body.String()
+}
+
+// expectMetric fails the test if the given metrics do not have the
+// given sample
+func expectMetric(t *testing.T, metrics string, sample string) {
+	t.Helper()
+	if !strings.Contains(metrics, sample+"\n") {
+		t.Fatalf("Expected sample %q got\n%s", sample, metrics)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	var tests = map[string]struct {
+		config exporter.Config
+	}{
+		"missing namespace": {
+			config: exporter.Config{Interval: time.Minute},
+		},
+		"zero interval": {
+			config: exporter.Config{Namespace: "openebs"},
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			_, err := exporter.New(mock.config)
+			if err == nil {
+				t.Fatalf("Expected error got none")
+			}
+		})
+	}
+}
+
+func TestRefreshCountsLogsOnce(t *testing.T) {
+	server, e := newExporter(t)
+	defer server.Close()
+
+	for run := 0; run < 2; run++ {
+		err := e.Refresh()
+		if err != nil {
+			t.Fatalf("Run %d: Expected no error got %v", run, err)
+		}
+		metrics := scrape(t, e)
+		expectMetric(t, metrics, `quay_repo_pulls_total{country="US",namespace="openebs",repo="jiva",tag="latest"} 2`)
+		expectMetric(t, metrics, `quay_repo_logs_total{kind="push_repo",namespace="openebs",repo="jiva"} 1`)
+		expectMetric(t, metrics, `quay_repo_popularity{namespace="openebs",repo="jiva"} 10`)
+	}
+
+	// another pull of the second of the newest counted pull
+	server.AddLogs("openebs", "jiva", quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", IP: "10.0.0.9", Country: "US", Time: now.Add(-time.Hour)}))
+	err := e.Refresh()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	expectMetric(t, scrape(t, e), `quay_repo_pulls_total{country="US",namespace="openebs",repo="jiva",tag="latest"} 3`)
+}
+
+func TestRefreshDropsRemovedRepos(t *testing.T) {
+	server, e := newExporter(t)
+	defer server.Close()
+
+	err := e.Refresh()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	expectMetric(t, scrape(t, e), `quay_repo_popularity{namespace="openebs",repo="cstor"} 5`)
+
+	server.RemoveRepo("openebs", "cstor")
+	err = e.Refresh()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	metrics := scrape(t, e)
+	if strings.Contains(metrics, `quay_repo_popularity{namespace="openebs",repo="cstor"}`) {
+		t.Fatalf("Expected no popularity of removed repo got\n%s", metrics)
+	}
+	expectMetric(t, metrics, `quay_repo_popularity{namespace="openebs",repo="jiva"} 10`)
+}
+
+func TestRefreshPartialRepoList(t *testing.T) {
+	server := quaytest.NewServer(quaytest.ServerConfig{
+		Clock:                 quaytest.NewClock(now),
+		DisableRepoPagination: true,
+	})
+	defer server.Close()
+	// quay serves only the first page of these repos
+	for i := 0; i < gmetrics.RepositoryPageSize+50; i++ {
+		server.AddRepo("openebs", gmetrics.Popular{
+			Name:       fmt.Sprintf("repo-%03d", i),
+			Popularity: float64(i),
+		})
+	}
+
+	for _, isAllowed := range []bool{false, true} {
+		e, err := exporter.New(exporter.Config{
+			QuayURL:          server.URL,
+			Namespace:        "openebs",
+			Interval:         time.Minute,
+			AllowPartialList: isAllowed,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		err = e.Refresh()
+		if !isAllowed {
+			if !errors.Is(err, gmetrics.ErrPartialRepoList) {
+				t.Fatalf("Expected partial repo list error got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected no error of allowed partial list got %v", err)
+		}
+		got := strings.Count(scrape(t, e), "quay_repo_popularity{")
+		if got != gmetrics.RepositoryPageSize {
+			t.Fatalf("Expected popularity of %d repos got %d", gmetrics.RepositoryPageSize, got)
+		}
+	}
+}
+
+func TestRefreshCountsAPIErrors(t *testing.T) {
+	server, e := newExporter(t)
+	defer server.Close()
+	server.Fail(quaytest.Failure{
+		Path:       "/cstor/logs",
+		StatusCode: http.StatusNotFound,
+		Times:      -1,
+	})
+
+	err := e.Refresh()
+	if err == nil {
+		t.Fatalf("Expected error got none")
+	}
+	metrics := scrape(t, e)
+	expectMetric(t, metrics, fmt.Sprintf(`quay_collector_api_errors_total{operation="logs",status="%d"} 1`, http.StatusNotFound))
+	// logs of other repos are counted
+	expectMetric(t, metrics, `quay_repo_pulls_total{country="US",namespace="openebs",repo="jiva",tag="latest"} 2`)
+	if strings.Contains(metrics, "quay_collector_last_success_timestamp_seconds 1") {
+		t.Fatalf("Expected no successful refresh got\n%s", metrics)
+	}
+}
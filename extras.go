@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extras has the JSON fields that are not modelled by a type. These
+// are kept as is so that nothing is lost when quay adds fields.
+type Extras map[string]json.RawMessage
+
+// fieldNames caches the JSON field names per type
+var fieldNames sync.Map
+
+// jsonFieldNames returns the lower cased JSON field names of the
+// given struct type
+//
+// Names are lower cased since encoding/json matches fields ignoring
+// the case.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	if cached, ok := fieldNames.Load(t); ok {
+		return cached.(map[string]bool)
+	}
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for embedded := range jsonFieldNames(field.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	fieldNames.Store(t, names)
+	return names
+}
+
+// unmarshalWithExtras unmarshals the given JSON object into the given
+// pointer to a struct. Fields of the object that are not fields of
+// the struct are returned.
+//
+// The struct must not implement json.Unmarshaler. Types with extras
+// pass a plain copy of themselves to avoid the recursion.
+func unmarshalWithExtras(raw []byte, known interface{}) (Extras, error) {
+	err := json.Unmarshal(raw, known)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(raw, &all)
+	if err != nil {
+		return nil, err
+	}
+	names := jsonFieldNames(reflect.TypeOf(known).Elem())
+	var extras Extras
+	for name, value := range all {
+		if names[strings.ToLower(name)] {
+			continue
+		}
+		if extras == nil {
+			extras = Extras{}
+		}
+		extras[name] = value
+	}
+	return extras, nil
+}
+
+// marshalWithExtras marshals the given struct followed by the given
+// extras. Extras that clash with the fields of the struct are
+// skipped.
+func marshalWithExtras(known interface{}, extras Extras) ([]byte, error) {
+	raw, err := json.Marshal(known)
+	if err != nil || len(extras) == 0 {
+		return raw, err
+	}
+	names := jsonFieldNames(reflect.TypeOf(known))
+	var keys []string
+	for name := range extras {
+		if !names[strings.ToLower(name)] {
+			keys = append(keys, name)
+		}
+	}
+	// sorted keys keep the output stable
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Write(raw[:len(raw)-1])
+	for _, name := range keys {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(extras[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
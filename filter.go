@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RepoFilter selects repos by their names, visibility, state &
+// popularity
+//
+// Patterns are shell globs e.g. `jiva*` or `*-operator`. Refer to
+// path.Match for the syntax. Regular expressions match anywhere in
+// the name unless anchored e.g. `^cstor-(pool|volume)$`.
+type RepoFilter struct {
+	// Include selects repos matching any of these patterns. All repos
+	// are selected if this is empty.
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+
+	// Exclude drops repos matching any of these patterns even if
+	// these are included
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+
+	// IncludeRegex selects repos matching any of these regular
+	// expressions. Repos need to match Include as well if both are
+	// set.
+	IncludeRegex []string `json:"includeRegex,omitempty" yaml:"includeRegex,omitempty"`
+
+	// ExcludeRegex drops repos matching any of these regular
+	// expressions
+	ExcludeRegex []string `json:"excludeRegex,omitempty" yaml:"excludeRegex,omitempty"`
+
+	// IsPublic when set selects public repos if true & private repos
+	// otherwise
+	IsPublic *bool `json:"isPublic,omitempty" yaml:"isPublic,omitempty"`
+
+	// States selects repos in any of these states e.g. NORMAL
+	States []string `json:"states,omitempty" yaml:"states,omitempty"`
+
+	// MinPopularity when set drops repos whose popularity is lower
+	// than this. An explicit 0 is kept apart from unset so that it
+	// can override a non-zero default.
+	MinPopularity *float64 `json:"minPopularity,omitempty" yaml:"minPopularity,omitempty"`
+}
+
+// Validate returns an error if any of the patterns is malformed
+func (f RepoFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"Invalid repo pattern %q",
+				pattern,
+			)
+		}
+	}
+	_, err := compileAll(f.IncludeRegex)
+	if err != nil {
+		return err
+	}
+	_, err = compileAll(f.ExcludeRegex)
+	if err != nil {
+		return err
+	}
+	if f.MinPopularity != nil && *f.MinPopularity < 0 {
+		return errors.Errorf(
+			"Invalid min popularity %v: Must not be negative",
+			*f.MinPopularity,
+		)
+	}
+	return nil
+}
+
+// IsEmpty returns true if this filter selects all repos
+func (f RepoFilter) IsEmpty() bool {
+	return len(f.Include) == 0 &&
+		len(f.Exclude) == 0 &&
+		len(f.IncludeRegex) == 0 &&
+		len(f.ExcludeRegex) == 0 &&
+		f.IsPublic == nil &&
+		len(f.States) == 0 &&
+		f.MinPopularity == nil
+}
+
+// Match returns true if the given repo is selected by this filter.
+// Use Validate to verify the patterns before matching.
+func (f RepoFilter) Match(repo Popular) bool {
+	includes, _ := compileAll(f.IncludeRegex)
+	excludes, _ := compileAll(f.ExcludeRegex)
+	return f.match(repo, includes, excludes)
+}
+
+// Filter returns the given repos that are selected by this filter.
+// Order of the repos is retained.
+func (f RepoFilter) Filter(repos []Popular) []Popular {
+	if f.IsEmpty() {
+		return repos
+	}
+	// regular expressions are compiled once for all the repos
+	includes, _ := compileAll(f.IncludeRegex)
+	excludes, _ := compileAll(f.ExcludeRegex)
+	var out []Popular
+	for _, repo := range repos {
+		if f.match(repo, includes, excludes) {
+			out = append(out, repo)
+		}
+	}
+	return out
+}
+
+// match returns true if the given repo is selected by this filter
+// with the given compiled regular expressions
+func (f RepoFilter) match(repo Popular, includes, excludes []*regexp.Regexp) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, repo.Name) {
+		return false
+	}
+	if len(f.IncludeRegex) > 0 && !matchAnyRegex(includes, repo.Name) {
+		return false
+	}
+	if matchAny(f.Exclude, repo.Name) || matchAnyRegex(excludes, repo.Name) {
+		return false
+	}
+	if f.IsPublic != nil && *f.IsPublic != repo.IsPublic {
+		return false
+	}
+	if len(f.States) > 0 && !containsFold(f.States, repo.State) {
+		return false
+	}
+	return f.MinPopularity == nil || repo.Popularity >= *f.MinPopularity
+}
+
+// matchAny returns true if the given name matches any of the given
+// patterns. Malformed patterns match nothing.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnyRegex returns true if the given name matches any of the
+// given regular expressions
+func matchAnyRegex(exprs []*regexp.Regexp, name string) bool {
+	for _, expr := range exprs {
+		if expr.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileAll compiles the given regular expressions
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	var out []*regexp.Regexp
+	for _, expr := range exprs {
+		compiled, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"Invalid repo regex %q",
+				expr,
+			)
+		}
+		out = append(out, compiled)
+	}
+	return out, nil
+}
+
+// containsFold returns true if the given value is one of the given
+// values ignoring the case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
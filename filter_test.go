@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"reflect"
+	"testing"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+func TestRepoFilter(t *testing.T) {
+	public, private := true, false
+	minPopularity, noPopularity := 3.0, 0.0
+	repos := []gmetrics.Popular{
+		{Name: "jiva", IsPublic: true, State: "NORMAL", Popularity: 10},
+		{Name: "jiva-ci", IsPublic: true, State: "NORMAL", Popularity: 1},
+		{Name: "cstor-pool", IsPublic: true, State: "MIRROR", Popularity: 5},
+		{Name: "m-apiserver", State: "NORMAL", Popularity: 3},
+	}
+	var tests = map[string]struct {
+		filter gmetrics.RepoFilter
+		expect []string
+	}{
+		"empty": {
+			expect: []string{"jiva", "jiva-ci", "cstor-pool", "m-apiserver"},
+		},
+		"include": {
+			filter: gmetrics.RepoFilter{Include: []string{"jiva*", "cstor-*"}},
+			expect: []string{"jiva", "jiva-ci", "cstor-pool"},
+		},
+		"exclude": {
+			filter: gmetrics.RepoFilter{Exclude: []string{"*-ci"}},
+			expect: []string{"jiva", "cstor-pool", "m-apiserver"},
+		},
+		"include & exclude": {
+			filter: gmetrics.RepoFilter{
+				Include: []string{"jiva*"},
+				Exclude: []string{"*-ci"},
+			},
+			expect: []string{"jiva"},
+		},
+		"include regex": {
+			filter: gmetrics.RepoFilter{IncludeRegex: []string{"^(jiva|cstor)-"}},
+			expect: []string{"jiva-ci", "cstor-pool"},
+		},
+		"include & include regex": {
+			filter: gmetrics.RepoFilter{
+				Include:      []string{"jiva*"},
+				IncludeRegex: []string{"-ci$"},
+			},
+			expect: []string{"jiva-ci"},
+		},
+		"exclude regex": {
+			filter: gmetrics.RepoFilter{ExcludeRegex: []string{"-", "^x"}},
+			expect: []string{"jiva"},
+		},
+		"public": {
+			filter: gmetrics.RepoFilter{IsPublic: &public},
+			expect: []string{"jiva", "jiva-ci", "cstor-pool"},
+		},
+		"private": {
+			filter: gmetrics.RepoFilter{IsPublic: &private},
+			expect: []string{"m-apiserver"},
+		},
+		"states": {
+			filter: gmetrics.RepoFilter{States: []string{"mirror"}},
+			expect: []string{"cstor-pool"},
+		},
+		"min popularity": {
+			filter: gmetrics.RepoFilter{MinPopularity: &minPopularity},
+			expect: []string{"jiva", "cstor-pool", "m-apiserver"},
+		},
+		"zero min popularity": {
+			filter: gmetrics.RepoFilter{MinPopularity: &noPopularity},
+			expect: []string{"jiva", "jiva-ci", "cstor-pool", "m-apiserver"},
+		},
+		"include nothing": {
+			filter: gmetrics.RepoFilter{Include: []string{"maya"}},
+			expect: nil,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for _, repo := range test.filter.Filter(repos) {
+				got = append(got, repo.Name)
+			}
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Fatalf("Expected repos %v got %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestRepoFilterValidate(t *testing.T) {
+	negative := -1.0
+	var tests = map[string]struct {
+		filter gmetrics.RepoFilter
+		isErr  bool
+	}{
+		"valid": {
+			filter: gmetrics.RepoFilter{
+				Include:      []string{"jiva*"},
+				Exclude:      []string{"*-ci"},
+				IncludeRegex: []string{"^cstor-(pool|volume)$"},
+			},
+		},
+		"invalid glob": {
+			filter: gmetrics.RepoFilter{Include: []string{"[jiva"}},
+			isErr:  true,
+		},
+		"invalid regex": {
+			filter: gmetrics.RepoFilter{ExcludeRegex: []string{"(jiva"}},
+			isErr:  true,
+		},
+		"negative popularity": {
+			filter: gmetrics.RepoFilter{MinPopularity: &negative},
+			isErr:  true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.filter.Validate()
+			if test.isErr && err == nil {
+				t.Fatalf("Expected error got none")
+			}
+			if !test.isErr && err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+		})
+	}
+}
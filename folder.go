@@ -21,6 +21,8 @@ import (
 	"log"
 	"path"
 	"strings"
+
+	"github.com/mayadata.io/quay-logs/storage"
 )
 
 // FolderConfig is used to initialise Folder
@@ -43,7 +45,8 @@ func NewFolder(config FolderConfig) *Folder {
 	}
 }
 
-// ListJSONFiles lists all json files
+// ListJSONFiles lists all the files of logs i.e. json & ndjson files
+// including the compressed ones
 func (f *Folder) ListJSONFiles() ([]string, error) {
 	files, err := ioutil.ReadDir(f.Path)
 	if err != nil {
@@ -60,8 +63,12 @@ func (f *Folder) ListJSONFiles() ([]string, error) {
 			// we don't want to load directory
 			continue
 		}
-		if !strings.HasSuffix(fileName, ".json") {
-			// we support json file only
+		if strings.HasPrefix(fileName, ".") {
+			// hidden files e.g. sync state are not logs
+			continue
+		}
+		if _, ok := LogFileFormatOf(fileName); !ok {
+			// we support files of logs only
 			continue
 		}
 		fileNameWithPath := path.Join(f.Path, fileName)
@@ -76,3 +83,105 @@ func (f *Folder) ListJSONFiles() ([]string, error) {
 	}
 	return out, nil
 }
+
+// RepoLogs holds the stored logs of a repo
+type RepoLogs struct {
+	Namespace string
+	Name      string
+	Items     []Log
+}
+
+// ReadRepoLogs reads all the logs of the given storage. The keys
+// are expected to be laid out as `<namespace>/<repo>/*.json` or
+// `*.ndjson`.
+//
+// Logs are grouped by repo in lexical order of repos. Namespace &
+// repo of logs that lack these in their metadata are derived from
+// the key of the file.
+func ReadRepoLogs(store storage.Storage, debug bool) ([]RepoLogs, error) {
+	return readGroupedLogs(store, debug, func(key string) string {
+		namespace, name := repoOfKey(key)
+		return namespace + "/" + name
+	})
+}
+
+// ReadRunLogs reads all the logs of the given storage like
+// ReadRepoLogs. Logs are grouped by the fetch runs that wrote them
+// instead i.e. a repo has a group per run.
+func ReadRunLogs(store storage.Storage, debug bool) ([]RepoLogs, error) {
+	return readGroupedLogs(store, debug, runOfKey)
+}
+
+// readGroupedLogs reads all the logs of the given storage. Logs of
+// consecutive keys of the same group are grouped together.
+func readGroupedLogs(
+	store storage.Storage,
+	debug bool,
+	groupOf func(key string) string,
+) ([]RepoLogs, error) {
+	keys, err := ListJSONKeys(store, "")
+	if err != nil {
+		return nil, err
+	}
+	if debug {
+		log.Printf("Found json files: file-count %d", len(keys))
+	}
+	var out []RepoLogs
+	var group string
+	for i, key := range keys {
+		got, err := ReadLogList(store, key)
+		if err != nil {
+			return nil, err
+		}
+		namespace, name := repoOfKey(key)
+		if i == 0 || groupOf(key) != group {
+			group = groupOf(key)
+			out = append(out, RepoLogs{Namespace: namespace, Name: name})
+		}
+		current := &out[len(out)-1]
+		for _, entry := range got.Items {
+			if entry.Metadata.Namespace == "" {
+				entry.Metadata.Namespace = namespace
+			}
+			if entry.Metadata.Repo == "" {
+				entry.Metadata.Repo = name
+			}
+			current.Items = append(current.Items, entry)
+		}
+	}
+	return out, nil
+}
+
+// ListJSONKeys lists the keys of all the files of logs i.e. json &
+// ndjson files of the given storage that start with the given prefix
+// in lexical order. Files of hidden folders e.g. popularity
+// snapshots are not listed.
+func ListJSONKeys(store storage.Storage, prefix string) ([]string, error) {
+	keys, err := store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, key := range keys {
+		if _, ok := LogFileFormatOf(key); !ok {
+			// we support files of logs only
+			continue
+		}
+		if strings.HasPrefix(key, ".") || strings.Contains(key, "/.") {
+			// hidden folders do not have logs
+			continue
+		}
+		out = append(out, key)
+	}
+	return out, nil
+}
+
+// repoOfKey returns the namespace & repo of the given key i.e.
+// `<namespace>/<repo>/<filename>`
+func repoOfKey(key string) (namespace string, name string) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
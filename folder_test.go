@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// newTempDir creates a temporary directory with the given files
+func newTempDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "quay-logs-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	for name, content := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		err = ioutil.WriteFile(fpath, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestFolderListJSONFiles(t *testing.T) {
+	dir := newTempDir(t, map[string]string{
+		"a.json":                   "{}",
+		"b.txt":                    "",
+		gmetrics.SyncStateFileName: "{}",
+		"ns/repo/c.json":           "{}",
+		"ns/repo/d.json":           "{}",
+	})
+	defer os.RemoveAll(dir)
+
+	f := gmetrics.NewFolder(gmetrics.FolderConfig{Path: dir})
+	got, err := f.ListJSONFiles()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	expect := []string{filepath.Join(dir, "a.json")}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("Expected %v got %v", expect, got)
+	}
+
+}
+
+func TestFolderListJSONFilesEmpty(t *testing.T) {
+	dir := newTempDir(t, nil)
+	defer os.RemoveAll(dir)
+
+	got, err := gmetrics.NewFolder(gmetrics.FolderConfig{Path: dir}).ListJSONFiles()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("Expected no files got %v", got)
+	}
+}
+
+func TestFolderListJSONFilesMissing(t *testing.T) {
+	f := gmetrics.NewFolder(gmetrics.FolderConfig{Path: "/does/not/exist"})
+	_, err := f.ListJSONFiles()
+	if err == nil {
+		t.Fatalf("Expected error got none")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"log"
+	"net"
+
+	"github.com/pkg/errors"
+
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// Geo is the location & the network of the IP of a log as found in
+// a GeoIP database
+type Geo struct {
+	CountryISOCode string `json:"country_iso_code,omitempty"`
+	Country        string `json:"country,omitempty"`
+	City           string `json:"city,omitempty"`
+	// ASN is the number of the autonomous system of the IP
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// IsEmpty returns true if nothing is known about the IP
+func (g Geo) IsEmpty() bool {
+	return g == Geo{}
+}
+
+// GeoLookup finds the Geo of an IP. A zero Geo is returned if the IP
+// is not found.
+type GeoLookup interface {
+	LookupGeo(ip net.IP) (Geo, error)
+}
+
+// Country returns the ISO code of the country of the IP of this log
+// e.g. US. Country resolved by quay is preferred over the one found
+// by the GeoIP enrichment. It is empty if neither is known.
+func (l Log) Country() string {
+	if l.Metadata.ResolvedIP.CountryISOCode != "" {
+		return l.Metadata.ResolvedIP.CountryISOCode
+	}
+	if l.Geo != nil {
+		return l.Geo.CountryISOCode
+	}
+	return ""
+}
+
+// EnrichResult summarises the GeoIP enrichment of logs
+type EnrichResult struct {
+	FileCount      int
+	RewrittenCount int
+	LogCount       int
+	EnrichedCount  int
+	// MissCount is the number of logs whose IP is invalid or is not
+	// found in the GeoIP database
+	MissCount int
+}
+
+// Enrich sets Geo of the given logs in place by looking up their IPs
+//
+// Only Geo is set. Values supplied by quay e.g. ResolvedIP are never
+// modified. Geo set by an earlier enrichment is replaced so that a
+// newer database can be applied. Geo of the logs whose IPs are not
+// found is left as is.
+func Enrich(logs []Log, lookup GeoLookup) (EnrichResult, error) {
+	var result EnrichResult
+	for i := range logs {
+		result.LogCount++
+		ip := net.ParseIP(logs[i].IP)
+		if ip == nil {
+			result.MissCount++
+			continue
+		}
+		geo, err := lookup.LookupGeo(ip)
+		if err != nil {
+			return result, errors.Wrapf(
+				err,
+				"Failed to lookup IP %q",
+				logs[i].IP,
+			)
+		}
+		if geo.IsEmpty() {
+			result.MissCount++
+			continue
+		}
+		if logs[i].Geo != nil && *logs[i].Geo == geo {
+			continue
+		}
+		logs[i].Geo = &geo
+		result.EnrichedCount++
+	}
+	return result, nil
+}
+
+// EnrichStorage sets Geo of the logs of all the files of logs of the
+// given storage in place
+//
+// Only the files having logs whose Geo changed are rewritten.
+func EnrichStorage(store storage.Storage, lookup GeoLookup, debug bool) (EnrichResult, error) {
+	var result EnrichResult
+	keys, err := ListJSONKeys(store, "")
+	if err != nil {
+		return result, err
+	}
+	for _, key := range keys {
+		result.FileCount++
+		got, err := ReadLogList(store, key)
+		if err != nil {
+			return result, err
+		}
+		enriched, err := Enrich(got.Items, lookup)
+		if err != nil {
+			return result, errors.Wrapf(
+				err,
+				"Failed to enrich logs of %s",
+				key,
+			)
+		}
+		result.LogCount += enriched.LogCount
+		result.EnrichedCount += enriched.EnrichedCount
+		result.MissCount += enriched.MissCount
+		if enriched.EnrichedCount == 0 {
+			continue
+		}
+		err = WriteLogList(store, key, got)
+		if err != nil {
+			return result, err
+		}
+		result.RewrittenCount++
+		if debug {
+			log.Printf("Enriched logs of file: %s", key)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// fakeGeo is a GeoLookup of the given IPs
+type fakeGeo map[string]gmetrics.Geo
+
+func (f fakeGeo) LookupGeo(ip net.IP) (gmetrics.Geo, error) {
+	return f[ip.String()], nil
+}
+
+// geo has the Geo of the first IPs of newPullLogs
+var geo = fakeGeo{
+	"10.0.0.0": {CountryISOCode: "DE", Country: "Germany", City: "Berlin", ASN: 3320, Organization: "Deutsche Telekom AG"},
+	"10.0.0.1": {CountryISOCode: "IN", Country: "India", ASN: 9829, Organization: "BSNL"},
+}
+
+func TestEnrich(t *testing.T) {
+	logs := newPullLogs("openebs", "jiva", now, 3)
+	logs[1].Metadata.ResolvedIP = gmetrics.ResolvedIP{
+		CountryISOCode: "US",
+		Provider:       "aws",
+	}
+	got, err := gmetrics.Enrich(logs, geo)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if got.LogCount != 3 || got.EnrichedCount != 2 || got.MissCount != 1 {
+		t.Fatalf("Expected 3 logs of which 2 enriched & 1 not found got %+v", got)
+	}
+	var tests = map[string]struct {
+		entry   gmetrics.Log
+		country string
+		asn     uint
+	}{
+		"enriched": {
+			entry:   logs[0],
+			country: "DE",
+			asn:     3320,
+		},
+		"resolved by quay": {
+			entry:   logs[1],
+			country: "US",
+			asn:     9829,
+		},
+		"not found": {
+			entry: logs[2],
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			if mock.entry.Country() != mock.country {
+				t.Fatalf("Expected country %q got %q", mock.country, mock.entry.Country())
+			}
+			var asn uint
+			if mock.entry.Geo != nil {
+				asn = mock.entry.Geo.ASN
+			}
+			if asn != mock.asn {
+				t.Fatalf("Expected ASN %d got %d", mock.asn, asn)
+			}
+		})
+	}
+	// values supplied by quay are never overwritten
+	if logs[1].Metadata.ResolvedIP.CountryISOCode != "US" || logs[1].Metadata.ResolvedIP.Provider != "aws" {
+		t.Fatalf("Expected resolved IP of quay got %+v", logs[1].Metadata.ResolvedIP)
+	}
+
+	// enriching again changes nothing
+	got, err = gmetrics.Enrich(logs, geo)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if got.EnrichedCount != 0 {
+		t.Fatalf("Expected no enriched logs got %+v", got)
+	}
+}
+
+func TestEnrichStorage(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(3)
+	defer server.Close()
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	got, err := gmetrics.EnrichStorage(store, geo, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if got.FileCount != 1 || got.RewrittenCount != 1 || got.EnrichedCount != 2 {
+		t.Fatalf("Expected 1 rewritten file with 2 enriched logs got %+v", got)
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	// quay returns the newest logs first
+	var countries []string
+	for _, entry := range repos[0].Items {
+		countries = append(countries, entry.Country())
+	}
+	if len(countries) != 3 || countries[0] != "" || countries[1] != "IN" || countries[2] != "DE" {
+		t.Fatalf("Expected countries none, IN & DE got %q", countries)
+	}
+}
+
+func TestLogEnrichesBeforeStoring(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(3)
+	defer server.Close()
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now.Add(time.Minute)),
+		GeoLookup:     geo,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got.Items) != 3 || got.Items[2].Geo == nil || got.Items[2].Geo.City != "Berlin" {
+		t.Fatalf("Expected enriched logs got %+v", got.Items)
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if repos[0].Items[1].Country() != "IN" {
+		t.Fatalf("Expected stored log of IN got %+v", repos[0].Items[1])
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package geoip looks up the location & the network of IPs in local
+// MaxMind format databases e.g. GeoLite2-City & GeoLite2-ASN
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/pkg/errors"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// record has the fields of the City, Country & ASN databases that
+// are used. Fields not present in a database are left empty.
+type record struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// DB looks up IPs in one or more databases. Results of all the
+// databases are merged; the first database having a field wins.
+//
+// DB is safe for concurrent use.
+type DB struct {
+	Paths   []string
+	readers []*maxminddb.Reader
+}
+
+// Open returns a DB of the given database files. Close it once done.
+func Open(paths ...string) (*DB, error) {
+	if len(paths) == 0 {
+		return nil, errors.Errorf("No GeoIP database files")
+	}
+	db := &DB{Paths: paths}
+	for _, path := range paths {
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			db.Close()
+			return nil, errors.Wrapf(
+				err,
+				"Failed to open GeoIP database: Path %q",
+				path,
+			)
+		}
+		db.readers = append(db.readers, reader)
+	}
+	return db, nil
+}
+
+// Close closes the database files
+func (db *DB) Close() error {
+	var firstErr error
+	for _, reader := range db.readers {
+		err := reader.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// LookupGeo returns the Geo of the given IP. It implements
+// gmetrics.GeoLookup.
+func (db *DB) LookupGeo(ip net.IP) (gmetrics.Geo, error) {
+	var geo gmetrics.Geo
+	for i, reader := range db.readers {
+		if reader.Metadata.IPVersion == 4 && ip.To4() == nil {
+			// IPv6 addresses are not found in IPv4 only databases
+			continue
+		}
+		var got record
+		err := reader.Lookup(ip, &got)
+		if err != nil {
+			return gmetrics.Geo{}, errors.Wrapf(
+				err,
+				"Failed to lookup GeoIP database: Path %q",
+				db.Paths[i],
+			)
+		}
+		merge(&geo, got)
+	}
+	return geo, nil
+}
+
+// merge sets the empty fields of the given Geo from the given record
+func merge(geo *gmetrics.Geo, got record) {
+	if geo.CountryISOCode == "" {
+		geo.CountryISOCode = got.Country.ISOCode
+	}
+	if geo.Country == "" {
+		geo.Country = got.Country.Names["en"]
+	}
+	if geo.City == "" {
+		geo.City = got.City.Names["en"]
+	}
+	if geo.ASN == 0 {
+		geo.ASN = got.ASN
+	}
+	if geo.Organization == "" {
+		geo.Organization = got.Organization
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package geoip_test
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/geoip"
+)
+
+// databases used by these tests are generated by testdata/generate.go
+var (
+	cityDB    = filepath.Join("testdata", "test-city.mmdb")
+	asnIPv4DB = filepath.Join("testdata", "test-asn-ipv4.mmdb")
+)
+
+func TestLookupGeo(t *testing.T) {
+	var tests = map[string]struct {
+		paths  []string
+		ip     string
+		expect gmetrics.Geo
+	}{
+		"city": {
+			paths: []string{cityDB},
+			ip:    "81.2.69.142",
+			expect: gmetrics.Geo{
+				CountryISOCode: "GB",
+				Country:        "United Kingdom",
+				City:           "London",
+			},
+		},
+		"merged databases": {
+			paths: []string{cityDB, asnIPv4DB},
+			ip:    "81.2.69.142",
+			expect: gmetrics.Geo{
+				CountryISOCode: "GB",
+				Country:        "United Kingdom",
+				City:           "London",
+				ASN:            20712,
+				Organization:   "Andrews & Arnold Ltd",
+			},
+		},
+		"first database having a field wins": {
+			paths: []string{asnIPv4DB, cityDB},
+			ip:    "81.2.69.142",
+			expect: gmetrics.Geo{
+				CountryISOCode: "DE",
+				Country:        "Germany",
+				City:           "London",
+				ASN:            20712,
+				Organization:   "Andrews & Arnold Ltd",
+			},
+		},
+		"ipv6 skips ipv4 only database": {
+			paths: []string{asnIPv4DB, cityDB},
+			ip:    "2001:db8::1",
+			expect: gmetrics.Geo{
+				CountryISOCode: "US",
+				Country:        "United States",
+			},
+		},
+		"ip not found": {
+			paths: []string{cityDB, asnIPv4DB},
+			ip:    "10.0.0.1",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			db, err := geoip.Open(mock.paths...)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			defer db.Close()
+			got, err := db.LookupGeo(net.ParseIP(mock.ip))
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if got != mock.expect {
+				t.Fatalf("Expected %+v got %+v", mock.expect, got)
+			}
+		})
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	var tests = map[string][]string{
+		"no databases":     nil,
+		"missing database": {cityDB, filepath.Join("testdata", "missing.mmdb")},
+		"not a database":   {filepath.Join("testdata", "generate.go")},
+	}
+	for name, paths := range tests {
+		name, paths := name, paths
+		t.Run(name, func(t *testing.T) {
+			_, err := geoip.Open(paths...)
+			if err == nil {
+				t.Fatalf("Expected error got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+//go:build ignore
+// +build ignore
+
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// generate writes the databases used by the tests of geoip. These
+// are generated with github.com/maxmind/mmdbwriter which is not a
+// dependency of this module. Run it from a module that requires it:
+//
+//	go run generate.go
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// network is a network of a database along with its record
+type network struct {
+	cidr   string
+	record mmdbtype.Map
+}
+
+// names returns the names record of the given english name
+func names(en string) mmdbtype.Map {
+	return mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(en)}}
+}
+
+// country returns the country record of the given ISO code & name
+func country(isoCode string, en string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"iso_code": mmdbtype.String(isoCode),
+		"names":    mmdbtype.Map{"en": mmdbtype.String(en)},
+	}
+}
+
+// write writes the given networks to the given database file
+func write(filename string, dbType string, ipVersion int, networks []network) {
+	writer, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType: dbType,
+		IPVersion:    ipVersion,
+		RecordSize:   24,
+		// documentation networks are used
+		IncludeReservedNetworks: true,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create writer: %v", err)
+	}
+	for _, n := range networks {
+		_, ipnet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			log.Fatalf("Invalid network %q: %v", n.cidr, err)
+		}
+		err = writer.Insert(ipnet, n.record)
+		if err != nil {
+			log.Fatalf("Failed to insert network %q: %v", n.cidr, err)
+		}
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", filename, err)
+	}
+	defer file.Close()
+	_, err = writer.WriteTo(file)
+	if err != nil {
+		log.Fatalf("Failed to write %s: %v", filename, err)
+	}
+}
+
+func main() {
+	write("test-city.mmdb", "Test-City", 6, []network{
+		{
+			cidr: "81.2.69.0/24",
+			record: mmdbtype.Map{
+				"country": country("GB", "United Kingdom"),
+				"city":    names("London"),
+			},
+		},
+		{
+			cidr: "2001:db8::/32",
+			record: mmdbtype.Map{
+				"country": country("US", "United States"),
+			},
+		},
+	})
+	// country of this database differs to tell which one wins
+	write("test-asn-ipv4.mmdb", "Test-ASN", 4, []network{
+		{
+			cidr: "81.2.69.0/24",
+			record: mmdbtype.Map{
+				"country":                        country("DE", "Germany"),
+				"autonomous_system_number":       mmdbtype.Uint32(20712),
+				"autonomous_system_organization": mmdbtype.String("Andrews & Arnold Ltd"),
+			},
+		},
+	})
+}
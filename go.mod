@@ -3,7 +3,13 @@ module github.com/mayadata.io/quay-logs
 go 1.13
 
 require (
+	github.com/klauspost/compress v1.11.4
+	github.com/minio/minio-go/v7 v7.0.5
+	github.com/oschwald/maxminddb-golang v1.7.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.7.1
 	github.com/yukithm/json2csv v0.1.1
+	go.etcd.io/bbolt v1.3.5
 	gopkg.in/resty.v1 v1.12.0
-)
\ No newline at end of file
+	gopkg.in/yaml.v2 v2.3.0
+)
@@ -17,9 +17,12 @@ limitations under the License.
 package growthmetrics
 
 import (
+	"fmt"
+	"log"
+	"net/http"
 	"strings"
+	"time"
 
-	"github.com/pkg/errors"
 	"gopkg.in/resty.v1"
 )
 
@@ -47,7 +50,68 @@ type HTTPRequest struct {
 }
 
 // Invoke invokes http calls
+//
+// Failed calls are retried as per the retry policy & all calls are
+// subject to the shared rate limiter. The last response is returned
+// once retries are exhausted.
 func (r *HTTPRequest) Invoke() (*resty.Response, error) {
+	policy, limiter := currentRetryPolicy()
+	for retry := 0; ; retry++ {
+		limiter.Wait()
+		resp, err := r.invokeOnce()
+		updateRetryStats(func(stats *RetryStats) {
+			stats.Requests++
+			if retry > 0 {
+				stats.Retries++
+			}
+			if err == nil && resp.StatusCode() == http.StatusTooManyRequests {
+				stats.RateLimited++
+			}
+		})
+		if _, isUnsupported := err.(unsupportedMethodError); isUnsupported {
+			return nil, err
+		}
+		if err == nil {
+			if reset, found := rateLimitReset(resp.Header()); found {
+				// server allows no more requests till reset
+				//
+				// NOTE:
+				//	A reset later than the policy allows pauses the
+				// requests for MaxDelay only
+				limiter.PauseUntil(time.Now().Add(policy.capDelay(time.Until(reset))))
+			}
+			if !isRetriable(resp.StatusCode()) {
+				return resp, nil
+			}
+		}
+		if retry >= policy.MaxRetries {
+			updateRetryStats(func(stats *RetryStats) {
+				stats.GaveUp++
+			})
+			return resp, err
+		}
+
+		delay := policy.backoff(retry + 1)
+		if err == nil {
+			if after, found := retryAfter(resp.Header(), time.Now()); found {
+				// a server asking to wait longer than the policy
+				// allows is retried after MaxDelay
+				delay = policy.capDelay(after)
+			}
+		}
+		log.Printf(
+			"Will retry http request: URL %q: Attempt %d: Delay %s: %s",
+			r.URL,
+			retry+1,
+			delay.Round(time.Millisecond),
+			describeFailure(resp, err),
+		)
+		time.Sleep(delay)
+	}
+}
+
+// invokeOnce makes a single attempt of the http call
+func (r *HTTPRequest) invokeOnce() (*resty.Response, error) {
 	req := resty.New().R().
 		SetBasicAuth(r.Username, r.Password).
 		SetAuthToken(r.AuthToken).
@@ -66,9 +130,25 @@ func (r *HTTPRequest) Invoke() (*resty.Response, error) {
 	case GET:
 		return req.Get(r.URL)
 	default:
-		return nil, errors.Errorf(
-			"Unsupported http method %q",
-			r.Method,
-		)
+		return nil, unsupportedMethodError{method: r.Method}
+	}
+}
+
+// unsupportedMethodError is returned for http methods that are not
+// supported. Such requests are not retried.
+type unsupportedMethodError struct {
+	method string
+}
+
+// Error implements error interface
+func (e unsupportedMethodError) Error() string {
+	return fmt.Sprintf("Unsupported http method %q", e.method)
+}
+
+// describeFailure returns the reason of a failed attempt
+func describeFailure(resp *resty.Response, err error) string {
+	if err != nil {
+		return err.Error()
 	}
+	return fmt.Sprintf("StatusCode %d", resp.StatusCode())
 }
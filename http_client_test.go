@@ -0,0 +1,201 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+)
+
+func TestMain(m *testing.M) {
+	// retries should not slow down the tests
+	gmetrics.SetRetryPolicy(gmetrics.RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   5 * time.Millisecond,
+	})
+	os.Exit(m.Run())
+}
+
+func TestInvokeRetries(t *testing.T) {
+	var tests = map[string]struct {
+		failure          quaytest.Failure
+		expectStatusCode int
+		expectRequests   int
+	}{
+		"retries server errors till success": {
+			failure: quaytest.Failure{
+				StatusCode: http.StatusBadGateway,
+				Times:      2,
+			},
+			expectStatusCode: http.StatusOK,
+			expectRequests:   3,
+		},
+		"retries rate limited requests after Retry-After": {
+			failure: quaytest.Failure{
+				StatusCode: http.StatusTooManyRequests,
+				Headers:    map[string]string{"Retry-After": "0"},
+			},
+			expectStatusCode: http.StatusOK,
+			expectRequests:   2,
+		},
+		"caps Retry-After by max delay": {
+			failure: quaytest.Failure{
+				StatusCode: http.StatusTooManyRequests,
+				Headers:    map[string]string{"Retry-After": "3600"},
+			},
+			expectStatusCode: http.StatusOK,
+			expectRequests:   2,
+		},
+		"gives up after max retries": {
+			failure: quaytest.Failure{
+				StatusCode: http.StatusServiceUnavailable,
+				Times:      -1,
+			},
+			expectStatusCode: http.StatusServiceUnavailable,
+			expectRequests:   4,
+		},
+		"does not retry client errors": {
+			failure: quaytest.Failure{
+				StatusCode: http.StatusBadRequest,
+				Times:      -1,
+			},
+			expectStatusCode: http.StatusBadRequest,
+			expectRequests:   1,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			server := quaytest.NewServer(quaytest.ServerConfig{})
+			defer server.Close()
+			server.Fail(mock.failure)
+
+			req := &gmetrics.HTTPRequest{
+				URL:    gmetrics.QuayAPIURL(server.URL, "repository"),
+				Method: gmetrics.GET,
+			}
+			resp, err := req.Invoke()
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if resp.StatusCode() != mock.expectStatusCode {
+				t.Fatalf(
+					"Expected status code %d got %d",
+					mock.expectStatusCode,
+					resp.StatusCode(),
+				)
+			}
+			if len(server.Requests()) != mock.expectRequests {
+				t.Fatalf(
+					"Expected %d requests got %d",
+					mock.expectRequests,
+					len(server.Requests()),
+				)
+			}
+		})
+	}
+}
+
+func TestInvokeCapsRateLimitReset(t *testing.T) {
+	server := quaytest.NewServer(quaytest.ServerConfig{})
+	defer server.Close()
+	server.Fail(quaytest.Failure{
+		StatusCode: http.StatusTooManyRequests,
+		Headers: map[string]string{
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10),
+		},
+	})
+
+	started := time.Now()
+	req := &gmetrics.HTTPRequest{
+		URL:    gmetrics.QuayAPIURL(server.URL, "repository"),
+		Method: gmetrics.GET,
+	}
+	resp, err := req.Invoke()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		t.Fatalf("Expected status code %d got %d", http.StatusOK, resp.StatusCode())
+	}
+	// requests are paused for max delay of the retry policy only
+	if took := time.Since(started); took > time.Second {
+		t.Fatalf("Expected requests paused for max delay got %s", took)
+	}
+}
+
+func TestInvokeUnsupportedMethod(t *testing.T) {
+	server := quaytest.NewServer(quaytest.ServerConfig{})
+	defer server.Close()
+
+	req := &gmetrics.HTTPRequest{
+		URL:    server.URL,
+		Method: "put",
+	}
+	_, err := req.Invoke()
+	if err == nil {
+		t.Fatalf("Expected error got none")
+	}
+	if len(server.Requests()) != 0 {
+		t.Fatalf("Expected no requests got %d", len(server.Requests()))
+	}
+}
+
+func TestQuayAPIURL(t *testing.T) {
+	var tests = map[string]struct {
+		baseURL string
+		expect  string
+	}{
+		"defaults to quay.io": {
+			baseURL: "",
+			expect:  "https://quay.io/api/v1/repository",
+		},
+		"host only": {
+			baseURL: "https://quay.example.com",
+			expect:  "https://quay.example.com/api/v1/repository",
+		},
+		"trailing slash": {
+			baseURL: "https://quay.example.com/",
+			expect:  "https://quay.example.com/api/v1/repository",
+		},
+		"with api path": {
+			baseURL: "https://quay.example.com/api",
+			expect:  "https://quay.example.com/api/v1/repository",
+		},
+		"with api version path": {
+			baseURL: "http://localhost:8080/api/v1/",
+			expect:  "http://localhost:8080/api/v1/repository",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			got := gmetrics.QuayAPIURL(mock.baseURL, "repository")
+			if got != mock.expect {
+				t.Fatalf("Expected %q got %q", mock.expect, got)
+			}
+		})
+	}
+}
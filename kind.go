@@ -0,0 +1,218 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// LogKind is the kind of event recorded by a quay log e.g. pull_repo
+type LogKind string
+
+// Kinds of quay logs of a repository
+const (
+	KindPullRepo       LogKind = "pull_repo"
+	KindPullRepoFailed LogKind = "pull_repo_failed"
+	KindPushRepo       LogKind = "push_repo"
+	KindPushRepoFailed LogKind = "push_repo_failed"
+
+	KindCreateTag            LogKind = "create_tag"
+	KindMoveTag              LogKind = "move_tag"
+	KindDeleteTag            LogKind = "delete_tag"
+	KindRevertTag            LogKind = "revert_tag"
+	KindPermanentlyDeleteTag LogKind = "permanently_delete_tag"
+	KindChangeTagExpiration  LogKind = "change_tag_expiration"
+
+	KindCreateRepo           LogKind = "create_repo"
+	KindDeleteRepo           LogKind = "delete_repo"
+	KindChangeRepoVisibility LogKind = "change_repo_visibility"
+	KindChangeRepoState      LogKind = "change_repo_state"
+	KindChangeRepoTrust      LogKind = "change_repo_trust"
+	KindSetRepoDescription   LogKind = "set_repo_description"
+
+	KindAddRepoPermission    LogKind = "add_repo_permission"
+	KindChangeRepoPermission LogKind = "change_repo_permission"
+	KindDeleteRepoPermission LogKind = "delete_repo_permission"
+
+	KindBuildDockerfile   LogKind = "build_dockerfile"
+	KindSetupRepoTrigger  LogKind = "setup_repo_trigger"
+	KindToggleRepoTrigger LogKind = "toggle_repo_trigger"
+	KindDeleteRepoTrigger LogKind = "delete_repo_trigger"
+
+	KindAddRepoNotification    LogKind = "add_repo_notification"
+	KindDeleteRepoNotification LogKind = "delete_repo_notification"
+	KindResetRepoNotification  LogKind = "reset_repo_notification"
+
+	KindManifestLabelAdd    LogKind = "manifest_label_add"
+	KindManifestLabelDelete LogKind = "manifest_label_delete"
+
+	KindRepoMirrorEnabled     LogKind = "repo_mirror_enabled"
+	KindRepoMirrorDisabled    LogKind = "repo_mirror_disabled"
+	KindRepoMirrorSyncSuccess LogKind = "repo_mirror_sync_success"
+	KindRepoMirrorSyncFailed  LogKind = "repo_mirror_sync_failed"
+
+	KindRepoVerb LogKind = "repo_verb"
+)
+
+// KindCategory groups the kinds of logs by the interest in these
+type KindCategory string
+
+const (
+	// CategoryAdoption has the logs that tell about the usage of
+	// images i.e. pulls
+	CategoryAdoption KindCategory = "adoption"
+
+	// CategoryAudit has the logs that tell about the changes made to
+	// the repository e.g. pushes & deleted tags
+	CategoryAudit KindCategory = "audit"
+
+	// CategoryOther has the remaining logs e.g. builds & mirroring
+	CategoryOther KindCategory = "other"
+)
+
+// KindInfo describes a kind of quay log
+type KindInfo struct {
+	Kind        LogKind
+	Category    KindCategory
+	Description string
+}
+
+// KindCatalog lists the known kinds of quay logs of a repository
+var KindCatalog = []KindInfo{
+	{KindPullRepo, CategoryAdoption, "image was pulled"},
+	{KindPullRepoFailed, CategoryAdoption, "image pull failed"},
+	{KindRepoVerb, CategoryAdoption, "image was pulled as a squashed image or ACI"},
+	{KindPushRepo, CategoryAudit, "image was pushed"},
+	{KindPushRepoFailed, CategoryAudit, "image push failed"},
+	{KindCreateTag, CategoryAudit, "tag was created"},
+	{KindMoveTag, CategoryAudit, "tag was moved to another image"},
+	{KindDeleteTag, CategoryAudit, "tag was deleted"},
+	{KindRevertTag, CategoryAudit, "tag was reverted to an earlier image"},
+	{KindPermanentlyDeleteTag, CategoryAudit, "tag was deleted permanently"},
+	{KindChangeTagExpiration, CategoryAudit, "expiration of tag was changed"},
+	{KindCreateRepo, CategoryAudit, "repository was created"},
+	{KindDeleteRepo, CategoryAudit, "repository was deleted"},
+	{KindChangeRepoVisibility, CategoryAudit, "repository was made public or private"},
+	{KindChangeRepoState, CategoryAudit, "state of repository was changed"},
+	{KindChangeRepoTrust, CategoryAudit, "trust of repository was changed"},
+	{KindSetRepoDescription, CategoryAudit, "description of repository was changed"},
+	{KindAddRepoPermission, CategoryAudit, "permission was granted"},
+	{KindChangeRepoPermission, CategoryAudit, "permission was changed"},
+	{KindDeleteRepoPermission, CategoryAudit, "permission was revoked"},
+	{KindManifestLabelAdd, CategoryAudit, "label was added to a manifest"},
+	{KindManifestLabelDelete, CategoryAudit, "label was deleted from a manifest"},
+	{KindBuildDockerfile, CategoryOther, "build was started"},
+	{KindSetupRepoTrigger, CategoryOther, "build trigger was set up"},
+	{KindToggleRepoTrigger, CategoryOther, "build trigger was enabled or disabled"},
+	{KindDeleteRepoTrigger, CategoryOther, "build trigger was deleted"},
+	{KindAddRepoNotification, CategoryOther, "notification was added"},
+	{KindDeleteRepoNotification, CategoryOther, "notification was deleted"},
+	{KindResetRepoNotification, CategoryOther, "notification was reset"},
+	{KindRepoMirrorEnabled, CategoryOther, "mirroring was enabled"},
+	{KindRepoMirrorDisabled, CategoryOther, "mirroring was disabled"},
+	{KindRepoMirrorSyncSuccess, CategoryOther, "mirror sync succeeded"},
+	{KindRepoMirrorSyncFailed, CategoryOther, "mirror sync failed"},
+}
+
+// LookupKind returns the catalog entry of the given kind
+func LookupKind(kind LogKind) (KindInfo, bool) {
+	for _, info := range KindCatalog {
+		if info.Kind == kind {
+			return info, true
+		}
+	}
+	return KindInfo{}, false
+}
+
+// KindsOfCategory returns the kinds of the catalog that belong to the
+// given category
+func KindsOfCategory(category KindCategory) []LogKind {
+	var out []LogKind
+	for _, info := range KindCatalog {
+		if info.Category == category {
+			out = append(out, info.Kind)
+		}
+	}
+	return out
+}
+
+// ParseLogKinds returns the kinds of the given names. A name is
+// either a kind of the catalog e.g. delete_tag or a category e.g.
+// audit that stands for all its kinds.
+func ParseLogKinds(names []string) ([]LogKind, error) {
+	var out []LogKind
+	for _, name := range names {
+		if _, found := LookupKind(LogKind(name)); found {
+			out = append(out, LogKind(name))
+			continue
+		}
+		kinds := KindsOfCategory(KindCategory(name))
+		if len(kinds) == 0 {
+			return nil, errors.Errorf("Unknown log kind %q", name)
+		}
+		out = append(out, kinds...)
+	}
+	return out, nil
+}
+
+// FilterKinds returns the given logs that are of any of the given
+// kinds. All logs are returned if no kinds are given. Order of the
+// logs is retained.
+func FilterKinds(logs []Log, kinds []LogKind) []Log {
+	if len(kinds) == 0 {
+		return logs
+	}
+	var out []Log
+	for _, entry := range logs {
+		for _, kind := range kinds {
+			if entry.Kind == kind {
+				out = append(out, entry)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// KindCount is the number of logs of a kind
+type KindCount struct {
+	Kind  LogKind
+	Count int
+}
+
+// CountKinds returns the number of the given logs per kind in the
+// descending order of counts. Kinds with equal counts are sorted by
+// their names.
+func CountKinds(logs []Log) []KindCount {
+	counts := map[LogKind]int{}
+	for _, entry := range logs {
+		counts[entry.Kind]++
+	}
+	var out []KindCount
+	for kind, count := range counts {
+		out = append(out, KindCount{Kind: kind, Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Kind < out[j].Kind
+	})
+	return out
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"reflect"
+	"testing"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+func TestParseLogKinds(t *testing.T) {
+	var tests = map[string]struct {
+		names  []string
+		isErr  bool
+		expect []gmetrics.LogKind
+	}{
+		"none": {},
+		"kinds": {
+			names:  []string{"pull_repo", "delete_tag"},
+			expect: []gmetrics.LogKind{gmetrics.KindPullRepo, gmetrics.KindDeleteTag},
+		},
+		"category": {
+			names: []string{"adoption"},
+			expect: []gmetrics.LogKind{
+				gmetrics.KindPullRepo,
+				gmetrics.KindPullRepoFailed,
+				gmetrics.KindRepoVerb,
+			},
+		},
+		"unknown": {
+			names: []string{"pull"},
+			isErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := gmetrics.ParseLogKinds(test.names)
+			if test.isErr {
+				if err == nil {
+					t.Fatalf("Expected error got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Fatalf("Expected kinds %v got %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestKindCatalog(t *testing.T) {
+	seen := map[gmetrics.LogKind]bool{}
+	for _, info := range gmetrics.KindCatalog {
+		if seen[info.Kind] {
+			t.Fatalf("Expected unique kinds got %q twice", info.Kind)
+		}
+		seen[info.Kind] = true
+		if info.Category == "" || info.Description == "" {
+			t.Fatalf("Expected category & description of %q got %+v", info.Kind, info)
+		}
+	}
+	info, found := gmetrics.LookupKind(gmetrics.KindPushRepo)
+	if !found || info.Category != gmetrics.CategoryAudit {
+		t.Fatalf("Expected push_repo of audit category got %+v", info)
+	}
+}
+
+func TestCountAndFilterKinds(t *testing.T) {
+	logs := []gmetrics.Log{
+		{Kind: gmetrics.KindPushRepo},
+		{Kind: gmetrics.KindPullRepo},
+		{Kind: gmetrics.KindDeleteTag},
+		{Kind: gmetrics.KindPullRepo},
+	}
+	counts := gmetrics.CountKinds(logs)
+	expect := []gmetrics.KindCount{
+		{Kind: gmetrics.KindPullRepo, Count: 2},
+		{Kind: gmetrics.KindDeleteTag, Count: 1},
+		{Kind: gmetrics.KindPushRepo, Count: 1},
+	}
+	if !reflect.DeepEqual(counts, expect) {
+		t.Fatalf("Expected counts %v got %v", expect, counts)
+	}
+	got := gmetrics.FilterKinds(logs, []gmetrics.LogKind{gmetrics.KindPushRepo, gmetrics.KindDeleteTag})
+	if len(got) != 2 || got[0].Kind != gmetrics.KindPushRepo || got[1].Kind != gmetrics.KindDeleteTag {
+		t.Fatalf("Expected push & delete tag logs got %+v", got)
+	}
+	if len(gmetrics.FilterKinds(logs, nil)) != 4 {
+		t.Fatalf("Expected all logs without kinds")
+	}
+}
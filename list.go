@@ -19,77 +19,86 @@ package growthmetrics
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"os"
-	"os/exec"
 	"path"
-	"path/filepath"
-	"time"
 
+	"github.com/mayadata.io/quay-logs/storage"
 	"github.com/pkg/errors"
 )
 
 // ListableConfig is used to initialise Listable instance
 type ListableConfig struct {
+	// QuayURL is the base URL of the quay instance; defaults to
+	// DefaultQuayURL when empty
+	QuayURL            string
 	Namespace          string
 	AuthToken          string
 	BaseOutputFilePath string
 	IsWriteToFile      bool
 	Debug              bool
 	Windows            bool
+	// AllowPartialList when set to true logs a warning instead of
+	// returning ErrPartialRepoList if the repos may be truncated
+	AllowPartialList bool
+	// Clock is used to name the files. Defaults to SystemClock.
+	Clock Clock
+	// Storage stores the repo lists when IsWriteToFile is set.
+	// Defaults to local files at BaseOutputFilePath.
+	Storage storage.Storage
+	// Filter selects the listed repos. All repos are listed by
+	// default. Stored repo lists are not filtered.
+	Filter RepoFilter
+	// IsSnapshot when set to true stores a snapshot of the popularity
+	// of all the listed repos in the Storage. Snapshots are not
+	// filtered. No snapshot is stored if the list may be partial.
+	// Refer to SaveSnapshot.
+	IsSnapshot bool
 }
 
+// RepositoryPageSize is the maximum number of repos returned by
+// quay in a single page
+const RepositoryPageSize int = 100
+
+// ErrPartialRepoList is returned if quay returned a full page of
+// repos without a next page token. Remaining repos of the namespace
+// can not be listed in this case.
+var ErrPartialRepoList = errors.New("Repo list is partial")
+
 // Listable is used to list all images of the given namespace
 type Listable struct {
 	*Popularity
 }
 
 // NewLister returns a new instance of Listable
-// It creates a new folder by the mkdir command using the arguments
-// passed to it.
 func NewLister(config ListableConfig) (*Listable, error) {
-	if config.IsWriteToFile {
-		folder := path.Join(
-			config.BaseOutputFilePath,
+	err := config.Filter.Validate()
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Invalid repo filter: Namespace %q",
 			config.Namespace,
 		)
-		if config.Windows == true {
-			// since windows doesn't support '\'
-			p := filepath.FromSlash(folder)
-			if config.Debug == true {
-				fmt.Println("Creating folders: " + p)
-			}
-			err := os.MkdirAll(p, 0755)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			// this block is for linux. Supports '/' filepath systems
-			cmd := exec.Command(
-				"mkdir",
-				"-p",
-				folder,
-				//It will be something like "mkdir -p ./popularity/namespace/
-			)
-			err := cmd.Run()
-			if err != nil {
-				return nil, errors.Wrapf(
-					err,
-					"Failed to create repo list folder: Name %q",
-					folder,
-				)
-			}
-		}
+	}
+	store := config.Storage
+	if (config.IsWriteToFile || config.IsSnapshot) && store == nil {
+		// repo lists are stored at ./popularity/namespace/ by default
+		store = storage.NewLocal(config.BaseOutputFilePath)
 	}
 
 	return &Listable{
 		Popularity: &Popularity{
+			QuayURL:            config.QuayURL,
 			Namespace:          config.Namespace,
 			AuthToken:          config.AuthToken,
 			BaseOutputFilePath: config.BaseOutputFilePath,
 			IsWriteToFile:      config.IsWriteToFile,
 			Debug:              config.Debug,
+			Windows:            config.Windows,
+			AllowPartialList:   config.AllowPartialList,
+			Clock:              orSystemClock(config.Clock),
+			Storage:            store,
+			Filter:             config.Filter,
+			IsSnapshot:         config.IsSnapshot,
 		},
 	}, nil
 }
@@ -106,15 +115,18 @@ type PopularityOption func(*Popularity) error
 
 // Popularity helps fetch images ranked with their popularity
 type Popularity struct {
+	QuayURL            string
 	Namespace          string
 	AuthToken          string
 	BaseOutputFilePath string
 	IsWriteToFile      bool
 	Debug              bool
 	Windows            bool
-	// the below will be assigned in the next function
-	currentFileName string
-	fileNamePath    string
+	AllowPartialList   bool
+	Clock              Clock
+	Storage            storage.Storage
+	Filter             RepoFilter
+	IsSnapshot         bool
 }
 
 // ListReposByPopularityAndWriteToFileOptionally requests for repos by
@@ -122,21 +134,30 @@ type Popularity struct {
 //
 // It calls the `RequestReposForPageToken( )` which returns all repos
 // name in order of popularity.
-// -- Right now we don't have 100 repos that's why all the data are in
-// one page. Thus some codes are commented below.
+// -- Quay returns at most RepositoryPageSize repos per page. Pages
+// are followed till quay stops returning a next page token.
+// ErrPartialRepoList is returned if the repos may have been
+// truncated unless AllowPartialList is set.
+// -- A snapshot of all the listed repos is stored if IsSnapshot is
+// set & the list is not partial. Repos not selected by the Filter
+// are dropped after that.
 func (p *Popularity) ListReposByPopularityAndWriteToFileOptionally() (PopularList, error) {
 	var out = &PopularList{}
 
 	var isNextpage = true
 	var pagetoken = ""
 	var index int
+	var seenTokens = map[string]bool{}
+	// isPartial is set if the repos may be truncated
+	var isPartial bool
 
 	// File names for all downloads need to have same prefix
 	// Variable 'now' defines this prefix
-	var now = time.Now().Format("Jan-02-2006-15:04:05")
+	var listedAt = orSystemClock(p.Clock).Now()
+	var now = listedAt.Format("Jan-02-2006-15:04:05")
 	if p.Windows == true {
 		// since windows doesn't support ':'
-		now = time.Now().Format("Jan-02-2006-15-04-05")
+		now = listedAt.Format("Jan-02-2006-15-04-05")
 	}
 	for isNextpage {
 		// Set or reset filename
@@ -148,21 +169,8 @@ func (p *Popularity) ListReposByPopularityAndWriteToFileOptionally() (PopularLis
 		//	Logs is a list API call that is paged. Each page can
 		// optionally be saved to a new file.
 		filename := fmt.Sprintf("%s-%d.json", now, index)
-		//folderPath example ./popularity/namespace/
-		folderPath := path.Join(p.BaseOutputFilePath, p.Namespace)
-		if p.Windows == true {
-			p.fileNamePath = filepath.FromSlash(folderPath)
-		} else {
-			p.fileNamePath = ""
-		}
-
-		//jsonPath example ./popularity/namespace/filename
-		jsonPath := path.Join(folderPath, filename) // relative filename
-		if p.Windows == true {
-			p.currentFileName = filepath.FromSlash(jsonPath)
-		} else {
-			p.currentFileName = jsonPath
-		}
+		//key example namespace/filename
+		key := path.Join(p.Namespace, filename)
 
 		// Invoke API to request for logs
 		//
@@ -172,37 +180,86 @@ func (p *Popularity) ListReposByPopularityAndWriteToFileOptionally() (PopularLis
 		//
 		// RequestReposForPageToken( ): Creates a HTTPRequest with some query
 		// parameters and invokes it.
-		got, err := p.RequestReposForPageToken(pagetoken)
+		got, err := p.RequestReposForPageToken(pagetoken, key)
 		if err != nil {
 			return PopularList{}, err
 		}
 		out.Items = append(out.Items, got.Items...)
 
-		// TODO
-		// 	Uncomment following code once API response supports
-		// next token field
-		//
-		// prepare for next iteration
-		//isNextpage = got.NextPage != ""
-		//pagetoken = got.NextPage
+		// NOTE:
+		//	A full page without a next page token means that quay
+		// did not paginate & the remaining repos got truncated
+		if got.NextPage == "" && len(got.Items) >= RepositoryPageSize {
+			isPartial = true
+			log.Printf(
+				"Warning: Repo list may be partial: Namespace %q: Repos %d: Full page of %d repos without next page",
+				p.Namespace,
+				len(out.Items),
+				len(got.Items),
+			)
+			if !p.AllowPartialList {
+				return PopularList{}, errors.Wrapf(
+					ErrPartialRepoList,
+					"Failed to list all repos: Namespace %q: Repos %d",
+					p.Namespace,
+					len(out.Items),
+				)
+			}
+		}
+		if got.NextPage != "" && seenTokens[got.NextPage] {
+			return PopularList{}, errors.Wrapf(
+				ErrPartialRepoList,
+				"Failed to list all repos: Namespace %q: Repos %d: Page token %q repeated",
+				p.Namespace,
+				len(out.Items),
+				got.NextPage,
+			)
+		}
+		seenTokens[got.NextPage] = true
 
-		// TODO: next_page is not defined in the response to following API:
-		// - https://quay.io/api/v1/repository
-		//
-		// Hence next page is set to false after a single invocation
-		isNextpage = false
+		// prepare for next iteration
+		isNextpage = got.NextPage != ""
+		pagetoken = got.NextPage
 		index++
 	}
+	if p.IsSnapshot && isPartial {
+		// ranks of a partial list would be wrong
+		log.Printf(
+			"Warning: Skipped snapshot of partial repo list: Namespace %q",
+			p.Namespace,
+		)
+	} else if p.IsSnapshot {
+		err := SaveSnapshot(p.Storage, Snapshot{
+			Namespace: p.Namespace,
+			Time:      listedAt,
+			Repos:     out.Items,
+		})
+		if err != nil {
+			return PopularList{}, err
+		}
+	}
+	if !p.Filter.IsEmpty() {
+		total := len(out.Items)
+		out.Items = p.Filter.Filter(out.Items)
+		log.Printf(
+			"Filtered repos: Namespace %q: Selected %d: Total %d",
+			p.Namespace,
+			len(out.Items),
+			total,
+		)
+	}
 	return *out, nil
 }
 
 // RequestReposForPageToken lists the repos belonging to a namespace
 // Creates a HTTPRequest with some query parameters and invokes it.
-func (p *Popularity) RequestReposForPageToken(pagetoken string) (PopularList, error) {
+// -- If `IsWriteToFile` is true the response is put into the
+// storage at the given key.
+func (p *Popularity) RequestReposForPageToken(pagetoken string, key string) (PopularList, error) {
 	// creating the request
 	req := &HTTPRequest{
 		AuthToken: p.AuthToken,
-		URL:       "https://quay.io/api/v1/repository",
+		URL:       QuayAPIURL(p.QuayURL, "repository"),
 		Method:    GET,
 		QueryParams: map[string]string{
 			"popularity": "true",
@@ -220,19 +277,26 @@ func (p *Popularity) RequestReposForPageToken(pagetoken string) (PopularList, er
 			req.URL,
 		)
 	}
+	err = checkResponse(resp)
+	if err != nil {
+		return PopularList{}, errors.Wrapf(
+			err,
+			"Failed to list repos: Namespace %q",
+			p.Namespace,
+		)
+	}
 
-	// Since `IsWriteToFile` is false so it **doesn't** call `WriteToFile`
 	if p.IsWriteToFile {
-		//writing the reponse in ./popularity/namespace/currentfileName.json
-		p.WriteToFile(resp.Body(), p.currentFileName, p.fileNamePath)
+		//writing the reponse in namespace/filename.json
+		err = p.Storage.Put(key, resp.Body())
 		if err != nil {
 			return PopularList{}, errors.Wrapf(
 				err,
 				"Failed to write popularity data to file: %q",
-				p.currentFileName,
+				key,
 			)
 		}
-		log.Printf("Sucessfully wrote PopularList to file --------------> " + p.currentFileName)
+		log.Printf("Sucessfully wrote PopularList to file --------------> " + key)
 	}
 
 	// it is capable of holding the list of images
@@ -251,25 +315,3 @@ func (p *Popularity) RequestReposForPageToken(pagetoken string) (PopularList, er
 	//returning the PopularList
 	return out, nil
 }
-
-// WriteToFile creates a file with images having
-// popularity ratings. This file is named with today's date.
-// It writes the content of response body into passed filename with
-// file mode 0644.
-func (p *Popularity) WriteToFile(raw []byte, filename string, fpath string) error {
-	if fpath != "" {
-		if _, err := os.Stat(filename); os.IsNotExist(err) {
-			os.MkdirAll(fpath, 0700) // Create your file
-		}
-	}
-
-	errfile := ioutil.WriteFile(filename, raw, 0644)
-	if errfile != nil {
-		return errors.Wrapf(
-			errfile,
-			"Failed to write filename to %s",
-			filename,
-		)
-	}
-	return nil
-}
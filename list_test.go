@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// addRepos adds the given number of repos to the namespace of the
+// given server
+func addRepos(server *quaytest.Server, namespace string, count int) {
+	for i := 0; i < count; i++ {
+		server.AddRepo(namespace, gmetrics.Popular{
+			Name:       fmt.Sprintf("repo-%03d", i),
+			Popularity: float64(count - i),
+		})
+	}
+}
+
+func TestListReposFollowsNextPage(t *testing.T) {
+	server := quaytest.NewServer(quaytest.ServerConfig{})
+	defer server.Close()
+	addRepos(server, "openebs", 250)
+
+	l, err := gmetrics.NewLister(gmetrics.ListableConfig{
+		QuayURL:   server.URL,
+		Namespace: "openebs",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := l.ListReposAndWriteToFileOptionally()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got.Items) != 250 {
+		t.Fatalf("Expected 250 repos got %d", len(got.Items))
+	}
+	if got.Items[0].Name != "repo-000" || got.Items[249].Name != "repo-249" {
+		t.Fatalf("Expected repos in order of popularity got %v", got.Items)
+	}
+	if len(server.Requests()) != 3 {
+		t.Fatalf("Expected 3 requests got %d", len(server.Requests()))
+	}
+}
+
+func TestListReposFiltered(t *testing.T) {
+	server := quaytest.NewServer(quaytest.ServerConfig{})
+	defer server.Close()
+	addRepos(server, "openebs", 250)
+
+	minPopularity := 200.0
+	l, err := gmetrics.NewLister(gmetrics.ListableConfig{
+		QuayURL:   server.URL,
+		Namespace: "openebs",
+		Filter: gmetrics.RepoFilter{
+			ExcludeRegex:  []string{"5$"},
+			MinPopularity: &minPopularity,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := l.ListReposAndWriteToFileOptionally()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	// repo-000 to repo-050 are popular enough & 5 of these end with 5
+	if len(got.Items) != 46 {
+		t.Fatalf("Expected 46 repos got %d", len(got.Items))
+	}
+	if got.Items[0].Name != "repo-000" || got.Items[45].Name != "repo-050" {
+		t.Fatalf("Expected repos in order of popularity got %v", got.Items)
+	}
+
+	_, err = gmetrics.NewLister(gmetrics.ListableConfig{
+		QuayURL:   server.URL,
+		Namespace: "openebs",
+		Filter:    gmetrics.RepoFilter{IncludeRegex: []string{"(jiva"}},
+	})
+	if err == nil {
+		t.Fatalf("Expected error for invalid regex got none")
+	}
+}
+
+func TestListReposPartial(t *testing.T) {
+	var tests = map[string]struct {
+		allowPartial bool
+		expectCount  int
+		isErr        bool
+	}{
+		"partial list is an error": {
+			isErr: true,
+		},
+		"partial list is allowed": {
+			allowPartial: true,
+			expectCount:  100,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			server := quaytest.NewServer(quaytest.ServerConfig{
+				DisableRepoPagination: true,
+			})
+			defer server.Close()
+			addRepos(server, "openebs", 150)
+
+			store := storage.NewMemory()
+			l, err := gmetrics.NewLister(gmetrics.ListableConfig{
+				QuayURL:          server.URL,
+				Namespace:        "openebs",
+				AllowPartialList: mock.allowPartial,
+				Storage:          store,
+				IsSnapshot:       true,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			got, err := l.ListReposAndWriteToFileOptionally()
+			if mock.isErr {
+				if !errors.Is(err, gmetrics.ErrPartialRepoList) {
+					t.Fatalf("Expected partial list error got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if len(got.Items) != mock.expectCount {
+				t.Fatalf("Expected %d repos got %d", mock.expectCount, len(got.Items))
+			}
+			// snapshot of a partial list is not stored
+			times, err := gmetrics.ListSnapshots(store, "openebs")
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if len(times) != 0 {
+				t.Fatalf("Expected no snapshots got %v", times)
+			}
+		})
+	}
+}
+
+func TestListReposUnauthorized(t *testing.T) {
+	server := quaytest.NewServer(quaytest.ServerConfig{
+		AuthToken: "secret",
+	})
+	defer server.Close()
+	addRepos(server, "openebs", 1)
+
+	l, err := gmetrics.NewLister(gmetrics.ListableConfig{
+		QuayURL:   server.URL,
+		Namespace: "openebs",
+		AuthToken: "invalid",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = l.ListReposAndWriteToFileOptionally()
+	var unauthorized *gmetrics.UnauthorizedError
+	if !errors.As(err, &unauthorized) {
+		t.Fatalf("Expected unauthorized error got %v", err)
+	}
+	if unauthorized.StatusCode != 401 || unauthorized.Body.ErrorType != "invalid_token" {
+		t.Fatalf("Expected decoded quay error got %+v", unauthorized.APIError)
+	}
+}
+
+func TestListReposWriteToFile(t *testing.T) {
+	dir := newTempDir(t, nil)
+	defer os.RemoveAll(dir)
+
+	server := quaytest.NewServer(quaytest.ServerConfig{
+		AuthToken: "secret",
+	})
+	defer server.Close()
+	addRepos(server, "openebs", 2)
+
+	l, err := gmetrics.NewLister(gmetrics.ListableConfig{
+		QuayURL:            server.URL,
+		Namespace:          "openebs",
+		AuthToken:          "secret",
+		BaseOutputFilePath: dir,
+		IsWriteToFile:      true,
+		Clock:              quaytest.NewClock(time.Date(2020, 8, 6, 9, 13, 10, 0, time.UTC)),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = l.ListReposAndWriteToFileOptionally()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "openebs", "Aug-06-2020-09:13:10-0.json"))
+	if err != nil {
+		t.Fatalf("Expected repos file got %v", err)
+	}
+}
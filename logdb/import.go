@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logdb
+
+import (
+	"log"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// ImportResult summarises an import
+type ImportResult struct {
+	RepoCount  int
+	LogCount   int
+	AddedCount int
+	// UpdatedCount is the number of logs imported earlier that were
+	// replaced since these changed e.g. after these were enriched
+	UpdatedCount int
+	// SnapshotCount is the number of namespaces whose latest
+	// popularity snapshot was imported
+	SnapshotCount int
+	// PopularCount is the number of repos of these snapshots
+	PopularCount int
+}
+
+// ImportFolder stores all the logs of the given folder. The folder
+// is expected to be laid out as `<namespace>/<repo>/*.json` e.g.
+// the logs file path of the fetch mode.
+func (db *DB) ImportFolder(fpath string) (ImportResult, error) {
+	return db.Import(storage.NewLocal(fpath))
+}
+
+// Import stores all the logs of the given storage. Logs are stored
+// per fetch run. Logs that are already stored are replaced. Hence
+// importing again only adds the logs downloaded since the previous
+// import & updates the logs that changed e.g. after these were
+// enriched. Logs of a run that were stored by an earlier run are not
+// added again.
+//
+// The latest popularity snapshot of every namespace is stored as
+// well. Repos stored earlier are replaced by these.
+func (db *DB) Import(store storage.Storage) (ImportResult, error) {
+	var result ImportResult
+	runs, err := gmetrics.ReadRunLogs(store, db.Debug)
+	if err != nil {
+		return result, err
+	}
+	imported := map[string]bool{}
+	for _, run := range runs {
+		if len(run.Items) == 0 {
+			continue
+		}
+		put, err := db.PutLogs(run.Items)
+		if err != nil {
+			return result, err
+		}
+		repo := run.Namespace + "/" + run.Name
+		if !imported[repo] {
+			imported[repo] = true
+			result.RepoCount++
+		}
+		result.LogCount += len(run.Items)
+		result.AddedCount += put.AddedCount
+		result.UpdatedCount += put.UpdatedCount
+		if db.Debug {
+			log.Printf(
+				"Imported logs: Namespace %q: Name %q: Logs %d: Added %d: Updated %d",
+				run.Namespace,
+				run.Name,
+				len(run.Items),
+				put.AddedCount,
+				put.UpdatedCount,
+			)
+		}
+	}
+	err = db.importSnapshots(store, &result)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// importSnapshots stores the repos of the latest popularity snapshot
+// of every namespace of the given storage
+func (db *DB) importSnapshots(store storage.Storage, result *ImportResult) error {
+	namespaces, err := gmetrics.ListSnapshotNamespaces(store)
+	if err != nil {
+		return err
+	}
+	for _, namespace := range namespaces {
+		times, err := gmetrics.ListSnapshots(store, namespace)
+		if err != nil {
+			return err
+		}
+		if len(times) == 0 {
+			continue
+		}
+		snapshot, err := gmetrics.LoadSnapshot(store, namespace, times[len(times)-1])
+		if err != nil {
+			return err
+		}
+		err = db.PutPopular(namespace, snapshot.Repos)
+		if err != nil {
+			return err
+		}
+		result.SnapshotCount++
+		result.PopularCount += len(snapshot.Repos)
+		if db.Debug {
+			log.Printf(
+				"Imported popularity: Namespace %q: Time %s: Repos %d",
+				namespace,
+				snapshot.Time.Format(gmetrics.SnapshotTimeFormat),
+				len(snapshot.Repos),
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logdb is an embedded database of quay logs & repo
+// popularity. It is backed by a single bbolt file & indexes logs by
+// namespace, repo, tag, kind, country & datetime.
+package logdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+var (
+	// logsBucket maps keys of logs to logs. Refer logKey.
+	logsBucket = []byte("logs")
+
+	// popularBucket maps `namespace/name` of repos to repos
+	popularBucket = []byte("popular")
+)
+
+// index is a bucket that maps a property of logs to keys of the
+// logs
+type index struct {
+	bucket []byte
+	value  func(gmetrics.Log) string
+}
+
+var (
+	namespaceIndex = index{
+		bucket: []byte("index-namespace"),
+		value:  func(l gmetrics.Log) string { return l.Metadata.Namespace },
+	}
+	repoIndex = index{
+		bucket: []byte("index-repo"),
+		value:  func(l gmetrics.Log) string { return l.Metadata.Repo },
+	}
+	tagIndex = index{
+		bucket: []byte("index-tag"),
+		value:  func(l gmetrics.Log) string { return l.Metadata.Tag },
+	}
+	kindIndex = index{
+		bucket: []byte("index-kind"),
+		value:  func(l gmetrics.Log) string { return string(l.Kind) },
+	}
+	countryIndex = index{
+		bucket: []byte("index-country"),
+		value:  func(l gmetrics.Log) string { return l.Country() },
+	}
+	// datetimeIndex has all logs in the order of their datetime
+	datetimeIndex = index{
+		bucket: []byte("index-datetime"),
+		value:  func(l gmetrics.Log) string { return "" },
+	}
+)
+
+// indexes lists all the indexes of logs
+var indexes = []index{
+	namespaceIndex,
+	repoIndex,
+	tagIndex,
+	kindIndex,
+	countryIndex,
+	datetimeIndex,
+}
+
+// timeKeyFormat formats datetime of logs in index keys. It sorts in
+// the chronological order.
+const timeKeyFormat string = "2006-01-02T15:04:05Z"
+
+// Config is used to open a DB
+type Config struct {
+	// Path is the database file. It is created if it does not exist.
+	Path  string
+	Debug bool
+	// Timeout is the time to wait for the lock of the database file
+	// held by another process. Defaults to a second.
+	Timeout time.Duration
+}
+
+// DB stores logs & repo popularity
+//
+// DB is safe for concurrent use. Only one process can open the
+// database file at a time.
+type DB struct {
+	Path  string
+	Debug bool
+
+	bolt *bolt.DB
+}
+
+// Open opens the database of the given config
+func Open(config Config) (*DB, error) {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = time.Second
+	}
+	b, err := bolt.Open(config.Path, 0644, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to open database: Path %q",
+			config.Path,
+		)
+	}
+	err = b.Update(func(tx *bolt.Tx) error {
+		buckets := [][]byte{logsBucket, popularBucket}
+		for _, i := range indexes {
+			buckets = append(buckets, i.bucket)
+		}
+		for _, name := range buckets {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to create bucket %s", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Close()
+		return nil, errors.Wrapf(
+			err,
+			"Failed to initialise database: Path %q",
+			config.Path,
+		)
+	}
+	return &DB{
+		Path:  config.Path,
+		Debug: config.Debug,
+		bolt:  b,
+	}, nil
+}
+
+// Close closes the database file
+func (db *DB) Close() error {
+	return db.bolt.Close()
+}
+
+// PutResult summarises the logs stored by PutLogs
+type PutResult struct {
+	AddedCount int
+	// UpdatedCount is the number of stored logs that were replaced
+	// since these differed e.g. by their Geo
+	UpdatedCount int
+}
+
+// PutLogs stores the given logs e.g. the logs of a fetch run
+//
+// Logs having the same fingerprint are distinct events e.g. pulls
+// of the same second whose IPs were truncated. These are told apart
+// by the order of their occurrence in the given logs. A log replaces
+// the stored log of the same fingerprint & occurrence. Hence putting
+// the same logs again does not add these again but updates the logs
+// that changed e.g. after these were enriched.
+func (db *DB) PutLogs(logs []gmetrics.Log) (PutResult, error) {
+	var result PutResult
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		result = PutResult{}
+		bucket := tx.Bucket(logsBucket)
+		occurrences := map[string]int{}
+		for _, entry := range logs {
+			fingerprint := entry.Fingerprint()
+			key := logKey(fingerprint, occurrences[fingerprint])
+			occurrences[fingerprint]++
+			raw, err := json.Marshal(entry)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to marshal log")
+			}
+			old := bucket.Get(key)
+			if bytes.Equal(old, raw) {
+				continue
+			}
+			if old != nil {
+				// index entries of the replaced log are removed since
+				// its country may have changed
+				var stored gmetrics.Log
+				err = json.Unmarshal(old, &stored)
+				if err != nil {
+					return errors.Wrapf(err, "Failed to unmarshal log %s", key)
+				}
+				err = deleteIndexKeys(tx, stored, key)
+				if err != nil {
+					return err
+				}
+				result.UpdatedCount++
+			} else {
+				result.AddedCount++
+			}
+			err = bucket.Put(key, raw)
+			if err != nil {
+				return err
+			}
+			for _, i := range indexes {
+				err = tx.Bucket(i.bucket).Put(indexKey(i.value(entry), entry, key), nil)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return PutResult{}, errors.Wrapf(
+			err,
+			"Failed to store logs: Path %q",
+			db.Path,
+		)
+	}
+	return result, nil
+}
+
+// deleteIndexKeys removes the index entries of the given log that is
+// stored at the given key
+func deleteIndexKeys(tx *bolt.Tx, entry gmetrics.Log, key []byte) error {
+	for _, i := range indexes {
+		err := tx.Bucket(i.bucket).Delete(indexKey(i.value(entry), entry, key))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutPopular stores the given repos of the given namespace. Repos
+// that are already stored are replaced. Namespace of the repos
+// defaults to the given namespace.
+func (db *DB) PutPopular(namespace string, repos []gmetrics.Popular) error {
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(popularBucket)
+		for _, repo := range repos {
+			if repo.Namespace == "" {
+				repo.Namespace = namespace
+			}
+			raw, err := json.Marshal(repo)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to marshal repo %q", repo.Name)
+			}
+			err = bucket.Put([]byte(repo.Namespace+"/"+repo.Name), raw)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to store repos: Namespace %q: Path %q",
+			namespace,
+			db.Path,
+		)
+	}
+	return nil
+}
+
+// logKey returns the key of the log of the given fingerprint &
+// occurrence i.e. `fingerprint` for the first occurrence &
+// `fingerprint-occurrence` for the others
+func logKey(fingerprint string, occurrence int) []byte {
+	// NOTE:
+	//	The first occurrence is keyed by the fingerprint alone since
+	// logs were keyed so before occurrences were told apart
+	if occurrence == 0 {
+		return []byte(fingerprint)
+	}
+	return []byte(fingerprint + "-" + strconv.Itoa(occurrence))
+}
+
+// indexKey returns the key of the given log in an index i.e.
+// `value \x00 datetime \x00 key` where key is the key of the log
+// in logsBucket
+//
+// Keys of the same value are sorted by datetime. Logs whose
+// datetime can not be parsed sort before all others.
+func indexKey(value string, entry gmetrics.Log, key []byte) []byte {
+	out := []byte(value + "\x00" + timeKey(entry) + "\x00")
+	return append(out, key...)
+}
+
+// timeKey returns the datetime of the given log as used in index
+// keys
+func timeKey(entry gmetrics.Log) string {
+	t, err := entry.Time()
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(timeKeyFormat)
+}
@@ -0,0 +1,328 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logdb_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/logdb"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// start is the datetime of the first log used by these tests
+var start = time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC)
+
+// openDB opens a new database in a temporary folder
+func openDB(t *testing.T) (*logdb.DB, func()) {
+	dir, err := ioutil.TempDir("", "logdb-test")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	db, err := logdb.Open(logdb.Config{Path: filepath.Join(dir, "quay.db")})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDBQuery(t *testing.T) {
+	db, cleanup := openDB(t)
+	defer cleanup()
+
+	added, err := db.PutLogs([]gmetrics.Log{
+		quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: start.Add(3 * time.Hour)}),
+		quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "2.0.0", Country: "IN", Time: start.Add(2 * time.Hour)}),
+		quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "IN", Time: start.Add(time.Hour)}),
+		quaytest.NewLog(quaytest.LogConfig{Repo: "cstor", Tag: "latest", Country: "US", Time: start}),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if added.AddedCount != 4 {
+		t.Fatalf("Expected 4 added logs got %+v", added)
+	}
+	// logs stored earlier are not added again
+	added, err = db.PutLogs([]gmetrics.Log{quaytest.NewLog(quaytest.LogConfig{Repo: "cstor", Tag: "latest", Country: "US", Time: start})})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if added.AddedCount != 0 || added.UpdatedCount != 0 {
+		t.Fatalf("Expected no added logs got %+v", added)
+	}
+
+	var tests = map[string]struct {
+		query  logdb.Query
+		expect []int
+	}{
+		"all": {
+			query:  logdb.Query{},
+			expect: []int{0, 1, 2, 3},
+		},
+		"repo": {
+			query:  logdb.Query{Repo: "jiva"},
+			expect: []int{1, 2, 3},
+		},
+		"tag & country": {
+			query:  logdb.Query{Tag: "latest", Country: "IN"},
+			expect: []int{1},
+		},
+		"time range": {
+			query: logdb.Query{
+				Namespace: "openebs",
+				Start:     start.Add(time.Hour),
+				End:       start.Add(3 * time.Hour),
+			},
+			expect: []int{1, 2},
+		},
+		"limit": {
+			query:  logdb.Query{Kind: "pull_repo", Limit: 2},
+			expect: []int{0, 1},
+		},
+		"none": {
+			query: logdb.Query{Repo: "maya"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := db.Logs(test.query)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if len(got) != len(test.expect) {
+				t.Fatalf("Expected %d logs got %d", len(test.expect), len(got))
+			}
+			for i, hours := range test.expect {
+				datetime := start.Add(time.Duration(hours) * time.Hour).Format(gmetrics.QuayTimeFormat)
+				if got[i].Datetime != datetime {
+					t.Fatalf("Expected log %d at %s got %s", i, datetime, got[i].Datetime)
+				}
+			}
+			count, err := db.Count(test.query)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if count != len(test.expect) {
+				t.Fatalf("Expected count %d got %d", len(test.expect), count)
+			}
+		})
+	}
+}
+
+func TestDBPutLogsOfSameSecond(t *testing.T) {
+	db, cleanup := openDB(t)
+	defer cleanup()
+
+	// pulls of the same second from a network whose IPs were
+	// truncated look alike
+	pull := quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: start})
+	pull.IP = "10.0.0.0"
+	got, err := db.PutLogs([]gmetrics.Log{pull, pull, pull})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if got.AddedCount != 3 {
+		t.Fatalf("Expected 3 added logs got %+v", got)
+	}
+
+	// enriched logs replace the stored ones & are indexed by their
+	// new country
+	pull.Metadata.ResolvedIP.CountryISOCode = "IN"
+	got, err = db.PutLogs([]gmetrics.Log{pull, pull, pull, pull})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if got.AddedCount != 1 || got.UpdatedCount != 3 {
+		t.Fatalf("Expected 1 added & 3 updated logs got %+v", got)
+	}
+	for country, expect := range map[string]int{"US": 0, "IN": 4} {
+		count, err := db.Count(logdb.Query{Country: country, Repo: "jiva"})
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if count != expect {
+			t.Fatalf("Expected %d logs of country %q got %d", expect, country, count)
+		}
+	}
+	count, err := db.Count(logdb.Query{})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if count != 4 {
+		t.Fatalf("Expected 4 logs got %d", count)
+	}
+}
+
+func TestDBPurgeLogs(t *testing.T) {
+	db, cleanup := openDB(t)
+	defer cleanup()
+
+	purged := quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: start.Add(time.Hour)})
+	purged.IP = "203.0.113.7"
+	_, err := db.PutLogs([]gmetrics.Log{
+		quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: start}),
+		purged,
+		quaytest.NewLog(quaytest.LogConfig{Repo: "cstor", Tag: "latest", Country: "IN", Time: start.Add(2 * time.Hour)}),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	match := func(entry gmetrics.Log) bool { return entry.IP == purged.IP }
+	for _, isDryRun := range []bool{true, false} {
+		removed, err := db.PurgeLogs(match, isDryRun)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if removed != 1 {
+			t.Fatalf("Dry run %t: Expected 1 removed log got %d", isDryRun, removed)
+		}
+	}
+	// purged logs are removed from the indexes as well
+	got, err := db.Logs(logdb.Query{Repo: "jiva", Country: "US"})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got) != 1 || got[0].IP == purged.IP {
+		t.Fatalf("Expected 1 log of jiva left got %+v", got)
+	}
+	count, err := db.Count(logdb.Query{})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 logs left got %d", count)
+	}
+}
+
+func TestDBPopular(t *testing.T) {
+	db, cleanup := openDB(t)
+	defer cleanup()
+
+	err := db.PutPopular("openebs", []gmetrics.Popular{
+		{Name: "cstor", Popularity: 5},
+		{Name: "jiva", Popularity: 10},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	err = db.PutPopular("litmuschaos", []gmetrics.Popular{
+		{Name: "go-runner", Popularity: 20},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := db.Popular("openebs")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "jiva" || got[0].Namespace != "openebs" {
+		t.Fatalf("Expected jiva followed by cstor got %+v", got)
+	}
+	all, err := db.Popular("")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(all) != 3 || all[0].Name != "go-runner" {
+		t.Fatalf("Expected 3 repos got %+v", all)
+	}
+}
+
+func TestDBImport(t *testing.T) {
+	db, cleanup := openDB(t)
+	defer cleanup()
+
+	store := storage.NewMemory()
+	for key, logs := range map[string][]gmetrics.Log{
+		"openebs/jiva/Aug-13-2020-09:13:10-0.json": {
+			quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: start}),
+			quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: start.Add(time.Hour)}),
+		},
+		"openebs/jiva/Aug-14-2020-09:13:10-0.json": {
+			quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: start.Add(time.Hour)}),
+			quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: start.Add(2 * time.Hour)}),
+		},
+		"openebs/cstor/Aug-13-2020-09:13:10-0.json": {
+			quaytest.NewLog(quaytest.LogConfig{Country: "US", Time: start}),
+		},
+	} {
+		raw, err := json.Marshal(gmetrics.LogList{Items: logs})
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		err = store.Put(key, raw)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+	}
+	// only the latest snapshot of a namespace is imported
+	for _, snapshot := range []gmetrics.Snapshot{
+		{
+			Namespace: "openebs",
+			Time:      start,
+			Repos:     []gmetrics.Popular{{Name: "jiva", Popularity: 1}},
+		},
+		{
+			Namespace: "openebs",
+			Time:      start.Add(24 * time.Hour),
+			Repos: []gmetrics.Popular{
+				{Name: "jiva", Popularity: 10},
+				{Name: "cstor", Popularity: 5},
+			},
+		},
+	} {
+		err := gmetrics.SaveSnapshot(store, snapshot)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+	}
+	for run, expect := range []int{4, 0} {
+		got, err := db.Import(store)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if got.RepoCount != 2 || got.LogCount != 5 || got.AddedCount != expect {
+			t.Fatalf("Run %d: Expected 2 repos, 5 logs & %d added got %+v", run, expect, got)
+		}
+		if got.SnapshotCount != 1 || got.PopularCount != 2 {
+			t.Fatalf("Run %d: Expected 1 snapshot of 2 repos got %+v", run, got)
+		}
+	}
+	popular, err := db.Popular("openebs")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(popular) != 2 || popular[0].Name != "jiva" || popular[0].Popularity != 10 {
+		t.Fatalf("Expected jiva followed by cstor got %+v", popular)
+	}
+	// repo is derived from the key when missing in the log
+	count, err := db.Count(logdb.Query{Repo: "cstor"})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("Expected 1 log of cstor got %d", count)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logdb
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// PurgeLogs removes the stored logs matched by the given function
+// along with their index entries. It returns the number of logs
+// removed. Logs are only counted when isDryRun is set.
+//
+// Logs are removed in a single transaction. Hence either all or none
+// of these are removed.
+func (db *DB) PurgeLogs(match func(gmetrics.Log) bool, isDryRun bool) (int, error) {
+	var removed int
+	purge := func(tx *bolt.Tx) error {
+		removed = 0
+		bucket := tx.Bucket(logsBucket)
+		matched := map[string]gmetrics.Log{}
+		err := bucket.ForEach(func(key, raw []byte) error {
+			var entry gmetrics.Log
+			err := json.Unmarshal(raw, &entry)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to unmarshal log %s", key)
+			}
+			if match(entry) {
+				matched[string(key)] = entry
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		removed = len(matched)
+		if isDryRun {
+			return nil
+		}
+		// NOTE:
+		//	Keys are deleted once iterated since bbolt does not allow
+		// to modify a bucket while iterating it
+		for key, entry := range matched {
+			err = bucket.Delete([]byte(key))
+			if err != nil {
+				return err
+			}
+			err = deleteIndexKeys(tx, entry, []byte(key))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var err error
+	if isDryRun {
+		err = db.bolt.View(purge)
+	} else {
+		err = db.bolt.Update(purge)
+	}
+	if err != nil {
+		return 0, errors.Wrapf(
+			err,
+			"Failed to purge logs: Path %q",
+			db.Path,
+		)
+	}
+	return removed, nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// Query selects logs. Empty fields match all logs.
+type Query struct {
+	Namespace string
+	Repo      string
+	Tag       string
+	Kind      gmetrics.LogKind
+	// Country is the ISO code of the country e.g. US as resolved by
+	// quay or else by the GeoIP enrichment
+	Country string
+	// Start is inclusive & End is exclusive. Logs whose datetime
+	// can not be parsed are not selected if either of these is set.
+	Start time.Time
+	End   time.Time
+	// Limit is the maximum number of logs selected. 0 selects all
+	// the matching logs.
+	Limit int
+}
+
+// isTimeRange returns true if this query selects a time range
+func (q Query) isTimeRange() bool {
+	return !q.Start.IsZero() || !q.End.IsZero()
+}
+
+// index returns the index & its value that is used to find the logs
+// of this query
+//
+// Indexes are preferred in the order of their selectivity. Datetime
+// index is used if none of the properties are set.
+func (q Query) index() (index, string) {
+	switch {
+	case q.Tag != "":
+		return tagIndex, q.Tag
+	case q.Repo != "":
+		return repoIndex, q.Repo
+	case q.Country != "":
+		return countryIndex, q.Country
+	case q.Kind != "":
+		return kindIndex, string(q.Kind)
+	case q.Namespace != "":
+		return namespaceIndex, q.Namespace
+	default:
+		return datetimeIndex, ""
+	}
+}
+
+// match returns true if the given log is selected by this query
+func (q Query) match(entry gmetrics.Log) bool {
+	return (q.Namespace == "" || q.Namespace == entry.Metadata.Namespace) &&
+		(q.Repo == "" || q.Repo == entry.Metadata.Repo) &&
+		(q.Tag == "" || q.Tag == entry.Metadata.Tag) &&
+		(q.Kind == "" || q.Kind == entry.Kind) &&
+		(q.Country == "" || q.Country == entry.Country())
+}
+
+// Logs returns the logs selected by the given query in the order of
+// their datetime
+func (db *DB) Logs(q Query) ([]gmetrics.Log, error) {
+	var out []gmetrics.Log
+	err := db.each(q, func(entry gmetrics.Log) {
+		out = append(out, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Count returns the number of logs selected by the given query
+func (db *DB) Count(q Query) (int, error) {
+	var count int
+	err := db.each(q, func(gmetrics.Log) {
+		count++
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// each invokes the given function for every log selected by the
+// given query
+//
+// The time range is resolved by the index itself since index keys
+// of a value are sorted by datetime. Remaining properties are
+// matched against the stored logs.
+func (db *DB) each(q Query, fn func(gmetrics.Log)) error {
+	i, value := q.index()
+	prefix := []byte(value + "\x00")
+	var endKey []byte
+	if !q.End.IsZero() {
+		endKey = []byte(q.End.UTC().Format(timeKeyFormat))
+	}
+	seek := prefix
+	if !q.Start.IsZero() {
+		seek = append(append([]byte{}, prefix...), q.Start.UTC().Format(timeKeyFormat)...)
+	}
+
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		logs := tx.Bucket(logsBucket)
+		var count int
+		c := tx.Bucket(i.bucket).Cursor()
+		for k, _ := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			rest := k[len(prefix):]
+			sep := bytes.IndexByte(rest, 0)
+			if sep < 0 {
+				continue
+			}
+			datetime, key := rest[:sep], rest[sep+1:]
+			if q.isTimeRange() && len(datetime) == 0 {
+				// datetime of this log can not be parsed
+				continue
+			}
+			if endKey != nil && bytes.Compare(datetime, endKey) >= 0 {
+				break
+			}
+			raw := logs.Get(key)
+			if raw == nil {
+				continue
+			}
+			var entry gmetrics.Log
+			err := json.Unmarshal(raw, &entry)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to unmarshal log %s", key)
+			}
+			if !q.match(entry) {
+				continue
+			}
+			fn(entry)
+			count++
+			if q.Limit > 0 && count >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to query logs: Path %q",
+			db.Path,
+		)
+	}
+	return nil
+}
+
+// Popular returns the stored repos of the given namespace in the
+// order of their popularity. Repos of all namespaces are returned
+// if the namespace is empty.
+func (db *DB) Popular(namespace string) ([]gmetrics.Popular, error) {
+	var out []gmetrics.Popular
+	prefix := []byte{}
+	if namespace != "" {
+		prefix = []byte(namespace + "/")
+	}
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(popularBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var repo gmetrics.Popular
+			err := json.Unmarshal(v, &repo)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to unmarshal repo %s", k)
+			}
+			out = append(out, repo)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to query repos: Namespace %q: Path %q",
+			namespace,
+			db.Path,
+		)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Popularity > out[j].Popularity
+	})
+	return out, nil
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// LogFileFormat is the format of the files of the downloaded logs.
+// It is the extension of these files as well.
+type LogFileFormat string
+
+const (
+	// FormatJSON stores every page of logs as returned by quay i.e.
+	// a LogList
+	FormatJSON LogFileFormat = "json"
+
+	// FormatNDJSON stores a log per line
+	FormatNDJSON LogFileFormat = "ndjson"
+
+	// FormatNDJSONGzip is FormatNDJSON compressed with gzip
+	FormatNDJSONGzip LogFileFormat = "ndjson.gz"
+
+	// FormatNDJSONZstd is FormatNDJSON compressed with zstd
+	FormatNDJSONZstd LogFileFormat = "ndjson.zst"
+)
+
+// LogFileFormats lists all the supported formats. Longer extensions
+// come first so that these are matched first.
+var LogFileFormats = []LogFileFormat{
+	FormatNDJSONGzip,
+	FormatNDJSONZstd,
+	FormatNDJSON,
+	FormatJSON,
+}
+
+// orFormatJSON returns FormatJSON if the given format is not set
+func orFormatJSON(format LogFileFormat) LogFileFormat {
+	if format == "" {
+		return FormatJSON
+	}
+	return format
+}
+
+// Compression is the compression of NDJSON files & streams
+type Compression string
+
+// Supported compressions
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// Compressions lists all the supported compressions
+var Compressions = []Compression{
+	CompressionNone,
+	CompressionGzip,
+	CompressionZstd,
+}
+
+// ParseCompression returns the Compression of the given name. Empty
+// name is same as CompressionNone.
+func ParseCompression(name string) (Compression, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return CompressionNone, nil
+	}
+	for _, c := range Compressions {
+		if string(c) == name {
+			return c, nil
+		}
+	}
+	return "", errors.Errorf(
+		"Unsupported compression %q: Supported compressions %v",
+		name,
+		Compressions,
+	)
+}
+
+// ParseLogFileFormat returns the LogFileFormat of the given format
+// i.e. json or ndjson & the given compression. Only NDJSON can be
+// compressed.
+func ParseLogFileFormat(format string, compression Compression) (LogFileFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", string(FormatJSON):
+		if compression != CompressionNone && compression != "" {
+			return "", errors.Errorf(
+				"Unsupported compression %q of format %q: Use %q",
+				compression,
+				FormatJSON,
+				FormatNDJSON,
+			)
+		}
+		return FormatJSON, nil
+	case string(FormatNDJSON):
+		switch compression {
+		case CompressionGzip:
+			return FormatNDJSONGzip, nil
+		case CompressionZstd:
+			return FormatNDJSONZstd, nil
+		default:
+			return FormatNDJSON, nil
+		}
+	default:
+		return "", errors.Errorf(
+			"Unsupported format %q: Supported formats %v",
+			format,
+			[]LogFileFormat{FormatJSON, FormatNDJSON},
+		)
+	}
+}
+
+// Compression returns the compression of this format
+func (f LogFileFormat) Compression() Compression {
+	switch f {
+	case FormatNDJSONGzip:
+		return CompressionGzip
+	case FormatNDJSONZstd:
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// LogFileFormatOf returns the format of the given file name or key.
+// It returns false if the name is not of a file of logs.
+func LogFileFormatOf(name string) (LogFileFormat, bool) {
+	for _, format := range LogFileFormats {
+		if strings.HasSuffix(name, "."+string(format)) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// EncodeLogList returns the content of a file of the given format
+// having the given logs. Only the logs are kept by NDJSON i.e. next
+// page & time range of the list are dropped.
+func EncodeLogList(list LogList, format LogFileFormat) ([]byte, error) {
+	if format == FormatJSON || format == "" {
+		return json.Marshal(list)
+	}
+	var b bytes.Buffer
+	w, err := NewCompressWriter(&b, format.Compression())
+	if err != nil {
+		return nil, err
+	}
+	err = WriteNDJSON(w, list.Items)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// DecodeLogList returns the logs of the given content of a file of
+// the given format
+func DecodeLogList(raw []byte, format LogFileFormat) (LogList, error) {
+	var out LogList
+	if format == FormatJSON || format == "" {
+		err := json.Unmarshal(raw, &out)
+		return out, err
+	}
+	r, err := newDecompressReader(bytes.NewReader(raw), format.Compression())
+	if err != nil {
+		return LogList{}, err
+	}
+	defer r.Close()
+	decoder := json.NewDecoder(r)
+	for {
+		var entry Log
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return LogList{}, err
+		}
+		out.Items = append(out.Items, entry)
+	}
+	return out, nil
+}
+
+// WriteLogList stores the given logs at the given key in the format
+// of the key's extension
+func WriteLogList(store storage.Storage, key string, list LogList) error {
+	format, _ := LogFileFormatOf(key)
+	raw, err := EncodeLogList(list, format)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to marshal logs of %s",
+			key,
+		)
+	}
+	return store.Put(key, raw)
+}
+
+// WriteNDJSON writes the given logs to the given writer; a log per
+// line
+func WriteNDJSON(w io.Writer, logs []Log) error {
+	b := bufio.NewWriter(w)
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	for _, entry := range logs {
+		err := encoder.Encode(entry)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to marshal log")
+		}
+	}
+	return b.Flush()
+}
+
+// NewCompressWriter returns a writer that compresses what is written
+// to it with the given compression. Close it to flush the compressed
+// content; the given writer is not closed.
+func NewCompressWriter(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	case CompressionNone, "":
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, errors.Errorf("Unsupported compression %q", compression)
+	}
+}
+
+// newDecompressReader returns a reader of the content of the given
+// reader compressed with the given compression
+func newDecompressReader(r io.Reader, compression Compression) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return ioutil.NopCloser(r), nil
+	}
+}
+
+// nopWriteCloser is a writer whose Close does nothing
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// LogStream writes logs as NDJSON to a writer e.g. stdout
+//
+// LogStream is safe for concurrent use. Logs of a call to Write are
+// written together.
+type LogStream struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewLogStream returns a new instance of LogStream that writes to
+// the given writer
+func NewLogStream(w io.Writer) *LogStream {
+	return &LogStream{w: w}
+}
+
+// Write writes the given logs to this stream
+func (s *LogStream) Write(logs []Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return WriteNDJSON(s.w, logs)
+}
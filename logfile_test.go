@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+func TestParseLogFileFormat(t *testing.T) {
+	var tests = map[string]struct {
+		format      string
+		compression gmetrics.Compression
+		expect      gmetrics.LogFileFormat
+		isErr       bool
+	}{
+		"default": {
+			expect: gmetrics.FormatJSON,
+		},
+		"ndjson": {
+			format:      "ndjson",
+			compression: gmetrics.CompressionNone,
+			expect:      gmetrics.FormatNDJSON,
+		},
+		"ndjson with gzip": {
+			format:      "NDJSON",
+			compression: gmetrics.CompressionGzip,
+			expect:      gmetrics.FormatNDJSONGzip,
+		},
+		"ndjson with zstd": {
+			format:      "ndjson",
+			compression: gmetrics.CompressionZstd,
+			expect:      gmetrics.FormatNDJSONZstd,
+		},
+		"json with gzip": {
+			format:      "json",
+			compression: gmetrics.CompressionGzip,
+			isErr:       true,
+		},
+		"unknown format": {
+			format: "csv",
+			isErr:  true,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			got, err := gmetrics.ParseLogFileFormat(mock.format, mock.compression)
+			if mock.isErr {
+				if err == nil {
+					t.Fatalf("Expected error got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if got != mock.expect {
+				t.Fatalf("Expected %q got %q", mock.expect, got)
+			}
+		})
+	}
+}
+
+func TestEncodeLogList(t *testing.T) {
+	list := gmetrics.LogList{Items: newPullLogs("openebs", "jiva", now, 3)}
+	for _, format := range gmetrics.LogFileFormats {
+		format := format
+		t.Run(string(format), func(t *testing.T) {
+			raw, err := gmetrics.EncodeLogList(list, format)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if format == gmetrics.FormatNDJSON && bytes.Count(raw, []byte("\n")) != 3 {
+				t.Fatalf("Expected a log per line got %s", raw)
+			}
+			got, err := gmetrics.DecodeLogList(raw, format)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if len(got.Items) != 3 || got.Items[2].IP != list.Items[2].IP {
+				t.Fatalf("Expected 3 logs got %+v", got.Items)
+			}
+		})
+	}
+}
+
+func TestLogWritesNDJSON(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(30)
+	defer server.Close()
+
+	config := gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now),
+		Format:        gmetrics.FormatNDJSONZstd,
+	}
+	var counts []int
+	for run := 0; run < 2; run++ {
+		logger, err := gmetrics.NewLogger(config)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		got, err := logger.Log()
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		counts = append(counts, len(got.Items))
+		config.Clock = quaytest.NewClock(now.Add(5 * time.Minute))
+	}
+	// logs stored as ndjson are not stored again
+	if counts[0] != 30 || counts[1] != 0 {
+		t.Fatalf("Expected 30 & 0 logs got %v", counts)
+	}
+	keys, err := gmetrics.ListJSONKeys(store, "")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(keys) != 2 || !strings.HasSuffix(keys[0], ".ndjson.zst") {
+		t.Fatalf("Expected 2 ndjson.zst files got %v", keys)
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(repos) != 1 || len(repos[0].Items) != 30 {
+		t.Fatalf("Expected 30 logs of jiva got %+v", repos)
+	}
+}
+
+func TestLogStream(t *testing.T) {
+	server := newLogsServer(25)
+	defer server.Close()
+
+	var b bytes.Buffer
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:   server.URL,
+		Namespace: "openebs",
+		Name:      "jiva",
+		Stream:    gmetrics.NewLogStream(&b),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := gmetrics.DecodeLogList(b.Bytes(), gmetrics.FormatNDJSON)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got.Items) != 25 {
+		t.Fatalf("Expected 25 streamed logs got %d", len(got.Items))
+	}
+}
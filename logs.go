@@ -19,19 +19,20 @@ package growthmetrics
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"os"
-	"os/exec"
 	"path"
-	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/mayadata.io/quay-logs/storage"
 	"github.com/pkg/errors"
 )
 
 // LoggableConfig is used to initialise a Loggable instance
 type LoggableConfig struct {
+	// QuayURL is the base URL of the quay instance; defaults to
+	// DefaultQuayURL when empty
+	QuayURL            string
 	Namespace          string
 	Name               string
 	AuthToken          string
@@ -39,13 +40,59 @@ type LoggableConfig struct {
 	IsWriteToFile      bool
 	Debug              bool
 	Windows            bool
+	// StartTime & EndTime optionally restrict the logs to the given
+	// date range. Both are inclusive & only their dates are
+	// considered. Quay defaults to the last week when these are not
+	// set.
+	StartTime time.Time
+	EndTime   time.Time
+	// Since is the high water mark of this repo. Logs before this
+	// time are considered to be fetched earlier & are neither
+	// written nor returned. Paging stops once such logs are found.
+	Since time.Time
+	// Seen has the fingerprints of the logs at Since that were
+	// fetched earlier. Other logs of the same second are new. The
+	// fingerprints are of the logs with their IPs anonymized.
+	Seen []string
+	// Clock is used to name the files. Defaults to SystemClock.
+	Clock Clock
+	// Storage stores the logs when IsWriteToFile is set. Defaults
+	// to local files at BaseOutputFilePath.
+	Storage storage.Storage
+	// Kinds restricts the logs to the given kinds. Logs of all kinds
+	// are fetched by default.
+	//
+	// Quay's logs API does not filter by kind. Hence logs of other
+	// kinds are dropped once these are received & are neither
+	// stored nor returned.
+	Kinds []LogKind
+	// GeoLookup when set fills Geo of the logs before these are
+	// stored & returned
+	GeoLookup GeoLookup
+	// Anonymizer when set anonymizes the IPs of the logs before
+	// these are stored & returned. Logs are enriched before their
+	// IPs are anonymized.
+	Anonymizer *Anonymizer
+	// Format is the format of the stored files. Defaults to
+	// FormatJSON i.e. pages of logs as returned by quay.
+	Format LogFileFormat
+	// Stream when set gets the new logs as NDJSON e.g. to write
+	// these to stdout. It is independent of IsWriteToFile.
+	Stream *LogStream
+	// Purged when set matches the raw IPs that were purged earlier.
+	// Logs of these IPs are neither stored nor returned. Refer
+	// LoadPurgedIPs.
+	Purged *IPMatcher
 }
 
 // LoggableOption is a typed function to mutate Loggable instance
 type LoggableOption func(*Loggable) error
 
 // Loggable fetches image logs by invoking quay.io APIs
+//
+// Loggable is safe for concurrent use.
 type Loggable struct {
+	QuayURL            string
 	Namespace          string
 	Name               string
 	AuthToken          string
@@ -53,50 +100,66 @@ type Loggable struct {
 	IsWriteToFile      bool
 	Debug              bool
 	Windows            bool
-	//the value for next three will be assigned in Log()
-	currentLogs     []byte
-	currentFileName string
-	fileNamePath    string
+	StartTime          time.Time
+	EndTime            time.Time
+	Since              time.Time
+	Seen               []string
+	Clock              Clock
+	Storage            storage.Storage
+	Kinds              []LogKind
+	GeoLookup          GeoLookup
+	Anonymizer         *Anonymizer
+	Format             LogFileFormat
+	Stream             *LogStream
+	Purged             *IPMatcher
+	// fetched has the logs fetched by this instance
+	fetched *LogIndex
+	// stored counts the logs stored in the folder of this repo
+	stored *logCounts
+	// seen counts the logs at Since that were fetched earlier
+	seen *logCounts
+	// newest is the datetime of the newest log received from quay
+	newest time.Time
+	// newestSeen has the fingerprints of the logs received at newest
+	newestSeen []string
+	mu         sync.Mutex
 }
 
 // NewLogger returns a new instance of Loggable
-// It creates a new folder by the mkdir command using the arguments
-// passed to it for each of the repos.
+// It loads the logs stored earlier for the repo so that these are
+// not stored again.
 func NewLogger(config LoggableConfig) (*Loggable, error) {
-	folder := path.Join(
-		config.BaseOutputFilePath,
-		config.Namespace,
-		config.Name,
-		//example: ../logs/namespace/reponame/
-	)
-	if config.Windows == true {
-		// since windows doesn't support '\'
-		p := filepath.FromSlash(folder)
-		if config.Debug == true {
-			fmt.Println("Creating folders: " + p)
-		}
-		err := os.MkdirAll(p, 0755)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		// this block is for linux. Supports '/' filepath systems
-		cmd := exec.Command(
-			"mkdir",
-			"-p",
-			folder,
+	if !config.StartTime.IsZero() &&
+		!config.EndTime.IsZero() &&
+		config.StartTime.After(config.EndTime) {
+		return nil, errors.Errorf(
+			"Invalid date range: Start %s is after end %s",
+			config.StartTime.Format(ISODateFormat),
+			config.EndTime.Format(ISODateFormat),
 		)
-		err := cmd.Run()
+	}
+	store := config.Storage
+	if config.IsWriteToFile && store == nil {
+		// logs are stored at ../logs/namespace/reponame/ by default
+		store = storage.NewLocal(config.BaseOutputFilePath)
+	}
+
+	var err error
+	stored := newLogCounts(nil)
+	if config.IsWriteToFile {
+		prefix := path.Join(config.Namespace, config.Name) + "/"
+		stored, err = loadLogCounts(store, prefix)
 		if err != nil {
 			return nil, errors.Wrapf(
 				err,
-				"Failed to create repo logs folder: Name %q",
-				folder,
+				"Failed to load stored logs: Prefix %q",
+				prefix,
 			)
 		}
 	}
 
 	return &Loggable{
+		QuayURL:            config.QuayURL,
 		AuthToken:          config.AuthToken,
 		Namespace:          config.Namespace,
 		Name:               config.Name,
@@ -104,15 +167,30 @@ func NewLogger(config LoggableConfig) (*Loggable, error) {
 		IsWriteToFile:      config.IsWriteToFile,
 		Debug:              config.Debug,
 		Windows:            config.Windows,
+		StartTime:          config.StartTime,
+		EndTime:            config.EndTime,
+		Since:              config.Since,
+		Seen:               config.Seen,
+		Clock:              orSystemClock(config.Clock),
+		Storage:            store,
+		Kinds:              config.Kinds,
+		GeoLookup:          config.GeoLookup,
+		Anonymizer:         config.Anonymizer,
+		Format:             orFormatJSON(config.Format),
+		Stream:             config.Stream,
+		Purged:             config.Purged,
+		fetched:            NewLogIndex(),
+		stored:             stored,
+		seen:               newLogCounts(config.Seen),
 	}, nil
 }
 
 // Log requests for logs by invoking API and subsequently
 // writes them to files.
 //
-//  It calls `RequestLogsForPageToken( )` to get the logs from
-// the Quay API. It stores them in separate files by calling
-// `WriteToFile` internally.
+// It calls `RequestLogsForPageToken( )` to get the logs from
+// the Quay API. It stores them in separate files of the storage
+// at `namespace/reponame/filename.json` or `.ndjson` as per Format.
 // --Here next page is available since the API returns 20 `logs`
 // at once. So each files can contain at max 20 `logs`.
 func (l *Loggable) Log() (LogList, error) {
@@ -124,10 +202,10 @@ func (l *Loggable) Log() (LogList, error) {
 
 	// File names for all downloads need to have same prefix
 	// Variable 'now' defines this prefix
-	var now = time.Now().Format("Jan-02-2006-15:04:05")
+	var now = orSystemClock(l.Clock).Now().Format("Jan-02-2006-15:04:05")
 	if l.Windows == true {
 		// since windows doesn't support ':'
-		now = time.Now().Format("Jan-02-2006-15-04-05")
+		now = orSystemClock(l.Clock).Now().Format("Jan-02-2006-15-04-05")
 	}
 	for isNextpage {
 		// Set or reset filename
@@ -138,29 +216,24 @@ func (l *Loggable) Log() (LogList, error) {
 		// NOTE:
 		//	Logs is a list API call that is paged. Each page can
 		// optionally be saved to a new file.
-		filename := fmt.Sprintf("%s-%d.json", now, index)
-		// creating relative foldername,
-		folderPath := path.Join(l.BaseOutputFilePath, l.Namespace, l.Name)
-		if l.Windows == true {
-			l.fileNamePath = filepath.FromSlash(folderPath)
-		} else {
-			l.fileNamePath = ""
-		}
-
-		// creating relative filename
-		jsonPath := path.Join(folderPath, filename)
-		if l.Windows == true {
-			l.currentFileName = filepath.FromSlash(jsonPath)
-		} else {
-			l.currentFileName = jsonPath
-		}
+		filename := fmt.Sprintf("%s-%d.%s", now, index, l.Format)
+		// creating the storage key of this page
+		//
+		// NOTE:
+		//	Keys are local to this call & not stored in Loggable.
+		// This makes Loggable safe to be used from several goroutines.
+		//
+		// NOTE:
+		//	Keys are always slash separated. Local storage converts
+		// these to the file paths of the OS.
+		key := path.Join(l.Namespace, l.Name, filename)
 
 		// Invoke API to request for logs
 		//
 		// NOTE:
 		//	This will run through a set of post functions if set,
 		// after executing this API
-		got, err := l.RequestLogsForPageToken(pagetoken)
+		got, err := l.RequestLogsForPageToken(pagetoken, key)
 		if err != nil {
 			return LogList{}, err
 		}
@@ -177,9 +250,9 @@ func (l *Loggable) Log() (LogList, error) {
 // RequestLogsForPageToken lists the logs of the images belonging
 // to a namespace. It Creates a HTTPRequest with some query parameters
 // and invokes it.
-// -- Since `IsWriteToFile` is true here so it calls `WriteToFile`
-// and the JSON is unmarshaled and returned.
-func (l *Loggable) RequestLogsForPageToken(pagetoken string) (LogList, error) {
+// -- If `IsWriteToFile` is true it puts the logs into the storage
+// at the given key and the JSON is unmarshaled and returned.
+func (l *Loggable) RequestLogsForPageToken(pagetoken string, key string) (LogList, error) {
 	if l.Debug {
 		log.Printf(
 			"Will request logs: Namespace %q: Name %q: Page Token %q",
@@ -190,7 +263,7 @@ func (l *Loggable) RequestLogsForPageToken(pagetoken string) (LogList, error) {
 	}
 	req := &HTTPRequest{
 		AuthToken: l.AuthToken,
-		URL:       "https://quay.io/api/v1/repository/{namespace}/{name}/logs",
+		URL:       QuayAPIURL(l.QuayURL, "repository/{namespace}/{name}/logs"),
 		Method:    GET,
 		QueryParams: map[string]string{
 			"next_page": pagetoken,
@@ -200,6 +273,12 @@ func (l *Loggable) RequestLogsForPageToken(pagetoken string) (LogList, error) {
 			"name":      l.Name,
 		},
 	}
+	if !l.StartTime.IsZero() {
+		req.QueryParams["starttime"] = l.StartTime.UTC().Format(QuayQueryDateFormat)
+	}
+	if !l.EndTime.IsZero() {
+		req.QueryParams["endtime"] = l.EndTime.UTC().Format(QuayQueryDateFormat)
+	}
 	resp, err := req.Invoke()
 	if err != nil {
 		return LogList{}, errors.Wrapf(
@@ -209,60 +288,279 @@ func (l *Loggable) RequestLogsForPageToken(pagetoken string) (LogList, error) {
 			l.Name,
 		)
 	}
-	if resp.StatusCode() != 200 {
-		log.Printf(
-			"Logs response: Namespace %q: Name %q: StatusCode %d: Error %q",
+	err = checkResponse(resp)
+	if err != nil {
+		return LogList{}, errors.Wrapf(
+			err,
+			"Failed to request logs: Namespace %q: Name %q",
 			l.Namespace,
 			l.Name,
-			resp.StatusCode(),
-			resp.Header().Get("error"),
 		)
-		return LogList{}, nil
 	}
-	if l.Debug {
-		log.Printf("Writing file: ---------------> " + l.currentFileName)
+	var out LogList
+	err = json.Unmarshal(resp.Body(), &out)
+	if err != nil {
+		return LogList{}, errors.Wrapf(
+			err,
+			"Failed to unmarshal logs to LogList",
+		)
+	}
+	err = l.verifyDateRange(out)
+	if err != nil {
+		return LogList{}, err
+	}
+	// NOTE:
+	//	This is done before the logs are filtered since the high
+	// water mark tells the logs that were received
+	l.receive(out)
+	raw := resp.Body()
+	// isChanged is set when the received logs are trimmed,
+	// enriched or anonymized & need to be marshaled again
+	var isChanged bool
+	if !l.Since.IsZero() {
+		fresh, isSeen := l.dropSeenLogs(out.Items)
+		if isSeen {
+			// older logs were fetched by a previous run, hence there
+			// is no need to request further pages
+			out.Items = fresh
+			out.NextPage = ""
+			isChanged = true
+		}
+	}
+	if len(l.Kinds) > 0 {
+		// NOTE:
+		//	This is done after checking the high water mark since
+		// logs of any kind tell that the older pages were fetched
+		wanted := FilterKinds(out.Items, l.Kinds)
+		if len(wanted) != len(out.Items) {
+			out.Items = wanted
+			isChanged = true
+		}
+	}
+	if l.Purged != nil {
+		kept := dropPurgedLogs(out.Items, l.Purged)
+		if len(kept) != len(out.Items) {
+			out.Items = kept
+			isChanged = true
+		}
 	}
 	if l.IsWriteToFile {
-		err = l.WriteToFile(resp.Body(), l.currentFileName, l.fileNamePath)
+		// NOTE:
+		//	This is done before anonymizing since distinct logs may
+		// share their anonymized IPs
+		unique := l.dropStoredLogs(out.Items)
+		if len(unique) != len(out.Items) {
+			out.Items = unique
+			isChanged = true
+		}
+	}
+	if l.GeoLookup != nil && len(out.Items) > 0 {
+		enriched, err := Enrich(out.Items, l.GeoLookup)
 		if err != nil {
 			return LogList{}, errors.Wrapf(
 				err,
-				"Failed to write logs to %s",
-				l.currentFileName,
+				"Failed to enrich logs: Namespace %q: Name %q",
+				l.Namespace,
+				l.Name,
 			)
 		}
-		log.Printf("Sucessfully wrote logs to file --------------> " + l.currentFileName)
+		if enriched.EnrichedCount > 0 {
+			isChanged = true
+		}
 	}
-	var out LogList
-	err = json.Unmarshal(resp.Body(), &out)
-	if err != nil {
-		return LogList{}, errors.Wrapf(
-			err,
-			"Failed to unmarshal logs to LogList",
-		)
+	if l.Anonymizer != nil && l.Anonymizer.Anonymize(out.Items) > 0 {
+		isChanged = true
+	}
+	if l.Format != FormatJSON {
+		// only json files have the page as returned by quay
+		isChanged = true
+	}
+	if isChanged {
+		if len(out.Items) == 0 {
+			if l.Debug {
+				log.Printf(
+					"No new logs: Namespace %q: Name %q: Page Token %q",
+					l.Namespace,
+					l.Name,
+					pagetoken,
+				)
+			}
+			return out, nil
+		}
+		raw, err = EncodeLogList(out, l.Format)
+		if err != nil {
+			return LogList{}, errors.Wrapf(
+				err,
+				"Failed to marshal new logs",
+			)
+		}
+	}
+	if l.Stream != nil {
+		err = l.Stream.Write(out.Items)
+		if err != nil {
+			return LogList{}, errors.Wrapf(
+				err,
+				"Failed to stream logs: Namespace %q: Name %q",
+				l.Namespace,
+				l.Name,
+			)
+		}
+	}
+	if l.Debug && l.IsWriteToFile {
+		log.Printf("Writing file: ---------------> " + key)
+	}
+	if l.IsWriteToFile {
+		err = l.Storage.Put(key, raw)
+		if err != nil {
+			return LogList{}, errors.Wrapf(
+				err,
+				"Failed to write logs to %s",
+				key,
+			)
+		}
+		log.Printf("Sucessfully wrote logs to file --------------> " + key)
 	}
 	return out, nil
 }
 
-// WriteToFile creates a file with images having popularity ratings.
-// This file is named with today's date.
-// It writes the content of response body into passed filename with
-// file mode 0644. It stores the logs into
-// `./logs/namespace/reponame/filename.json`
-func (l *Loggable) WriteToFile(raw []byte, filename string, fpath string) error {
-	if fpath != "" {
-		if _, err := os.Stat(filename); os.IsNotExist(err) {
-			os.MkdirAll(fpath, 0700) // Create your file
+// Newest returns the datetime of the newest log received from quay
+// by this instance & the fingerprints of the logs received at that
+// second. Logs dropped by the filters are considered too. Zero time
+// is returned if no log was received.
+//
+// These are meant to be the Since & Seen of the next fetch.
+func (l *Loggable) Newest() (time.Time, []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.newest, append([]string(nil), l.newestSeen...)
+}
+
+// receive records the newest of the given logs
+func (l *Loggable) receive(got LogList) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, entry := range got.Items {
+		t, err := entry.Time()
+		if err != nil || t.Before(l.newest) {
+			continue
+		}
+		if t.After(l.newest) {
+			l.newest = t
+			l.newestSeen = nil
 		}
+		l.newestSeen = append(l.newestSeen, l.storedFingerprint(entry))
 	}
+}
 
-	errfile := ioutil.WriteFile(filename, raw, 0644)
-	if errfile != nil {
-		return errors.Wrapf(
-			errfile,
-			"Failed to write filename to %s",
-			filename,
-		)
+// dropPurgedLogs returns the logs whose IPs are not matched by the
+// given matcher
+func dropPurgedLogs(logs []Log, purged *IPMatcher) []Log {
+	var kept []Log
+	for _, entry := range logs {
+		if entry.IP != "" && purged.Match(entry.IP) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// dropStoredLogs returns the logs that are not yet stored in the
+// folder of this repo. The given logs are expected to have their
+// raw IPs.
+//
+// Each stored log matches a single fetched log since the stored
+// logs of distinct events may share an anonymized IP.
+func (l *Loggable) dropStoredLogs(logs []Log) []Log {
+	var unique []Log
+	for _, entry := range logs {
+		if !l.fetched.Add(entry) {
+			continue
+		}
+		if l.stored.take(l.storedFingerprint(entry)) {
+			continue
+		}
+		unique = append(unique, entry)
+	}
+	return unique
+}
+
+// storedFingerprint returns the fingerprint of the given log as it
+// gets stored i.e. with its IP anonymized
+func (l *Loggable) storedFingerprint(entry Log) string {
+	if l.Anonymizer != nil {
+		entry.IP = l.Anonymizer.AnonymizeIP(entry.IP)
+	}
+	return entry.Fingerprint()
+}
+
+// dropSeenLogs returns the logs that were not fetched earlier. It
+// also returns true if any of the given logs is older than the high
+// water mark i.e. Since.
+//
+// Logs at Since are new unless these are Seen since quay logs have
+// a resolution of a second. Logs whose datetime can not be parsed
+// are considered as new.
+func (l *Loggable) dropSeenLogs(logs []Log) ([]Log, bool) {
+	var fresh []Log
+	var isSeen bool
+	for _, entry := range logs {
+		t, err := entry.Time()
+		if err == nil && t.Before(l.Since) {
+			isSeen = true
+			continue
+		}
+		if err == nil && t.Equal(l.Since) &&
+			l.seen.take(l.storedFingerprint(entry)) {
+			continue
+		}
+		fresh = append(fresh, entry)
+	}
+	return fresh, isSeen
+}
+
+// verifyDateRange verifies if the date range of the given logs
+// honours the requested date range
+//
+// Quay falls back to its defaults when it can not parse the
+// requested dates. This check avoids treating those logs as the
+// requested ones.
+func (l *Loggable) verifyDateRange(got LogList) error {
+	if l.StartTime.IsZero() && l.EndTime.IsZero() {
+		return nil
+	}
+	if !l.StartTime.IsZero() && got.StartTime != "" {
+		start, err := ParseQuayTime(got.StartTime)
+		if err != nil {
+			return err
+		}
+		if start.Before(truncateToDay(l.StartTime)) {
+			return errors.Errorf(
+				"Logs start at %s before requested start date %s: Namespace %q: Name %q",
+				got.StartTime,
+				l.StartTime.Format(ISODateFormat),
+				l.Namespace,
+				l.Name,
+			)
+		}
+	}
+	if !l.EndTime.IsZero() && got.EndTime != "" {
+		end, err := ParseQuayTime(got.EndTime)
+		if err != nil {
+			return err
+		}
+		// quay includes the whole of the requested end date
+		if end.After(truncateToDay(l.EndTime).AddDate(0, 0, 1)) {
+			return errors.Errorf(
+				"Logs end at %s after requested end date %s: Namespace %q: Name %q",
+				got.EndTime,
+				l.EndTime.Format(ISODateFormat),
+				l.Namespace,
+				l.Name,
+			)
+		}
 	}
 	return nil
 }
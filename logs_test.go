@@ -0,0 +1,456 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// now is the time of the fake clock used by these tests
+var now = time.Date(2020, 8, 13, 9, 13, 10, 0, time.UTC)
+
+// newPullLogs returns the given number of pull logs of the given
+// repo that are an hour apart starting from the given time
+func newPullLogs(namespace string, name string, from time.Time, count int) []gmetrics.Log {
+	var out []gmetrics.Log
+	for i := 0; i < count; i++ {
+		out = append(out, gmetrics.Log{
+			IP:       fmt.Sprintf("10.0.0.%d", i%250),
+			Kind:     "pull_repo",
+			Datetime: from.Add(time.Duration(i) * time.Hour).Format(gmetrics.QuayTimeFormat),
+			Metadata: gmetrics.Metadata{
+				Namespace: namespace,
+				Repo:      name,
+				Tag:       "latest",
+			},
+		})
+	}
+	return out
+}
+
+// newLogsServer returns a fake quay server with a repo that has the
+// given number of logs
+func newLogsServer(count int) *quaytest.Server {
+	server := quaytest.NewServer(quaytest.ServerConfig{
+		Clock: quaytest.NewClock(now),
+	})
+	server.AddRepo(
+		"openebs",
+		gmetrics.Popular{Name: "jiva"},
+		newPullLogs("openebs", "jiva", now.Add(-72*time.Hour), count)...,
+	)
+	return server
+}
+
+func TestLogWritesEveryPageToFile(t *testing.T) {
+	dir := newTempDir(t, nil)
+	defer os.RemoveAll(dir)
+	server := newLogsServer(45)
+	defer server.Close()
+
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:            server.URL,
+		Namespace:          "openebs",
+		Name:               "jiva",
+		BaseOutputFilePath: dir,
+		IsWriteToFile:      true,
+		Clock:              quaytest.NewClock(now),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got.Items) != 45 {
+		t.Fatalf("Expected 45 logs got %d", len(got.Items))
+	}
+	for index := 0; index < 3; index++ {
+		filename := filepath.Join(
+			dir,
+			"openebs",
+			"jiva",
+			fmt.Sprintf("Aug-13-2020-09:13:10-%d.json", index),
+		)
+		if _, err := os.Stat(filename); err != nil {
+			t.Fatalf("Expected logs file got %v", err)
+		}
+	}
+}
+
+func TestLogWritesToStorage(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(25)
+	defer server.Close()
+
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(repos) != 1 || repos[0].Name != "jiva" || len(repos[0].Items) != 25 {
+		t.Fatalf("Expected 25 logs of jiva got %+v", repos)
+	}
+}
+
+func TestLogKinds(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(25)
+	defer server.Close()
+	var pushes []gmetrics.Log
+	for _, entry := range newPullLogs("openebs", "jiva", now.Add(-80*time.Hour), 3) {
+		entry.Kind = gmetrics.KindPushRepo
+		pushes = append(pushes, entry)
+	}
+	server.AddLogs("openebs", "jiva", pushes...)
+
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now),
+		Kinds:         []gmetrics.LogKind{gmetrics.KindPushRepo},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got.Items) != 3 {
+		t.Fatalf("Expected 3 push logs got %d", len(got.Items))
+	}
+	// logs of other kinds are not stored
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(repos) != 1 || len(repos[0].Items) != 3 {
+		t.Fatalf("Expected 3 stored push logs got %+v", repos)
+	}
+	for _, entry := range repos[0].Items {
+		if entry.Kind != gmetrics.KindPushRepo {
+			t.Fatalf("Expected kind %q got %q", gmetrics.KindPushRepo, entry.Kind)
+		}
+	}
+}
+
+func TestLogDateRange(t *testing.T) {
+	server := newLogsServer(48)
+	defer server.Close()
+
+	start := time.Date(2020, 8, 11, 0, 0, 0, 0, time.UTC)
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:   server.URL,
+		Namespace: "openebs",
+		Name:      "jiva",
+		StartTime: start,
+		EndTime:   start,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	// logs start at 09:13:10 of Aug 10 & are an hour apart
+	if len(got.Items) != 24 {
+		t.Fatalf("Expected 24 logs got %d", len(got.Items))
+	}
+	query := server.Requests()[0].Query
+	if query.Get("starttime") != "08/11/2020" || query.Get("endtime") != "08/11/2020" {
+		t.Fatalf("Expected date range query got %v", query)
+	}
+}
+
+func TestNewLoggerInvalidDateRange(t *testing.T) {
+	_, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		Namespace: "openebs",
+		Name:      "jiva",
+		StartTime: now,
+		EndTime:   now.AddDate(0, 0, -1),
+	})
+	if err == nil {
+		t.Fatalf("Expected error got none")
+	}
+}
+
+func TestLogSince(t *testing.T) {
+	// newest 5 logs are newer than the log at since
+	since := now.Add(-72 * time.Hour).Add(39 * time.Hour)
+	seen := newPullLogs("openebs", "jiva", now.Add(-72*time.Hour), 40)[39]
+	// another pull of the same second is not seen yet
+	unseen := seen
+	unseen.IP = "10.0.1.1"
+
+	var tests = map[string]struct {
+		seen   []string
+		expect int
+	}{
+		"logs at since are new unless seen": {
+			expect: 7,
+		},
+		"seen logs at since are dropped": {
+			seen:   []string{seen.Fingerprint()},
+			expect: 6,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			server := newLogsServer(45)
+			defer server.Close()
+			server.AddLogs("openebs", "jiva", unseen)
+
+			logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+				QuayURL:   server.URL,
+				Namespace: "openebs",
+				Name:      "jiva",
+				Since:     since,
+				Seen:      mock.seen,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			got, err := logger.Log()
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if len(got.Items) != mock.expect {
+				t.Fatalf("Expected %d logs got %d", mock.expect, len(got.Items))
+			}
+			if len(server.Requests()) != 1 {
+				t.Fatalf("Expected paging to stop after 1 request got %d", len(server.Requests()))
+			}
+			newest, newestSeen := logger.Newest()
+			if !newest.Equal(now.Add(-28*time.Hour)) || len(newestSeen) != 1 {
+				t.Fatalf("Expected newest log at %s got %s %v", now.Add(-28*time.Hour), newest, newestSeen)
+			}
+		})
+	}
+}
+
+func TestLogStoresEachLogOnce(t *testing.T) {
+	dir := newTempDir(t, nil)
+	defer os.RemoveAll(dir)
+	server := newLogsServer(30)
+	defer server.Close()
+
+	config := gmetrics.LoggableConfig{
+		QuayURL:            server.URL,
+		Namespace:          "openebs",
+		Name:               "jiva",
+		BaseOutputFilePath: dir,
+		IsWriteToFile:      true,
+		Clock:              quaytest.NewClock(now),
+	}
+	var counts []int
+	for run := 0; run < 2; run++ {
+		logger, err := gmetrics.NewLogger(config)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		got, err := logger.Log()
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		counts = append(counts, len(got.Items))
+		config.Clock = quaytest.NewClock(now.Add(5 * time.Minute))
+	}
+	if counts[0] != 30 || counts[1] != 0 {
+		t.Fatalf("Expected 30 & 0 logs got %v", counts)
+	}
+	files, err := gmetrics.NewFolder(gmetrics.FolderConfig{
+		Path: filepath.Join(dir, "openebs", "jiva"),
+	}).ListJSONFiles()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files got %v", files)
+	}
+}
+
+func TestLogStoresSameSecondPullsAnonymized(t *testing.T) {
+	var tests = map[string]struct {
+		mode gmetrics.IPPrivacy
+	}{
+		"drop":     {mode: gmetrics.IPPrivacyDrop},
+		"truncate": {mode: gmetrics.IPPrivacyTruncate},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			// pulls of the same second from IPs of the same /24 look
+			// alike once anonymized
+			pulls := newPullLogs("openebs", "jiva", now.Add(-time.Hour), 1)
+			for i := 1; i < 3; i++ {
+				pull := pulls[0]
+				pull.IP = fmt.Sprintf("10.0.0.%d", i)
+				pulls = append(pulls, pull)
+			}
+			server := quaytest.NewServer(quaytest.ServerConfig{
+				Clock: quaytest.NewClock(now),
+			})
+			defer server.Close()
+			server.AddRepo("openebs", gmetrics.Popular{Name: "jiva"}, pulls...)
+
+			a, err := gmetrics.NewAnonymizer(mock.mode, nil)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			store := storage.NewMemory()
+			config := gmetrics.LoggableConfig{
+				QuayURL:       server.URL,
+				Namespace:     "openebs",
+				Name:          "jiva",
+				IsWriteToFile: true,
+				Storage:       store,
+				Anonymizer:    a,
+				Clock:         quaytest.NewClock(now),
+			}
+			var counts []int
+			for run := 0; run < 2; run++ {
+				logger, err := gmetrics.NewLogger(config)
+				if err != nil {
+					t.Fatalf("Expected no error got %v", err)
+				}
+				got, err := logger.Log()
+				if err != nil {
+					t.Fatalf("Expected no error got %v", err)
+				}
+				counts = append(counts, len(got.Items))
+				config.Clock = quaytest.NewClock(now.Add(5 * time.Minute))
+			}
+			if counts[0] != 3 || counts[1] != 0 {
+				t.Fatalf("Expected 3 & 0 logs got %v", counts)
+			}
+			repos, err := gmetrics.ReadRepoLogs(store, false)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if len(repos) != 1 || len(repos[0].Items) != 3 {
+				t.Fatalf("Expected 3 stored logs got %+v", repos)
+			}
+			for _, entry := range repos[0].Items {
+				if entry.IP == "10.0.0.1" || entry.IP == "10.0.0.2" {
+					t.Fatalf("Expected anonymized IPs got %q", entry.IP)
+				}
+			}
+		})
+	}
+}
+
+func TestLogErrors(t *testing.T) {
+	var tests = map[string]struct {
+		name    string
+		failure *quaytest.Failure
+		check   func(error) bool
+	}{
+		"missing repo": {
+			name: "missing",
+			check: func(err error) bool {
+				var target *gmetrics.NotFoundError
+				return errors.As(err, &target)
+			},
+		},
+		"insufficient scope": {
+			name: "jiva",
+			failure: &quaytest.Failure{
+				StatusCode: http.StatusForbidden,
+			},
+			check: func(err error) bool {
+				var target *gmetrics.ForbiddenError
+				return errors.As(err, &target)
+			},
+		},
+		"server error after retries": {
+			name: "jiva",
+			failure: &quaytest.Failure{
+				StatusCode: http.StatusInternalServerError,
+				Times:      -1,
+			},
+			check: func(err error) bool {
+				var target *gmetrics.ServerError
+				return errors.As(err, &target)
+			},
+		},
+		"malformed response": {
+			name: "jiva",
+			failure: &quaytest.Failure{
+				StatusCode: http.StatusOK,
+				Body:       `{"logs": [`,
+			},
+			check: func(err error) bool {
+				var target *gmetrics.APIError
+				return err != nil && !errors.As(err, &target)
+			},
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			server := newLogsServer(1)
+			defer server.Close()
+			if mock.failure != nil {
+				server.Fail(*mock.failure)
+			}
+
+			logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+				QuayURL:   server.URL,
+				Namespace: "openebs",
+				Name:      mock.name,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			_, err = logger.Log()
+			if !mock.check(err) {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// PullMetadata is the metadata of pull_repo, pull_repo_failed &
+// repo_verb logs
+type PullMetadata struct {
+	Repo           string     `json:"repo"`
+	Namespace      string     `json:"namespace"`
+	Tag            string     `json:"tag,omitempty"`
+	ManifestDigest string     `json:"manifest_digest,omitempty"`
+	Verb           string     `json:"verb,omitempty"`
+	UserAgent      string     `json:"user-agent,omitempty"`
+	Username       string     `json:"username,omitempty"`
+	Token          string     `json:"token,omitempty"`
+	TokenCode      string     `json:"token_code,omitempty"`
+	Public         *bool      `json:"public,omitempty"`
+	ResolvedIP     ResolvedIP `json:"resolved_ip"`
+}
+
+// PushMetadata is the metadata of push_repo & push_repo_failed logs
+type PushMetadata struct {
+	Repo       string     `json:"repo"`
+	Namespace  string     `json:"namespace"`
+	Tag        string     `json:"tag,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	UserAgent  string     `json:"user-agent,omitempty"`
+	Username   string     `json:"username,omitempty"`
+	ResolvedIP ResolvedIP `json:"resolved_ip"`
+}
+
+// TagMetadata is the metadata of the logs of tag changes e.g.
+// create_tag, move_tag & delete_tag
+type TagMetadata struct {
+	Repo                   string `json:"repo"`
+	Namespace              string `json:"namespace"`
+	Tag                    string `json:"tag"`
+	Image                  string `json:"image,omitempty"`
+	OriginalImage          string `json:"original_image,omitempty"`
+	ManifestDigest         string `json:"manifest_digest,omitempty"`
+	OriginalManifestDigest string `json:"original_manifest_digest,omitempty"`
+	Username               string `json:"username,omitempty"`
+}
+
+// VisibilityMetadata is the metadata of change_repo_visibility logs
+type VisibilityMetadata struct {
+	Repo       string `json:"repo"`
+	Namespace  string `json:"namespace"`
+	Visibility string `json:"visibility"`
+}
+
+// BuildMetadata is the metadata of the logs of builds & their
+// triggers
+type BuildMetadata struct {
+	Repo      string `json:"repo"`
+	Namespace string `json:"namespace"`
+	BuildID   string `json:"build_id,omitempty"`
+	TriggerID string `json:"trigger_id,omitempty"`
+}
+
+// KindMetadata returns the metadata of this log as the type of its
+// kind i.e. *PullMetadata, *PushMetadata, *TagMetadata,
+// *VisibilityMetadata or *BuildMetadata. Metadata of other kinds is
+// returned as *Metadata.
+//
+// Fields are decoded from extras as well. Hence fields that are
+// modelled by the type of the kind only are not lost.
+func (l Log) KindMetadata() (interface{}, error) {
+	var out interface{}
+	switch l.Kind {
+	case KindPullRepo, KindPullRepoFailed, KindRepoVerb:
+		out = &PullMetadata{}
+	case KindPushRepo, KindPushRepoFailed:
+		out = &PushMetadata{}
+	case KindCreateTag,
+		KindMoveTag,
+		KindDeleteTag,
+		KindRevertTag,
+		KindPermanentlyDeleteTag,
+		KindChangeTagExpiration:
+		out = &TagMetadata{}
+	case KindChangeRepoVisibility:
+		out = &VisibilityMetadata{}
+	case KindBuildDockerfile,
+		KindSetupRepoTrigger,
+		KindToggleRepoTrigger,
+		KindDeleteRepoTrigger:
+		out = &BuildMetadata{}
+	default:
+		metadata := l.Metadata
+		return &metadata, nil
+	}
+	raw, err := json.Marshal(l.Metadata)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to marshal metadata: Kind %q",
+			l.Kind,
+		)
+	}
+	err = json.Unmarshal(raw, out)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to unmarshal metadata: Kind %q",
+			l.Kind,
+		)
+	}
+	return out, nil
+}
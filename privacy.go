@@ -0,0 +1,192 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// IPPrivacy is how the IPs of logs are anonymized before these are
+// stored
+type IPPrivacy string
+
+const (
+	// IPPrivacyNone keeps the IPs as is
+	IPPrivacyNone IPPrivacy = "none"
+
+	// IPPrivacyHMAC replaces the IPs with their keyed HMAC-SHA256.
+	// An IP always gets the same hash for a key. Hence unique
+	// pullers can still be counted.
+	IPPrivacyHMAC IPPrivacy = "hmac"
+
+	// IPPrivacyTruncate zeroes the host bits of the IPs i.e. IPv4
+	// addresses are truncated to /24 & IPv6 addresses to /48
+	IPPrivacyTruncate IPPrivacy = "truncate"
+
+	// IPPrivacyDrop removes the IPs
+	IPPrivacyDrop IPPrivacy = "drop"
+)
+
+// IPPrivacies lists all the supported privacy modes
+var IPPrivacies = []IPPrivacy{
+	IPPrivacyNone,
+	IPPrivacyHMAC,
+	IPPrivacyTruncate,
+	IPPrivacyDrop,
+}
+
+// HashedIPPrefix is the prefix of the IPs hashed with IPPrivacyHMAC
+const HashedIPPrefix string = "hmac:"
+
+// Prefix lengths the IPs are truncated to by IPPrivacyTruncate
+const (
+	TruncatedIPv4Bits int = 24
+	TruncatedIPv6Bits int = 48
+)
+
+// ParseIPPrivacy returns the IPPrivacy of the given name. Empty name
+// is same as IPPrivacyNone.
+func ParseIPPrivacy(name string) (IPPrivacy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return IPPrivacyNone, nil
+	}
+	for _, mode := range IPPrivacies {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", errors.Errorf(
+		"Unsupported IP privacy %q: Supported modes %v",
+		name,
+		IPPrivacies,
+	)
+}
+
+// Anonymizer anonymizes the IPs of logs
+//
+// Anonymizer is safe for concurrent use.
+type Anonymizer struct {
+	Mode IPPrivacy
+	key  []byte
+}
+
+// NewAnonymizer returns a new instance of Anonymizer of the given
+// mode. The key is needed by IPPrivacyHMAC only.
+func NewAnonymizer(mode IPPrivacy, key []byte) (*Anonymizer, error) {
+	if _, err := ParseIPPrivacy(string(mode)); err != nil {
+		return nil, err
+	}
+	if mode == IPPrivacyHMAC && len(key) == 0 {
+		return nil, errors.Errorf("Missing key of IP privacy %q", mode)
+	}
+	return &Anonymizer{Mode: mode, key: key}, nil
+}
+
+// AnonymizeIP returns the anonymized form of the given IP
+//
+// Values that are not IPs e.g. hashes or empty values are returned
+// as is. Hence anonymizing an IP again does not change it.
+func (a *Anonymizer) AnonymizeIP(value string) string {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return value
+	}
+	switch a.Mode {
+	case IPPrivacyHMAC:
+		mac := hmac.New(sha256.New, a.key)
+		mac.Write([]byte(ip.String()))
+		return HashedIPPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+	case IPPrivacyTruncate:
+		if v4 := ip.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(TruncatedIPv4Bits, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(TruncatedIPv6Bits, 128)).String()
+	case IPPrivacyDrop:
+		return ""
+	default:
+		return value
+	}
+}
+
+// Anonymize anonymizes the IPs of the given logs in place. It returns
+// the number of logs whose IP changed.
+func (a *Anonymizer) Anonymize(logs []Log) int {
+	var count int
+	for i := range logs {
+		ip := a.AnonymizeIP(logs[i].IP)
+		if ip == logs[i].IP {
+			continue
+		}
+		logs[i].IP = ip
+		count++
+	}
+	return count
+}
+
+// AnonymizeResult summarises the anonymization of stored logs
+type AnonymizeResult struct {
+	FileCount       int
+	RewrittenCount  int
+	LogCount        int
+	AnonymizedCount int
+}
+
+// AnonymizeStorage anonymizes the IPs of the logs of all the files of
+// logs of the given storage in place
+//
+// Only the files having logs whose IP changed are rewritten. Logs
+// that share their anonymized IPs are kept since these may be
+// distinct events.
+func AnonymizeStorage(store storage.Storage, a *Anonymizer, debug bool) (AnonymizeResult, error) {
+	var result AnonymizeResult
+	keys, err := ListJSONKeys(store, "")
+	if err != nil {
+		return result, err
+	}
+	for _, key := range keys {
+		result.FileCount++
+		got, err := ReadLogList(store, key)
+		if err != nil {
+			return result, err
+		}
+		result.LogCount += len(got.Items)
+		count := a.Anonymize(got.Items)
+		if count == 0 {
+			continue
+		}
+		result.AnonymizedCount += count
+		err = WriteLogList(store, key, got)
+		if err != nil {
+			return result, err
+		}
+		result.RewrittenCount++
+		if debug {
+			log.Printf("Anonymized logs of file: %s", key)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	var tests = map[string]struct {
+		mode   gmetrics.IPPrivacy
+		ip     string
+		expect string
+	}{
+		"none": {
+			mode:   gmetrics.IPPrivacyNone,
+			ip:     "10.0.1.7",
+			expect: "10.0.1.7",
+		},
+		"truncate ipv4": {
+			mode:   gmetrics.IPPrivacyTruncate,
+			ip:     "10.0.1.7",
+			expect: "10.0.1.0",
+		},
+		"truncate ipv6": {
+			mode:   gmetrics.IPPrivacyTruncate,
+			ip:     "2001:db8:85a3:8d3:1319:8a2e:370:7348",
+			expect: "2001:db8:85a3::",
+		},
+		"truncate ipv4 mapped ipv6": {
+			mode:   gmetrics.IPPrivacyTruncate,
+			ip:     "::ffff:10.0.1.7",
+			expect: "10.0.1.0",
+		},
+		"drop": {
+			mode:   gmetrics.IPPrivacyDrop,
+			ip:     "10.0.1.7",
+			expect: "",
+		},
+		"not an ip": {
+			mode:   gmetrics.IPPrivacyTruncate,
+			ip:     "hmac:0123",
+			expect: "hmac:0123",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			a, err := gmetrics.NewAnonymizer(mock.mode, nil)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			got := a.AnonymizeIP(mock.ip)
+			if got != mock.expect {
+				t.Fatalf("Expected %q got %q", mock.expect, got)
+			}
+			if again := a.AnonymizeIP(got); again != got {
+				t.Fatalf("Expected %q once anonymized again got %q", got, again)
+			}
+		})
+	}
+}
+
+func TestAnonymizeIPWithHMAC(t *testing.T) {
+	a, err := gmetrics.NewAnonymizer(gmetrics.IPPrivacyHMAC, []byte("secret"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	other, err := gmetrics.NewAnonymizer(gmetrics.IPPrivacyHMAC, []byte("other"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got := a.AnonymizeIP("10.0.1.7")
+	if !strings.HasPrefix(got, gmetrics.HashedIPPrefix) || strings.Contains(got, "10.0.1.7") {
+		t.Fatalf("Expected hashed IP got %q", got)
+	}
+	// same IP gets the same hash so that unique pullers can be counted
+	if a.AnonymizeIP("10.0.1.7") != got || a.AnonymizeIP("10.0.1.8") == got {
+		t.Fatalf("Expected same hash of same IP only got %q", got)
+	}
+	if other.AnonymizeIP("10.0.1.7") == got {
+		t.Fatalf("Expected different hash of another key got %q", got)
+	}
+	if a.AnonymizeIP(got) != got {
+		t.Fatalf("Expected hash to be kept got %q", a.AnonymizeIP(got))
+	}
+
+	_, err = gmetrics.NewAnonymizer(gmetrics.IPPrivacyHMAC, nil)
+	if err == nil {
+		t.Fatalf("Expected error of missing key got none")
+	}
+	_, err = gmetrics.NewAnonymizer("mask", nil)
+	if err == nil {
+		t.Fatalf("Expected error of unknown privacy got none")
+	}
+}
+
+func TestLogAnonymizesBeforeStoring(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(3)
+	defer server.Close()
+	a, err := gmetrics.NewAnonymizer(gmetrics.IPPrivacyHMAC, []byte("secret"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	config := gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now),
+		GeoLookup:     geo,
+		Anonymizer:    a,
+	}
+	var counts []int
+	for run := 0; run < 2; run++ {
+		logger, err := gmetrics.NewLogger(config)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		got, err := logger.Log()
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		counts = append(counts, len(got.Items))
+		config.Clock = quaytest.NewClock(now.Add(5 * time.Minute))
+	}
+	// logs are identified by their anonymized IPs
+	if counts[0] != 3 || counts[1] != 0 {
+		t.Fatalf("Expected 3 & 0 logs got %v", counts)
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	for _, entry := range repos[0].Items {
+		if !strings.HasPrefix(entry.IP, gmetrics.HashedIPPrefix) {
+			t.Fatalf("Expected hashed IP got %q", entry.IP)
+		}
+	}
+	// country is found before the IP is anonymized
+	if repos[0].Items[2].Country() != "DE" {
+		t.Fatalf("Expected stored log of DE got %+v", repos[0].Items[2])
+	}
+}
+
+func TestAnonymizeStorage(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(3)
+	defer server.Close()
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	a, err := gmetrics.NewAnonymizer(gmetrics.IPPrivacyDrop, nil)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	for run, expect := range []int{3, 0} {
+		got, err := gmetrics.AnonymizeStorage(store, a, false)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if got.LogCount != 3 || got.AnonymizedCount != expect {
+			t.Fatalf("Expected %d anonymized logs of run %d got %+v", expect, run, got)
+		}
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	for _, entry := range repos[0].Items {
+		if entry.IP != "" {
+			t.Fatalf("Expected no IP got %q", entry.IP)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// PurgeAuditFolder is the folder of the storage that has the audit
+// records of the purges. It is hidden so that these are not read as
+// logs.
+const PurgeAuditFolder string = ".purges"
+
+// IPMatcher matches IPs against a list of IPs & CIDR ranges
+type IPMatcher struct {
+	// Targets are the IPs & CIDR ranges as given
+	Targets []string
+	// Ranges are the CIDR ranges of the raw IPs whose logs are
+	// matched. These are wider than the targets when IPs are
+	// truncated.
+	Ranges []string
+	nets   []*net.IPNet
+	// anonymized has the anonymized forms of the target IPs
+	anonymized map[string]bool
+}
+
+// NewIPMatcher returns a new instance of IPMatcher of the given IPs
+// & CIDR ranges e.g. 10.0.1.7 or 10.0.0.0/16
+//
+// Logs whose IPs were anonymized are matched by the anonymized forms
+// of the target IPs when the anonymizer is given. Targets that can
+// not be matched under the privacy mode of the anonymizer result in
+// an error i.e. any target when IPs are dropped, CIDR ranges when IPs
+// are hashed & CIDR ranges narrower than the truncated networks when
+// IPs are truncated. An IP matches its whole truncated network when
+// IPs are truncated e.g. 10.0.1.7 matches 10.0.1.0/24.
+func NewIPMatcher(targets []string, a *Anonymizer) (*IPMatcher, error) {
+	if len(targets) == 0 {
+		return nil, errors.Errorf("No IPs or CIDR ranges to match")
+	}
+	mode := IPPrivacyNone
+	if a != nil {
+		mode = a.Mode
+	}
+	if mode == IPPrivacyDrop {
+		return nil, errors.Errorf("No IPs or CIDR ranges can be matched: IPs are dropped")
+	}
+	m := &IPMatcher{
+		Targets:    targets,
+		anonymized: map[string]bool{},
+	}
+	for _, target := range targets {
+		var ipnet *net.IPNet
+		if strings.Contains(target, "/") {
+			var err error
+			_, ipnet, err = net.ParseCIDR(target)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid CIDR range %q", target)
+			}
+			if mode == IPPrivacyHMAC {
+				return nil, errors.Errorf("CIDR range %q can not be matched: IPs are hashed", target)
+			}
+		} else {
+			ip := net.ParseIP(target)
+			if ip == nil {
+				return nil, errors.Errorf("Invalid IP %q", target)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			if mode != IPPrivacyNone {
+				m.anonymized[a.AnonymizeIP(target)] = true
+			}
+		}
+		if mode == IPPrivacyTruncate {
+			ones, bits := ipnet.Mask.Size()
+			truncated := TruncatedIPv6Bits
+			if bits == 32 {
+				truncated = TruncatedIPv4Bits
+			}
+			if ones > truncated && strings.Contains(target, "/") {
+				return nil, errors.Errorf(
+					"CIDR range %q can not be matched: IPs are truncated to /%d",
+					target,
+					truncated,
+				)
+			}
+			if ones > truncated {
+				// the whole truncated network of the IP is matched
+				ipnet = &net.IPNet{
+					IP:   ipnet.IP.Mask(net.CIDRMask(truncated, bits)),
+					Mask: net.CIDRMask(truncated, bits),
+				}
+			}
+		}
+		m.nets = append(m.nets, ipnet)
+		m.Ranges = append(m.Ranges, ipnet.String())
+	}
+	return m, nil
+}
+
+// Match returns true if the given IP is one of the targets or is
+// within one of the target ranges
+func (m *IPMatcher) Match(value string) bool {
+	if value == "" {
+		return false
+	}
+	if m.anonymized[value] {
+		return true
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range m.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PurgeConfig is used to create a purge of logs
+type PurgeConfig struct {
+	Matcher *IPMatcher
+	// IsDryRun when set to true finds the logs to remove without
+	// modifying the storage. No audit record is written.
+	IsDryRun bool
+	Debug    bool
+	// Clock is used to time the audit record. Defaults to
+	// SystemClock.
+	Clock Clock
+}
+
+// PurgedFile is a file of the storage that had logs to remove
+type PurgedFile struct {
+	Key     string `json:"key"`
+	Removed int    `json:"removed"`
+	// IsDeleted is set when no logs were left in the file
+	IsDeleted bool `json:"deleted"`
+}
+
+// PurgeRecord is the audit record of a purge. It tells what was
+// removed without keeping the removed logs.
+type PurgeRecord struct {
+	Time time.Time `json:"time"`
+	// ID tells apart the records of the same second
+	ID      string   `json:"id"`
+	Targets []string `json:"targets"`
+	// Ranges are the CIDR ranges of the raw IPs that were purged.
+	// Logs of these are not stored again.
+	Ranges       []string     `json:"ranges,omitempty"`
+	FileCount    int          `json:"files_scanned"`
+	LogCount     int          `json:"logs_scanned"`
+	RemovedCount int          `json:"removed"`
+	Files        []PurgedFile `json:"files"`
+	// Error is set if the purge failed. Files lists the files that
+	// could not be restored in that case.
+	Error string `json:"error,omitempty"`
+}
+
+// Key returns the storage key of this record i.e.
+// `.purges/<time>-<id>.json`
+func (r PurgeRecord) Key() string {
+	name := r.Time.UTC().Format(SnapshotTimeFormat)
+	if r.ID != "" {
+		name += "-" + r.ID
+	}
+	return path.Join(PurgeAuditFolder, name+".json")
+}
+
+// newPurgeID returns a random ID of a purge record
+func newPurgeID() (string, error) {
+	raw := make([]byte, 4)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to generate purge ID")
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// purgePlan is the new content of a file that has logs to remove
+type purgePlan struct {
+	file PurgedFile
+	// raw is nil if the file is to be deleted
+	raw []byte
+	// original is the content of the file before the purge
+	original []byte
+}
+
+// PurgeFolder removes the logs matched by the given config from all
+// the files of logs of the given folder & its sub folders
+//
+// This is same as Purge of the local storage rooted at the given
+// folder.
+func PurgeFolder(fpath string, config PurgeConfig) (PurgeRecord, error) {
+	return Purge(storage.NewLocal(fpath), config)
+}
+
+// Purge removes the logs whose IPs are matched by the given config
+// from all the files of logs of the given storage & writes an audit
+// record of the purge to PurgeAuditFolder
+//
+// The purge is all or nothing. All the files are read & their new
+// content is prepared before any file is modified. Every file is then
+// rewritten atomically & files left with no logs are removed. If a
+// file can not be modified, the files modified so far are restored
+// from their original content. The audit record is written in either
+// case.
+func Purge(store storage.Storage, config PurgeConfig) (PurgeRecord, error) {
+	id, err := newPurgeID()
+	if err != nil {
+		return PurgeRecord{}, err
+	}
+	record := PurgeRecord{
+		Time:    orSystemClock(config.Clock).Now().UTC().Truncate(time.Second),
+		ID:      id,
+		Targets: config.Matcher.Targets,
+		Ranges:  config.Matcher.Ranges,
+		Files:   []PurgedFile{},
+	}
+	keys, err := ListJSONKeys(store, "")
+	if err != nil {
+		return record, err
+	}
+	var plans []purgePlan
+	for _, key := range keys {
+		record.FileCount++
+		original, err := store.Get(key)
+		if err != nil {
+			return record, errors.Wrapf(
+				err,
+				"Failed to read logs: Key %q",
+				key,
+			)
+		}
+		got, err := unmarshalLogList(original, key)
+		if err != nil {
+			return record, err
+		}
+		record.LogCount += len(got.Items)
+		var kept []Log
+		for _, entry := range got.Items {
+			if !config.Matcher.Match(entry.IP) {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) == len(got.Items) {
+			continue
+		}
+		plan := purgePlan{
+			file: PurgedFile{
+				Key:       key,
+				Removed:   len(got.Items) - len(kept),
+				IsDeleted: len(kept) == 0,
+			},
+			original: original,
+		}
+		if len(kept) > 0 {
+			got.Items = kept
+			format, _ := LogFileFormatOf(key)
+			plan.raw, err = EncodeLogList(got, format)
+			if err != nil {
+				return record, errors.Wrapf(
+					err,
+					"Failed to marshal remaining logs of %s",
+					key,
+				)
+			}
+		}
+		plans = append(plans, plan)
+	}
+	if config.IsDryRun {
+		for _, plan := range plans {
+			record.Files = append(record.Files, plan.file)
+			record.RemovedCount += plan.file.Removed
+		}
+		return record, nil
+	}
+
+	var applied []purgePlan
+	for _, plan := range plans {
+		if plan.raw == nil {
+			err = store.Delete(plan.file.Key)
+		} else {
+			err = store.Put(plan.file.Key, plan.raw)
+		}
+		if err != nil {
+			err = errors.Wrapf(
+				err,
+				"Failed to purge logs of %s",
+				plan.file.Key,
+			)
+			break
+		}
+		applied = append(applied, plan)
+		if config.Debug {
+			log.Printf("Purged logs: Key %q: Removed %d", plan.file.Key, plan.file.Removed)
+		}
+	}
+	if err != nil {
+		// files modified so far are restored
+		applied = restorePurgedFiles(store, applied, config.Debug)
+		if len(applied) > 0 {
+			err = errors.Wrapf(
+				err,
+				"Failed to restore %d purged files",
+				len(applied),
+			)
+		}
+		record.Error = err.Error()
+	}
+	for _, plan := range applied {
+		record.Files = append(record.Files, plan.file)
+		record.RemovedCount += plan.file.Removed
+	}
+	auditErr := writePurgeRecord(store, record)
+	if err != nil {
+		return record, err
+	}
+	return record, auditErr
+}
+
+// restorePurgedFiles puts back the original content of the files of
+// the given plans. It returns the plans whose files could not be
+// restored.
+func restorePurgedFiles(store storage.Storage, plans []purgePlan, debug bool) []purgePlan {
+	var failed []purgePlan
+	for i := len(plans) - 1; i >= 0; i-- {
+		err := store.Put(plans[i].file.Key, plans[i].original)
+		if err != nil {
+			log.Printf("Failed to restore purged logs: Key %q: %v", plans[i].file.Key, err)
+			failed = append(failed, plans[i])
+			continue
+		}
+		if debug {
+			log.Printf("Restored purged logs: Key %q", plans[i].file.Key)
+		}
+	}
+	return failed
+}
+
+// LoadPurgedIPs returns an IPMatcher of the raw IPs purged earlier as
+// per the audit records of the given storage. Nil is returned if
+// nothing was purged.
+//
+// Logs of these IPs are not stored again e.g. by a backfill. Records
+// of failed purges are considered too since the purge was requested.
+func LoadPurgedIPs(store storage.Storage) (*IPMatcher, error) {
+	prefix := PurgeAuditFolder + "/"
+	keys, err := store.List(prefix)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to list purge records: Prefix %q",
+			prefix,
+		)
+	}
+	var ranges []string
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		raw, err := store.Get(key)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"Failed to read purge record: Key %q",
+				key,
+			)
+		}
+		var record PurgeRecord
+		err = json.Unmarshal(raw, &record)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"Failed to unmarshal purge record: Key %q",
+				key,
+			)
+		}
+		if len(record.Ranges) > 0 {
+			ranges = append(ranges, record.Ranges...)
+			continue
+		}
+		// records written before ranges were recorded
+		for _, target := range record.Targets {
+			if net.ParseIP(target) != nil || strings.Contains(target, "/") {
+				ranges = append(ranges, target)
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+	m, err := NewIPMatcher(ranges, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid purge records")
+	}
+	return m, nil
+}
+
+// writePurgeRecord stores the given audit record
+func writePurgeRecord(store storage.Storage, record PurgeRecord) error {
+	raw, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to marshal purge record",
+		)
+	}
+	err = store.Put(record.Key(), raw)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to store purge record: Key %q",
+			record.Key(),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+func TestIPMatcher(t *testing.T) {
+	hmac, err := gmetrics.NewAnonymizer(gmetrics.IPPrivacyHMAC, []byte("secret"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	truncate, err := gmetrics.NewAnonymizer(gmetrics.IPPrivacyTruncate, nil)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	drop, err := gmetrics.NewAnonymizer(gmetrics.IPPrivacyDrop, nil)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	var tests = map[string]struct {
+		targets    []string
+		anonymizer *gmetrics.Anonymizer
+		ip         string
+		expect     bool
+	}{
+		"same ip": {
+			targets: []string{"10.0.1.7"},
+			ip:      "10.0.1.7",
+			expect:  true,
+		},
+		"other ip": {
+			targets: []string{"10.0.1.7"},
+			ip:      "10.0.1.8",
+		},
+		"ip within cidr": {
+			targets: []string{"192.168.0.1", "10.0.0.0/16"},
+			ip:      "10.0.200.7",
+			expect:  true,
+		},
+		"ip outside cidr": {
+			targets: []string{"10.0.0.0/16"},
+			ip:      "10.1.0.7",
+		},
+		"ipv6 within cidr": {
+			targets: []string{"2001:db8::/32"},
+			ip:      "2001:db8:85a3::7348",
+			expect:  true,
+		},
+		"hashed ip": {
+			targets:    []string{"10.0.1.7"},
+			anonymizer: hmac,
+			ip:         hmac.AnonymizeIP("10.0.1.7"),
+			expect:     true,
+		},
+		"truncated ip": {
+			targets:    []string{"10.0.1.7"},
+			anonymizer: truncate,
+			ip:         "10.0.1.0",
+			expect:     true,
+		},
+		"raw ip within truncated network": {
+			targets:    []string{"10.0.1.7"},
+			anonymizer: truncate,
+			ip:         "10.0.1.200",
+			expect:     true,
+		},
+		"truncated ip within cidr": {
+			targets:    []string{"10.0.0.0/16"},
+			anonymizer: truncate,
+			ip:         "10.0.5.0",
+			expect:     true,
+		},
+		"dropped ip": {
+			targets: []string{"10.0.0.0/8"},
+			ip:      "",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			m, err := gmetrics.NewIPMatcher(mock.targets, mock.anonymizer)
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if m.Match(mock.ip) != mock.expect {
+				t.Fatalf("Expected match %t of %q got %t", mock.expect, mock.ip, !mock.expect)
+			}
+		})
+	}
+
+	var invalids = map[string]struct {
+		targets    []string
+		anonymizer *gmetrics.Anonymizer
+	}{
+		"no targets":                 {},
+		"invalid ip":                 {targets: []string{"10.0.1"}},
+		"invalid cidr":               {targets: []string{"10.0.0.0/33"}},
+		"cidr of hashed ips":         {targets: []string{"10.0.0.0/16"}, anonymizer: hmac},
+		"narrow cidr of truncated":   {targets: []string{"10.0.1.0/28"}, anonymizer: truncate},
+		"narrow ipv6 cidr truncated": {targets: []string{"2001:db8::/64"}, anonymizer: truncate},
+		"ip of dropped ips":          {targets: []string{"10.0.1.7"}, anonymizer: drop},
+	}
+	for name, mock := range invalids {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			_, err := gmetrics.NewIPMatcher(mock.targets, mock.anonymizer)
+			if err == nil {
+				t.Fatalf("Expected error of targets %q got none", mock.targets)
+			}
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(45)
+	defer server.Close()
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	// IPs of the logs are 10.0.0.0 to 10.0.0.44
+	matcher, err := gmetrics.NewIPMatcher([]string{"10.0.0.0/28", "10.0.0.30"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	dryRun, err := gmetrics.Purge(store, gmetrics.PurgeConfig{
+		Matcher:  matcher,
+		IsDryRun: true,
+		Clock:    quaytest.NewClock(now),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if dryRun.RemovedCount != 17 {
+		t.Fatalf("Expected 17 logs to remove got %+v", dryRun)
+	}
+	if _, err := store.Get(dryRun.Key()); err == nil {
+		t.Fatalf("Expected no audit record of dry run")
+	}
+
+	got, err := gmetrics.Purge(store, gmetrics.PurgeConfig{
+		Matcher: matcher,
+		Clock:   quaytest.NewClock(now),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if got.FileCount != 3 || got.LogCount != 45 || got.RemovedCount != 17 {
+		t.Fatalf("Expected 17 of 45 logs removed got %+v", got)
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(repos[0].Items) != 28 {
+		t.Fatalf("Expected 28 logs left got %d", len(repos[0].Items))
+	}
+	for _, entry := range repos[0].Items {
+		if matcher.Match(entry.IP) {
+			t.Fatalf("Expected log of %q to be removed", entry.IP)
+		}
+	}
+
+	// audit record tells what was removed
+	raw, err := store.Get(got.Key())
+	if err != nil {
+		t.Fatalf("Expected audit record got %v", err)
+	}
+	var record gmetrics.PurgeRecord
+	err = json.Unmarshal(raw, &record)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	var removed, deleted int
+	for _, file := range record.Files {
+		removed += file.Removed
+		if file.IsDeleted {
+			deleted++
+		}
+	}
+	// oldest page has the logs of 10.0.0.0 to 10.0.0.4 only
+	if deleted != 1 {
+		t.Fatalf("Expected 1 deleted file got %+v", record.Files)
+	}
+	if removed != 17 || len(record.Targets) != 2 || !record.Time.Equal(now) {
+		t.Fatalf("Expected audit record of 17 logs got %+v", record)
+	}
+	if len(record.Ranges) != 2 || record.Ranges[1] != "10.0.0.30/32" {
+		t.Fatalf("Expected ranges of the targets got %q", record.Ranges)
+	}
+
+	// a backfill does not download the purged logs again
+	purged, err := gmetrics.LoadPurgedIPs(store)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	backfill, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now.Add(time.Hour)),
+		Purged:        purged,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = backfill.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	repos, err = gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(repos[0].Items) != 28 {
+		t.Fatalf("Expected 28 logs after backfill got %d", len(repos[0].Items))
+	}
+}
+
+func TestLoadPurgedIPsWithoutPurges(t *testing.T) {
+	purged, err := gmetrics.LoadPurgedIPs(storage.NewMemory())
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if purged != nil {
+		t.Fatalf("Expected no purged IPs got %+v", purged)
+	}
+}
+
+// deleteFailingStorage fails to delete any file
+type deleteFailingStorage struct {
+	storage.Storage
+}
+
+// Delete returns an error
+func (s deleteFailingStorage) Delete(key string) error {
+	return errors.New("delete failed")
+}
+
+func TestPurgeRestoresFilesOnFailure(t *testing.T) {
+	store := storage.NewMemory()
+	server := newLogsServer(45)
+	defer server.Close()
+	logger, err := gmetrics.NewLogger(gmetrics.LoggableConfig{
+		QuayURL:       server.URL,
+		Namespace:     "openebs",
+		Name:          "jiva",
+		IsWriteToFile: true,
+		Storage:       store,
+		Clock:         quaytest.NewClock(now),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	_, err = logger.Log()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	// newer pages are rewritten before the oldest page fails to be
+	// deleted
+	matcher, err := gmetrics.NewIPMatcher([]string{"10.0.0.0/28", "10.0.0.30"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	var keys []string
+	for run := 0; run < 2; run++ {
+		got, err := gmetrics.Purge(deleteFailingStorage{store}, gmetrics.PurgeConfig{
+			Matcher: matcher,
+			Clock:   quaytest.NewClock(now),
+		})
+		if err == nil {
+			t.Fatalf("Expected error got none")
+		}
+		if got.Error == "" || got.RemovedCount != 0 || len(got.Files) != 0 {
+			t.Fatalf("Expected failed purge with no files modified got %+v", got)
+		}
+		keys = append(keys, got.Key())
+	}
+	repos, err := gmetrics.ReadRepoLogs(store, false)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(repos) != 1 || len(repos[0].Items) != 45 {
+		t.Fatalf("Expected 45 logs restored got %+v", repos)
+	}
+	// audit records of the same second are kept apart
+	if keys[0] == keys[1] {
+		t.Fatalf("Expected unique audit record keys got %v", keys)
+	}
+	for _, key := range keys {
+		if _, err := store.Get(key); err != nil {
+			t.Fatalf("Expected audit record %q got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quaytest
+
+import (
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// LogConfig is used to create a log with NewLog
+type LogConfig struct {
+	// Namespace defaults to openebs
+	Namespace string
+	Repo      string
+	Tag       string
+	// Kind defaults to gmetrics.KindPullRepo
+	Kind gmetrics.LogKind
+	IP   string
+	// Country is the ISO code of the country resolved by quay
+	Country string
+	Time    time.Time
+}
+
+// NewLog returns a log of the given config similar to the logs
+// served by quay
+func NewLog(config LogConfig) gmetrics.Log {
+	if config.Namespace == "" {
+		config.Namespace = "openebs"
+	}
+	if config.Kind == "" {
+		config.Kind = gmetrics.KindPullRepo
+	}
+	return gmetrics.Log{
+		IP:       config.IP,
+		Kind:     config.Kind,
+		Datetime: config.Time.Format(gmetrics.QuayTimeFormat),
+		Metadata: gmetrics.Metadata{
+			Namespace: config.Namespace,
+			Repo:      config.Repo,
+			Tag:       config.Tag,
+			ResolvedIP: gmetrics.ResolvedIP{
+				CountryISOCode: config.Country,
+			},
+		},
+	}
+}
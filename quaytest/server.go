@@ -0,0 +1,433 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package quaytest provides a fake quay server to test the code
+// that invokes quay APIs without talking to quay.io.
+package quaytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+const (
+	// DefaultRepoPageSize is the number of repos served per page
+	// similar to quay
+	DefaultRepoPageSize int = 100
+
+	// DefaultLogPageSize is the number of logs served per page
+	// similar to quay
+	DefaultLogPageSize int = 20
+)
+
+// ServerConfig is used to initialise a Server instance
+type ServerConfig struct {
+	// AuthToken when set is required as the bearer token of every
+	// request. Requests without it get a 401 response.
+	AuthToken string
+
+	// RepoPageSize is the number of repos served per page. Defaults
+	// to DefaultRepoPageSize.
+	RepoPageSize int
+
+	// LogPageSize is the number of logs served per page. Defaults
+	// to DefaultLogPageSize.
+	LogPageSize int
+
+	// DisableRepoPagination when set to true serves only the first
+	// page of repos without a next page token similar to older quay
+	// versions
+	DisableRepoPagination bool
+
+	// Latency delays every response
+	Latency time.Duration
+
+	// Clock decides the default date range of logs. Defaults to
+	// the system clock.
+	Clock gmetrics.Clock
+}
+
+// Failure is a failure injected into the responses of the server
+type Failure struct {
+	// Path selects the requests that fail by a substring of their
+	// path. All requests are selected if this is empty.
+	Path string
+
+	// StatusCode of the failed response
+	StatusCode int
+
+	// Body of the failed response. Defaults to a quay error body
+	// matching the status code. A 200 status code with a malformed
+	// body simulates a corrupt response.
+	Body string
+
+	// Headers of the failed response e.g. Retry-After
+	Headers map[string]string
+
+	// Times is the number of requests that fail. Defaults to 1.
+	// A negative value fails all the requests.
+	Times int
+}
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+}
+
+// repo is a repo of a namespace along with its logs
+type repo struct {
+	popular gmetrics.Popular
+	logs    []gmetrics.Log
+}
+
+// Server is a fake quay server that serves the following APIs:
+//
+//	GET /api/v1/repository?namespace={namespace}&next_page={token}
+//	GET /api/v1/repository/{namespace}/{repo}/logs?next_page={token}&starttime={date}&endtime={date}
+//
+// Repos are served in the order these are added. Logs are served
+// newest first.
+type Server struct {
+	*httptest.Server
+	ServerConfig
+
+	repos    map[string][]*repo
+	failures []*Failure
+	requests []Request
+	// inFlight is the number of requests being served
+	inFlight    int
+	maxInFlight int
+	mu          sync.Mutex
+}
+
+// NewServer starts & returns a new instance of Server. It should be
+// closed after use.
+func NewServer(config ServerConfig) *Server {
+	if config.RepoPageSize <= 0 {
+		config.RepoPageSize = DefaultRepoPageSize
+	}
+	if config.LogPageSize <= 0 {
+		config.LogPageSize = DefaultLogPageSize
+	}
+	if config.Clock == nil {
+		config.Clock = gmetrics.SystemClock{}
+	}
+	s := &Server{
+		ServerConfig: config,
+		repos:        map[string][]*repo{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddRepo adds the given repo & its logs to the given namespace
+func (s *Server) AddRepo(namespace string, popular gmetrics.Popular, logs ...gmetrics.Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if popular.Namespace == "" {
+		popular.Namespace = namespace
+	}
+	for _, r := range s.repos[namespace] {
+		if r.popular.Name == popular.Name {
+			r.popular = popular
+			r.logs = append(r.logs, logs...)
+			return
+		}
+	}
+	s.repos[namespace] = append(s.repos[namespace], &repo{
+		popular: popular,
+		logs:    logs,
+	})
+}
+
+// AddLogs adds the given logs to an existing repo
+func (s *Server) AddLogs(namespace string, name string, logs ...gmetrics.Log) {
+	s.AddRepo(namespace, gmetrics.Popular{Name: name}, logs...)
+}
+
+// RemoveRepo removes the given repo & its logs from the given
+// namespace
+func (s *Server) RemoveRepo(namespace string, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []*repo
+	for _, r := range s.repos[namespace] {
+		if r.popular.Name != name {
+			kept = append(kept, r)
+		}
+	}
+	s.repos[namespace] = kept
+}
+
+// Fail injects the given failure
+func (s *Server) Fail(failure Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if failure.Times == 0 {
+		failure.Times = 1
+	}
+	s.failures = append(s.failures, &failure)
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// MaxInFlight returns the maximum number of requests that were
+// served concurrently so far
+func (s *Server) MaxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.maxInFlight
+}
+
+// serveHTTP serves quay APIs
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	time.Sleep(s.Latency)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.inFlight-- }()
+
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header,
+	})
+	if failure := s.nextFailure(r.URL.Path); failure != nil {
+		writeFailure(w, failure)
+		return
+	}
+	if s.AuthToken != "" && r.Header.Get("Authorization") != "Bearer "+s.AuthToken {
+		writeError(w, http.StatusUnauthorized, "invalid_token", "Invalid bearer token")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "Method not allowed")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/"+gmetrics.QuayAPIVersion+"/")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "repository":
+		s.serveRepos(w, r.URL.Query())
+	case len(parts) == 4 && parts[0] == "repository" && parts[3] == "logs":
+		s.serveLogs(w, r.URL.Query(), parts[1], parts[2])
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "Not Found")
+	}
+}
+
+// nextFailure returns the failure to be served for the given path
+// if any
+func (s *Server) nextFailure(path string) *Failure {
+	for i, failure := range s.failures {
+		if !strings.Contains(path, failure.Path) {
+			continue
+		}
+		if failure.Times > 0 {
+			failure.Times--
+			if failure.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return failure
+	}
+	return nil
+}
+
+// serveRepos serves a page of repos of the namespace
+func (s *Server) serveRepos(w http.ResponseWriter, query url.Values) {
+	var all []gmetrics.Popular
+	for _, r := range s.repos[query.Get("namespace")] {
+		all = append(all, r.popular)
+	}
+	offset, ok := parsePageToken(query.Get("next_page"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid next_page")
+		return
+	}
+	out := gmetrics.PopularList{
+		Items: []gmetrics.Popular{},
+	}
+	if offset < len(all) {
+		end := offset + s.RepoPageSize
+		if end > len(all) {
+			end = len(all)
+		}
+		out.Items = all[offset:end]
+		if end < len(all) && !s.DisableRepoPagination {
+			out.NextPage = pageToken(end)
+		}
+	}
+	writeJSON(w, out)
+}
+
+// serveLogs serves a page of logs of the repo within the requested
+// date range
+func (s *Server) serveLogs(w http.ResponseWriter, query url.Values, namespace string, name string) {
+	var found *repo
+	for _, r := range s.repos[namespace] {
+		if r.popular.Name == name {
+			found = r
+		}
+	}
+	if found == nil {
+		writeError(w, http.StatusNotFound, "not_found", "Not Found")
+		return
+	}
+
+	now := s.Clock.Now().UTC()
+	start := now.AddDate(0, 0, -7)
+	end := now
+	if value := query.Get("starttime"); value != "" {
+		t, err := time.Parse(gmetrics.QuayQueryDateFormat, value)
+		if err == nil {
+			start = t
+		}
+	}
+	if value := query.Get("endtime"); value != "" {
+		t, err := time.Parse(gmetrics.QuayQueryDateFormat, value)
+		if err == nil {
+			// quay includes the whole of the end date
+			end = t.AddDate(0, 0, 1)
+		}
+	}
+	if start.After(end) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Start time must be before end time")
+		return
+	}
+
+	var logs []gmetrics.Log
+	for _, entry := range found.logs {
+		t, err := entry.Time()
+		if err != nil || t.Before(start) || !t.Before(end) {
+			continue
+		}
+		logs = append(logs, entry)
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		ti, _ := logs[i].Time()
+		tj, _ := logs[j].Time()
+		return ti.After(tj)
+	})
+
+	offset, ok := parsePageToken(query.Get("next_page"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid next_page")
+		return
+	}
+	out := gmetrics.LogList{
+		StartTime: start.Format(gmetrics.QuayTimeFormat),
+		EndTime:   end.Format(gmetrics.QuayTimeFormat),
+		Items:     []gmetrics.Log{},
+	}
+	if offset < len(logs) {
+		last := offset + s.LogPageSize
+		if last > len(logs) {
+			last = len(logs)
+		}
+		out.Items = logs[offset:last]
+		if last < len(logs) {
+			out.NextPage = pageToken(last)
+		}
+	}
+	writeJSON(w, out)
+}
+
+// pageToken returns the next page token of the given offset
+func pageToken(offset int) string {
+	return fmt.Sprintf("page-%d", offset)
+}
+
+// parsePageToken returns the offset of the given next page token
+func parsePageToken(token string) (int, bool) {
+	if token == "" {
+		return 0, true
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(token, "page-"))
+	if err != nil || offset < 0 || !strings.HasPrefix(token, "page-") {
+		return 0, false
+	}
+	return offset, true
+}
+
+// writeFailure writes the given failure as the response
+func writeFailure(w http.ResponseWriter, failure *Failure) {
+	for key, value := range failure.Headers {
+		w.Header().Set(key, value)
+	}
+	if failure.Body == "" {
+		writeError(
+			w,
+			failure.StatusCode,
+			"injected_failure",
+			http.StatusText(failure.StatusCode),
+		)
+		return
+	}
+	w.WriteHeader(failure.StatusCode)
+	fmt.Fprint(w, failure.Body)
+}
+
+// writeError writes a quay error body with the given status code
+func writeError(w http.ResponseWriter, statusCode int, errorType string, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(gmetrics.QuayErrorBody{
+		Status:       statusCode,
+		ErrorMessage: msg,
+		Title:        errorType,
+		ErrorType:    errorType,
+		Detail:       msg,
+	})
+}
+
+// writeJSON writes the given value as a JSON response
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
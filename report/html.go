@@ -0,0 +1,167 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/pkg/errors"
+)
+
+// htmlTemplate renders a report as a self-contained HTML page i.e.
+// styles & charts are inline
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date":        formatDate,
+	"percent":     formatPercent,
+	"change":      formatChange,
+	"isUp":        func(change float64) bool { return change >= 0 },
+	"barChart":    barChart,
+	"columnChart": columnChart,
+	"repoRows":    repoRowsOf,
+	"weekRows":    weekRowsOf,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 760px; color: #222; }
+h1 { margin-bottom: 0.2em; }
+.range { color: #666; margin-top: 0; }
+.summary span { display: inline-block; margin-right: 2em; }
+.summary b { font-size: 1.4em; display: block; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.up { color: #2e7d32; }
+.down { color: #c62828; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="range">{{date .Start}} to {{date .End}}</p>
+<div class="summary">
+<span><b>{{.Pulls}}</b>pulls</span>
+<span><b>{{.Pushes}}</b>pushes</span>
+<span><b>{{.Logs}}</b>logs</span>
+{{- with .LastWeekChange}}
+<span><b class="{{if isUp .}}up{{else}}down{{end}}">{{change .}}</b>pulls week over week</span>
+{{- end}}
+</div>
+
+<h2>Pulls over time</h2>
+{{if .Days}}{{columnChart .Days}}{{else}}<p>No pulls</p>{{end}}
+
+<h2>Top repos</h2>
+{{if .TopRepos}}{{barChart (repoRows .TopRepos)}}
+<table>
+<tr><th>Repo</th><th>Pulls</th><th>Share</th><th>Popularity</th><th>Rank</th></tr>
+{{- range .TopRepos}}
+<tr><td>{{.Repo}}</td><td>{{.Pulls}}</td><td>{{percent .Share}}</td><td>{{if .Rank}}{{.Popularity}}{{else}}-{{end}}</td><td>{{if .Rank}}{{.Rank}}{{else}}-{{end}}</td></tr>
+{{- end}}
+</table>
+{{else}}<p>No pulls</p>{{end}}
+
+<h2>Top tags</h2>
+{{if .TopTags}}
+<table>
+<tr><th>Tag</th><th>Pulls</th><th>Share</th></tr>
+{{- range .TopTags}}
+<tr><td>{{.Key}}</td><td>{{.Pulls}}</td><td>{{percent .Share}}</td></tr>
+{{- end}}
+</table>
+{{else}}<p>No pulls</p>{{end}}
+
+<h2>Countries</h2>
+{{if .Countries}}{{barChart .Countries}}{{else}}<p>No pulls</p>{{end}}
+
+<h2>Week over week</h2>
+{{if .Weeks}}{{columnChart (weekRows .Weeks)}}
+<table>
+<tr><th>Week</th><th>Pulls</th><th>Change</th></tr>
+{{- range .Weeks}}
+<tr><td>{{.Week}}</td><td>{{.Pulls}}</td><td>{{with .Change}}<span class="{{if isUp .}}up{{else}}down{{end}}">{{change .}}</span>{{else}}-{{end}}</td></tr>
+{{- end}}
+</table>
+{{else}}<p>No pulls</p>{{end}}
+</body>
+</html>
+`))
+
+// htmlReport is the report along with the values derived for the
+// HTML template
+type htmlReport struct {
+	Report
+	LastWeekChange *float64
+}
+
+// WriteHTML writes the given report as a self-contained HTML page
+// with inline SVG charts
+func WriteHTML(w io.Writer, r Report) error {
+	data := htmlReport{Report: r}
+	if _, last, ok := r.LastWeek(); ok {
+		data.LastWeekChange = last.Change
+	}
+	err := htmlTemplate.Execute(w, data)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to write HTML report",
+		)
+	}
+	return nil
+}
+
+// repoRowsOf returns the given repos as rows for the charts
+func repoRowsOf(repos []RepoRow) []Row {
+	var out []Row
+	for _, repo := range repos {
+		out = append(out, Row{Key: repo.Repo, Pulls: repo.Pulls, Share: repo.Share})
+	}
+	return out
+}
+
+// weekRowsOf returns the given weeks as rows for the charts
+func weekRowsOf(weeks []WeekRow) []Row {
+	var out []Row
+	for _, week := range weeks {
+		out = append(out, Row{Key: week.Week, Pulls: week.Pulls})
+	}
+	return out
+}
+
+// formatDate formats the given date; - is returned for zero time
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(gmetrics.ISODateFormat)
+}
+
+// formatPercent formats the given percentage e.g. 12.5%
+func formatPercent(value float64) string {
+	return fmt.Sprintf("%.1f%%", value)
+}
+
+// formatChange formats the given percentage change e.g. +12.5%
+func formatChange(value float64) string {
+	return fmt.Sprintf("%+.1f%%", value)
+}
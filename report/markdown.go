@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/pkg/errors"
+)
+
+// WriteMarkdown writes the given report as Markdown. Pulls over time
+// are shown as a sparkline since Markdown has no charts.
+func WriteMarkdown(w io.Writer, r Report) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# %s\n\n", escapeMarkdown(r.Title))
+	fmt.Fprintf(b, "%s to %s\n\n", formatDate(r.Start), formatDate(r.End))
+	fmt.Fprintf(b, "- Pulls: **%d**\n- Pushes: **%d**\n- Logs: **%d**\n", r.Pulls, r.Pushes, r.Logs)
+	if previous, last, ok := r.LastWeek(); ok && last.Change != nil {
+		fmt.Fprintf(
+			b,
+			"- Week over week: **%s** (%s: %d, %s: %d)\n",
+			formatChange(*last.Change),
+			previous.Week,
+			previous.Pulls,
+			last.Week,
+			last.Pulls,
+		)
+	}
+
+	fmt.Fprintf(b, "\n## Pulls over time\n\n")
+	if len(r.Days) == 0 {
+		fmt.Fprintf(b, "No pulls\n")
+	} else {
+		var values []float64
+		for _, day := range r.Days {
+			values = append(values, float64(day.Pulls))
+		}
+		fmt.Fprintf(
+			b,
+			"`%s` %s to %s, most %d a day\n",
+			gmetrics.Sparkline(values),
+			r.Days[0].Key,
+			r.Days[len(r.Days)-1].Key,
+			maxPulls(r.Days),
+		)
+	}
+
+	fmt.Fprintf(b, "\n## Top repos\n\n")
+	if len(r.TopRepos) == 0 {
+		fmt.Fprintf(b, "No pulls\n")
+	} else {
+		fmt.Fprintf(b, "| Repo | Pulls | Share | Popularity | Rank |\n|---|--:|--:|--:|--:|\n")
+		for _, repo := range r.TopRepos {
+			popularity, rank := "-", "-"
+			if repo.Rank > 0 {
+				popularity = fmt.Sprintf("%g", repo.Popularity)
+				rank = fmt.Sprint(repo.Rank)
+			}
+			fmt.Fprintf(
+				b,
+				"| %s | %d | %s | %s | %s |\n",
+				escapeMarkdown(repo.Repo),
+				repo.Pulls,
+				formatPercent(repo.Share),
+				popularity,
+				rank,
+			)
+		}
+	}
+
+	writeMarkdownRows(b, "Top tags", "Tag", r.TopTags)
+	writeMarkdownRows(b, "Countries", "Country", r.Countries)
+
+	fmt.Fprintf(b, "\n## Week over week\n\n")
+	if len(r.Weeks) == 0 {
+		fmt.Fprintf(b, "No pulls\n")
+	} else {
+		fmt.Fprintf(b, "| Week | Pulls | Change |\n|---|--:|--:|\n")
+		for _, week := range r.Weeks {
+			change := "-"
+			if week.Change != nil {
+				change = formatChange(*week.Change)
+			}
+			fmt.Fprintf(b, "| %s | %d | %s |\n", week.Week, week.Pulls, change)
+		}
+	}
+
+	err := b.Flush()
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to write Markdown report",
+		)
+	}
+	return nil
+}
+
+// writeMarkdownRows writes a section with a table of the given rows
+func writeMarkdownRows(w io.Writer, title, column string, rows []Row) {
+	fmt.Fprintf(w, "\n## %s\n\n", title)
+	if len(rows) == 0 {
+		fmt.Fprintf(w, "No pulls\n")
+		return
+	}
+	fmt.Fprintf(w, "| %s | Pulls | Share |\n|---|--:|--:|\n", column)
+	for _, row := range rows {
+		fmt.Fprintf(w, "| %s | %d | %s |\n", escapeMarkdown(row.Key), row.Pulls, formatPercent(row.Share))
+	}
+}
+
+// escapeMarkdown escapes the characters of the given value that
+// break Markdown tables & emphasis
+func escapeMarkdown(value string) string {
+	return strings.NewReplacer(
+		`|`, `\|`,
+		`*`, `\*`,
+		`_`, `\_`,
+	).Replace(value)
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package report builds a usage report of the stored logs & renders
+// it as a self-contained HTML page or as Markdown.
+package report
+
+import (
+	"fmt"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/aggregate"
+)
+
+// DefaultTop is the number of rows of the tables of a report
+const DefaultTop int = 10
+
+// Config is used to build a report
+type Config struct {
+	// Title of the report; defaults to Image usage report
+	Title string
+	// Start & End select the logs of the report. Both are inclusive
+	// & only their dates are considered. All logs are selected if
+	// these are not set.
+	Start time.Time
+	End   time.Time
+	// Top is the number of rows of the tables; defaults to DefaultTop
+	Top int
+}
+
+// RepoRow is a row of the top repos of a report
+type RepoRow struct {
+	// Repo is `namespace/repo`
+	Repo  string
+	Pulls int
+	// Share is the percentage of pulls of this repo
+	Share float64
+	// Popularity & Rank are taken from the latest snapshot of the
+	// namespace. Rank is 0 if the repo is not in the snapshot.
+	Popularity float64
+	Rank       int
+}
+
+// Row is a row of a report e.g. pulls of a tag, day or country
+type Row struct {
+	Key   string
+	Pulls int
+	// Share is the percentage of pulls of this row
+	Share float64
+}
+
+// WeekRow is the pulls of an ISO week along with the change from the
+// previous week. Weeks at the edges of the date range may be
+// partial.
+type WeekRow struct {
+	// Week is the ISO week e.g. 2020-W32
+	Week  string
+	Pulls int
+	// Change is the percentage change of pulls from the previous
+	// week. It is not set for the first week or if the previous week
+	// had no pulls.
+	Change *float64
+}
+
+// Report is the usage of images over a date range
+type Report struct {
+	Title string
+	// Start & End are the dates of the first & last day of the
+	// report. These are zero if there are no logs.
+	Start time.Time
+	End   time.Time
+
+	// Logs, Pulls & Pushes are the counts of all the logs in the date
+	// range
+	Logs   int
+	Pulls  int
+	Pushes int
+
+	TopRepos  []RepoRow
+	TopTags   []Row
+	Countries []Row
+	// Days has the pulls of every day of the report including days
+	// without pulls in chronological order
+	Days  []Row
+	Weeks []WeekRow
+}
+
+// Build returns the report of the given logs. The given snapshots
+// are the latest popularity snapshots of the namespaces.
+func Build(config Config, repos []gmetrics.RepoLogs, snapshots []gmetrics.Snapshot) Report {
+	top := config.Top
+	if top <= 0 {
+		top = DefaultTop
+	}
+	out := Report{Title: config.Title}
+	if out.Title == "" {
+		out.Title = "Image usage report"
+	}
+
+	// pulls counts pulls only while all counts logs of all kinds
+	all := aggregate.NewAggregator()
+	pulls := aggregate.NewAggregator()
+	var first, last time.Time
+	for _, repo := range repos {
+		for _, entry := range repo.Items {
+			t, err := entry.Time()
+			if err != nil {
+				if !config.Start.IsZero() || !config.End.IsZero() {
+					// the date of the log is not known
+					continue
+				}
+			} else {
+				day := truncateToDay(t)
+				if (!config.Start.IsZero() && day.Before(truncateToDay(config.Start))) ||
+					(!config.End.IsZero() && day.After(truncateToDay(config.End))) {
+					continue
+				}
+				if first.IsZero() || day.Before(first) {
+					first = day
+				}
+				if day.After(last) {
+					last = day
+				}
+			}
+			all.Add(entry)
+			if entry.Kind == gmetrics.KindPullRepo {
+				pulls.Add(entry)
+			}
+		}
+	}
+	total := all.Total()
+	out.Logs, out.Pulls, out.Pushes = total.Total, total.Pulls, total.Pushes
+
+	out.Start, out.End = first, last
+	if !config.Start.IsZero() {
+		out.Start = truncateToDay(config.Start)
+	}
+	if !config.End.IsZero() {
+		out.End = truncateToDay(config.End)
+	}
+
+	ranks := ranksOf(snapshots)
+	for _, c := range limit(pulls.Counts(aggregate.Repo), top) {
+		row := RepoRow{
+			Repo:  c.Key,
+			Pulls: c.Pulls,
+			Share: share(c.Pulls, out.Pulls),
+		}
+		if r, found := ranks[c.Key]; found {
+			row.Popularity = r.Popularity
+			row.Rank = r.rank
+		}
+		out.TopRepos = append(out.TopRepos, row)
+	}
+	out.TopTags = rowsOf(limit(pulls.Counts(aggregate.Tag), top), out.Pulls)
+	out.Countries = rowsOf(limit(pulls.Counts(aggregate.Country), top), out.Pulls)
+	out.Days = daysOf(pulls.Counts(aggregate.Day), out.Start, out.End, out.Pulls)
+	out.Weeks = weeksOf(out.Days)
+	return out
+}
+
+// rankedRepo is a repo of a snapshot along with its rank
+type rankedRepo struct {
+	gmetrics.Popular
+	rank int
+}
+
+// ranksOf returns the repos of the given snapshots keyed by
+// `namespace/repo`
+func ranksOf(snapshots []gmetrics.Snapshot) map[string]rankedRepo {
+	out := map[string]rankedRepo{}
+	for _, snapshot := range snapshots {
+		for i, repo := range snapshot.Repos {
+			out[snapshot.Namespace+"/"+repo.Name] = rankedRepo{Popular: repo, rank: i + 1}
+		}
+	}
+	return out
+}
+
+// limit returns the first top counts
+func limit(counts []aggregate.Count, top int) []aggregate.Count {
+	if len(counts) > top {
+		return counts[:top]
+	}
+	return counts
+}
+
+// rowsOf returns the rows of the given counts of pulls
+func rowsOf(counts []aggregate.Count, totalPulls int) []Row {
+	var out []Row
+	for _, c := range counts {
+		out = append(out, Row{Key: c.Key, Pulls: c.Pulls, Share: share(c.Pulls, totalPulls)})
+	}
+	return out
+}
+
+// daysOf returns the rows of every day from start till end with the
+// pulls of the given daily counts
+func daysOf(counts []aggregate.Count, start, end time.Time, totalPulls int) []Row {
+	if start.IsZero() || end.IsZero() {
+		return nil
+	}
+	byDay := map[string]int{}
+	for _, c := range counts {
+		byDay[c.Key] = c.Pulls
+	}
+	var out []Row
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		key := day.Format(gmetrics.ISODateFormat)
+		out = append(out, Row{Key: key, Pulls: byDay[key], Share: share(byDay[key], totalPulls)})
+	}
+	return out
+}
+
+// weeksOf returns the pulls per ISO week of the given days in
+// chronological order
+func weeksOf(days []Row) []WeekRow {
+	var out []WeekRow
+	for _, day := range days {
+		t, err := time.Parse(gmetrics.ISODateFormat, day.Key)
+		if err != nil {
+			continue
+		}
+		year, week := t.ISOWeek()
+		key := fmt.Sprintf("%d-W%02d", year, week)
+		if len(out) == 0 || out[len(out)-1].Week != key {
+			out = append(out, WeekRow{Week: key})
+		}
+		out[len(out)-1].Pulls += day.Pulls
+	}
+	for i := 1; i < len(out); i++ {
+		if out[i-1].Pulls == 0 {
+			continue
+		}
+		change := float64(out[i].Pulls-out[i-1].Pulls) / float64(out[i-1].Pulls) * 100
+		out[i].Change = &change
+	}
+	return out
+}
+
+// LastWeek returns the last week of this report along with the week
+// before it. False is returned if the report has less than two
+// weeks.
+func (r Report) LastWeek() (previous WeekRow, last WeekRow, ok bool) {
+	if len(r.Weeks) < 2 {
+		return WeekRow{}, WeekRow{}, false
+	}
+	return r.Weeks[len(r.Weeks)-2], r.Weeks[len(r.Weeks)-1], true
+}
+
+// share returns the given count as a percentage of the given total
+func share(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total) * 100
+}
+
+// truncateToDay returns the start of the day of the given time in UTC
+func truncateToDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/quaytest"
+	"github.com/mayadata.io/quay-logs/report"
+)
+
+// newRepos returns logs of 2 repos over 2 weeks i.e. Mon Aug 3 till
+// Sun Aug 16 2020
+func newRepos() []gmetrics.RepoLogs {
+	monday := time.Date(2020, 8, 3, 10, 0, 0, 0, time.UTC)
+	jiva := gmetrics.RepoLogs{Namespace: "openebs", Name: "jiva"}
+	cstor := gmetrics.RepoLogs{Namespace: "openebs", Name: "cstor"}
+	// 1 pull a day in the first week & 2 pulls a day in the second
+	for day := 0; day < 14; day++ {
+		t := monday.AddDate(0, 0, day)
+		jiva.Items = append(jiva.Items, quaytest.NewLog(quaytest.LogConfig{Repo: "jiva", Tag: "latest", Country: "US", Time: t}))
+		if day >= 7 {
+			cstor.Items = append(cstor.Items, quaytest.NewLog(quaytest.LogConfig{Repo: "cstor", Tag: "2.0.0", Country: "IN", Time: t}))
+		}
+	}
+	jiva.Items = append(jiva.Items, quaytest.NewLog(quaytest.LogConfig{Kind: gmetrics.KindPushRepo, Repo: "jiva", Tag: "latest", Time: monday}))
+	return []gmetrics.RepoLogs{jiva, cstor}
+}
+
+func TestBuild(t *testing.T) {
+	snapshots := []gmetrics.Snapshot{{
+		Namespace: "openebs",
+		Repos: []gmetrics.Popular{
+			{Name: "cstor", Popularity: 20},
+			{Name: "jiva", Popularity: 10},
+		},
+	}}
+	got := report.Build(report.Config{}, newRepos(), snapshots)
+	if got.Logs != 22 || got.Pulls != 21 || got.Pushes != 1 {
+		t.Fatalf("Expected 22 logs, 21 pulls & 1 push got %+v", got)
+	}
+	if len(got.Days) != 14 || got.Days[0].Key != "2020-08-03" || got.Days[13].Pulls != 2 {
+		t.Fatalf("Expected 14 days got %+v", got.Days)
+	}
+	if len(got.TopRepos) != 2 ||
+		got.TopRepos[0].Repo != "openebs/jiva" ||
+		got.TopRepos[0].Pulls != 14 ||
+		got.TopRepos[0].Rank != 2 {
+		t.Fatalf("Expected jiva as the top repo with rank 2 got %+v", got.TopRepos)
+	}
+	if len(got.Countries) != 2 || got.Countries[0].Key != "US" {
+		t.Fatalf("Expected US as the top country got %+v", got.Countries)
+	}
+	previous, last, ok := got.LastWeek()
+	if !ok || previous.Pulls != 7 || last.Pulls != 14 || last.Change == nil || *last.Change != 100 {
+		t.Fatalf("Expected pulls to double week over week got %+v %+v", previous, last)
+	}
+
+	// date range selects the second week only
+	got = report.Build(report.Config{
+		Start: time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2020, 8, 16, 0, 0, 0, 0, time.UTC),
+		Top:   1,
+	}, newRepos(), nil)
+	if got.Pulls != 14 || len(got.Days) != 7 || len(got.Weeks) != 1 || len(got.TopRepos) != 1 {
+		t.Fatalf("Expected the second week only got %+v", got)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	r := report.Build(report.Config{Title: "openebs <usage>"}, newRepos(), nil)
+
+	var html bytes.Buffer
+	err := report.WriteHTML(&html, r)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	for _, expect := range []string{
+		"<title>openebs &lt;usage&gt;</title>",
+		"<svg",
+		"openebs/jiva:latest",
+		// html/template escapes + as &#43;
+		"&#43;100.0%",
+	} {
+		if !strings.Contains(html.String(), expect) {
+			t.Fatalf("Expected HTML to contain %q got %s", expect, html.String())
+		}
+	}
+	for _, external := range []string{"<script", "<link", "src="} {
+		if strings.Contains(html.String(), external) {
+			t.Fatalf("Expected a self-contained HTML got %q", external)
+		}
+	}
+
+	var md bytes.Buffer
+	err = report.WriteMarkdown(&md, r)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	for _, expect := range []string{
+		"# openebs <usage>",
+		"| openebs/jiva | 14 | 66.7% | - | - |",
+		"| 2020-W33 | 14 | +100.0% |",
+		"| US | 14 | 66.7% |",
+	} {
+		if !strings.Contains(md.String(), expect) {
+			t.Fatalf("Expected Markdown to contain %q got %s", expect, md.String())
+		}
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+)
+
+const (
+	// chartWidth is the width of the charts in pixels
+	chartWidth int = 720
+
+	// barHeight is the height of a bar of horizontal bar charts
+	barHeight int = 22
+
+	// labelWidth is the width of the labels of horizontal bar charts
+	labelWidth int = 260
+
+	// columnChartHeight is the height of the plot of column charts
+	columnChartHeight int = 180
+
+	// barColor is the fill color of the bars
+	barColor string = "#4e79a7"
+)
+
+// barChart returns an inline SVG with a horizontal bar per given row.
+// Bars are scaled to the row with the most pulls.
+func barChart(rows []Row) template.HTML {
+	if len(rows) == 0 {
+		return ""
+	}
+	max := maxPulls(rows)
+	plotWidth := chartWidth - labelWidth - 80
+	height := len(rows) * barHeight
+	var b strings.Builder
+	fmt.Fprintf(
+		&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img">`,
+		chartWidth, height, chartWidth, height,
+	)
+	for i, row := range rows {
+		y := i * barHeight
+		width := 0
+		if max > 0 {
+			width = row.Pulls * plotWidth / max
+		}
+		fmt.Fprintf(
+			&b,
+			`<text x="%d" y="%d" font-size="12" text-anchor="end">%s</text>`,
+			labelWidth-8, y+15, html.EscapeString(truncate(row.Key, 40)),
+		)
+		fmt.Fprintf(
+			&b,
+			`<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%s: %d</title></rect>`,
+			labelWidth, y+3, width, barHeight-6, barColor, html.EscapeString(row.Key), row.Pulls,
+		)
+		fmt.Fprintf(
+			&b,
+			`<text x="%d" y="%d" font-size="12">%d</text>`,
+			labelWidth+width+6, y+15, row.Pulls,
+		)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// columnChart returns an inline SVG with a column per given row in
+// the given order e.g. pulls per day. The first & last keys label
+// the x axis & the most pulls label the y axis.
+func columnChart(rows []Row) template.HTML {
+	if len(rows) == 0 {
+		return ""
+	}
+	max := maxPulls(rows)
+	const left, bottom, top = 50, 24, 10
+	plotWidth := chartWidth - left - 10
+	height := columnChartHeight + bottom + top
+	step := float64(plotWidth) / float64(len(rows))
+	var b strings.Builder
+	fmt.Fprintf(
+		&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img">`,
+		chartWidth, height, chartWidth, height,
+	)
+	// axes
+	fmt.Fprintf(
+		&b,
+		`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`,
+		left, top+columnChartHeight, chartWidth-10, top+columnChartHeight,
+	)
+	fmt.Fprintf(
+		&b,
+		`<text x="%d" y="%d" font-size="11" text-anchor="end">%d</text>`,
+		left-6, top+10, max,
+	)
+	fmt.Fprintf(
+		&b,
+		`<text x="%d" y="%d" font-size="11" text-anchor="end">0</text>`,
+		left-6, top+columnChartHeight,
+	)
+	for i, row := range rows {
+		h := 0
+		if max > 0 {
+			h = row.Pulls * columnChartHeight / max
+		}
+		width := step * 0.8
+		if width < 1 {
+			width = 1
+		}
+		fmt.Fprintf(
+			&b,
+			`<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"><title>%s: %d</title></rect>`,
+			float64(left)+float64(i)*step+step*0.1,
+			top+columnChartHeight-h,
+			width,
+			h,
+			barColor,
+			html.EscapeString(row.Key),
+			row.Pulls,
+		)
+	}
+	fmt.Fprintf(
+		&b,
+		`<text x="%d" y="%d" font-size="11">%s</text>`,
+		left, height-6, html.EscapeString(rows[0].Key),
+	)
+	fmt.Fprintf(
+		&b,
+		`<text x="%d" y="%d" font-size="11" text-anchor="end">%s</text>`,
+		chartWidth-10, height-6, html.EscapeString(rows[len(rows)-1].Key),
+	)
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// maxPulls returns the most pulls of the given rows
+func maxPulls(rows []Row) int {
+	var max int
+	for _, row := range rows {
+		if row.Pulls > max {
+			max = row.Pulls
+		}
+	}
+	return max
+}
+
+// truncate shortens the given value to the given number of runes
+func truncate(value string, size int) string {
+	runes := []rune(value)
+	if len(runes) <= size {
+		return value
+	}
+	return string(runes[:size-1]) + "…"
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy decides how failed http requests are retried
+//
+// Requests are retried on network errors, 429 & 5xx responses with
+// an exponential backoff & jitter. A Retry-After header sent by the
+// server takes precedence over the backoff. Either is capped by
+// MaxDelay.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// BaseDelay is the delay before the first retry. It doubles
+	// with every retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by all the requests
+// unless changed via SetRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 5,
+	BaseDelay:  time.Second,
+	MaxDelay:   time.Minute,
+}
+
+// backoff returns the delay before the given retry where the first
+// retry is 1
+//
+// The delay is picked randomly between half & full of the
+// exponential delay. This avoids concurrent requests from retrying
+// at the same time.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(retry-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	return time.Duration(delay/2 + rand.Float64()*delay/2)
+}
+
+// capDelay returns the given delay capped by MaxDelay
+func (p RetryPolicy) capDelay(delay time.Duration) time.Duration {
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// isRetriable returns true if a request that resulted in the given
+// status code should be retried
+func isRetriable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusInternalServerError ||
+		statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
+
+// retryAfter returns the delay requested by the server via the
+// Retry-After header. It supports both delay seconds & http date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if t.Before(now) {
+			return 0, true
+		}
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// rateLimitReset returns the time at which the server allows
+// requests again if the server indicated that no more requests are
+// allowed via X-RateLimit-Remaining & X-RateLimit-Reset headers
+func rateLimitReset(header http.Header) (time.Time, bool) {
+	remaining := strings.TrimSpace(header.Get("X-RateLimit-Remaining"))
+	if remaining != "0" {
+		return time.Time{}, false
+	}
+	reset, err := strconv.ParseInt(strings.TrimSpace(header.Get("X-RateLimit-Reset")), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(reset, 0), true
+}
+
+// RateLimiter is a token bucket that limits the rate of requests
+//
+// RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	// rate is the number of tokens added per second. There is no
+	// limit if this is 0.
+	rate  float64
+	burst float64
+
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	mu          sync.Mutex
+}
+
+// NewRateLimiter returns a new instance of RateLimiter that allows
+// the given requests per second with the given burst. Rate of 0
+// allows unlimited requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks till a request is allowed
+func (r *RateLimiter) Wait() {
+	for {
+		delay := r.reserve()
+		if delay <= 0 {
+			return
+		}
+		time.Sleep(delay)
+	}
+}
+
+// reserve takes a token if available. Otherwise it returns the
+// delay after which a token may be available.
+func (r *RateLimiter) reserve() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(r.pausedUntil) {
+		return r.pausedUntil.Sub(now)
+	}
+	if r.rate <= 0 {
+		return 0
+	}
+	r.tokens = math.Min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	r.last = now
+	if r.tokens >= 1 {
+		r.tokens--
+		return 0
+	}
+	return time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
+}
+
+// PauseUntil blocks all requests till the given time
+func (r *RateLimiter) PauseUntil(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t.After(r.pausedUntil) {
+		r.pausedUntil = t
+	}
+}
+
+// RetryStats summarises the http requests made so far
+type RetryStats struct {
+	// Requests is the number of attempts including retries
+	Requests int
+	// Retries is the number of attempts that were retries
+	Retries int
+	// RateLimited is the number of 429 responses
+	RateLimited int
+	// GaveUp is the number of requests that failed even after
+	// all the retries
+	GaveUp int
+}
+
+var (
+	// retryPolicy is used by all the requests
+	retryPolicy = DefaultRetryPolicy
+
+	// limiter is shared by all the requests
+	limiter = NewRateLimiter(0, 1)
+
+	// retryStats is updated by all the requests
+	retryStats RetryStats
+
+	// retryMu guards the above
+	retryMu sync.Mutex
+)
+
+// SetRetryPolicy sets the retry policy of all the requests
+func SetRetryPolicy(policy RetryPolicy) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	retryPolicy = policy
+}
+
+// SetRateLimit limits all the requests to the given requests per
+// second with the given burst. Rate of 0 removes the limit.
+func SetRateLimit(rate float64, burst int) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	limiter = NewRateLimiter(rate, burst)
+}
+
+// GetRetryStats returns the summary of requests made so far
+func GetRetryStats() RetryStats {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	return retryStats
+}
+
+// currentRetryPolicy returns the retry policy & the rate limiter
+// to be used by a request
+func currentRetryPolicy() (RetryPolicy, *RateLimiter) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	return retryPolicy, limiter
+}
+
+// updateRetryStats updates the request summary via the given
+// function
+func updateRetryStats(update func(*RetryStats)) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	update(&retryStats)
+}
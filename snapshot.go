@@ -0,0 +1,184 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mayadata.io/quay-logs/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SnapshotFolder is the folder of the storage that has the
+	// popularity snapshots. It is hidden so that snapshots are not
+	// read as logs.
+	SnapshotFolder string = ".popularity"
+
+	// SnapshotTimeFormat is the format of the time in the file names
+	// of snapshots. It sorts lexically in the order of time.
+	SnapshotTimeFormat string = "20060102T150405Z"
+)
+
+// Snapshot is the popularity of the repos of a namespace at a time
+type Snapshot struct {
+	Namespace string    `json:"namespace"`
+	Time      time.Time `json:"time"`
+	// Repos are in the order of popularity
+	Repos []Popular `json:"repositories"`
+}
+
+// snapshotKey returns the storage key of the snapshot of the given
+// namespace & time i.e. `.popularity/<namespace>/<time>.json`
+func snapshotKey(namespace string, t time.Time) string {
+	return path.Join(
+		SnapshotFolder,
+		namespace,
+		t.UTC().Format(SnapshotTimeFormat)+".json",
+	)
+}
+
+// SaveSnapshot stores the given snapshot. A snapshot of the same
+// namespace & time is replaced.
+func SaveSnapshot(store storage.Storage, snapshot Snapshot) error {
+	snapshot.Time = snapshot.Time.UTC().Truncate(time.Second)
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to marshal snapshot: Namespace %q",
+			snapshot.Namespace,
+		)
+	}
+	key := snapshotKey(snapshot.Namespace, snapshot.Time)
+	err = store.Put(key, raw)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to store snapshot: Key %q",
+			key,
+		)
+	}
+	return nil
+}
+
+// ListSnapshots returns the times of the snapshots of the given
+// namespace from the oldest to the newest
+func ListSnapshots(store storage.Storage, namespace string) ([]time.Time, error) {
+	prefix := path.Join(SnapshotFolder, namespace) + "/"
+	keys, err := store.List(prefix)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to list snapshots: Namespace %q",
+			namespace,
+		)
+	}
+	var out []time.Time
+	for _, key := range keys {
+		name := strings.TrimSuffix(strings.TrimPrefix(key, prefix), ".json")
+		t, err := time.ParseInLocation(SnapshotTimeFormat, name, time.UTC)
+		if err != nil {
+			// not a snapshot e.g. a file of a nested folder
+			continue
+		}
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out, nil
+}
+
+// ListSnapshotNamespaces returns the namespaces having snapshots in
+// the lexical order
+func ListSnapshotNamespaces(store storage.Storage) ([]string, error) {
+	prefix := SnapshotFolder + "/"
+	keys, err := store.List(prefix)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to list snapshots: Prefix %q",
+			prefix,
+		)
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimPrefix(key, prefix), "/")
+		if len(parts) != 2 || seen[parts[0]] {
+			continue
+		}
+		seen[parts[0]] = true
+		out = append(out, parts[0])
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// LoadSnapshot returns the snapshot of the given namespace & time.
+// storage.ErrNotFound is returned if there is no such snapshot.
+func LoadSnapshot(store storage.Storage, namespace string, t time.Time) (Snapshot, error) {
+	key := snapshotKey(namespace, t)
+	raw, err := store.Get(key)
+	if err != nil {
+		return Snapshot{}, errors.Wrapf(
+			err,
+			"Failed to read snapshot: Key %q",
+			key,
+		)
+	}
+	var out Snapshot
+	err = json.Unmarshal(raw, &out)
+	if err != nil {
+		return Snapshot{}, errors.Wrapf(
+			err,
+			"Failed to unmarshal snapshot: Key %q",
+			key,
+		)
+	}
+	return out, nil
+}
+
+// LoadSnapshots returns the snapshots of the given namespace taken
+// from start till end (both inclusive) from the oldest to the
+// newest. Zero start or end means no limit.
+func LoadSnapshots(
+	store storage.Storage,
+	namespace string,
+	start time.Time,
+	end time.Time,
+) ([]Snapshot, error) {
+	times, err := ListSnapshots(store, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var out []Snapshot
+	for _, t := range times {
+		if (!start.IsZero() && t.Before(start)) || (!end.IsZero() && t.After(end)) {
+			continue
+		}
+		snapshot, err := LoadSnapshot(store, namespace, t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, snapshot)
+	}
+	return out, nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mayadata.io/quay-logs/storage"
+	"github.com/pkg/errors"
+)
+
+// SyncStateFileName is the name of the file that persists the
+// sync state. It is stored at the root of the logs storage. It is
+// a hidden file so that it does not get listed along with the
+// downloaded logs.
+const SyncStateFileName string = ".sync-state.json"
+
+// SyncState records the newest log fetched per repo. This is the
+// high water mark that makes subsequent downloads incremental.
+//
+// Marks of downloads restricted to some kinds of logs are kept apart
+// from the marks of downloads of all the kinds. Otherwise a download
+// of some kinds would skip the other kinds forever.
+//
+// SyncState is safe for concurrent use.
+type SyncState struct {
+	// Repos maps `namespace/name` to the datetime of the newest log
+	// fetched for the repo. Downloads restricted to some kinds are
+	// mapped from `namespace/name?kinds=kind1,kind2`.
+	Repos map[string]time.Time `json:"repos"`
+	// Seen maps the keys of Repos to the fingerprints of the logs
+	// fetched at the high water mark. Other logs of that second are
+	// fetched by the next run.
+	Seen map[string][]string `json:"seen,omitempty"`
+
+	// store is the storage this state is loaded from & saved to
+	store storage.Storage
+	mu    sync.Mutex
+}
+
+// LoadSyncState loads the sync state from SyncStateFileName of the
+// given storage. An empty state is returned if the file does not
+// exist.
+func LoadSyncState(store storage.Storage) (*SyncState, error) {
+	state := &SyncState{
+		Repos: map[string]time.Time{},
+		Seen:  map[string][]string{},
+		store: store,
+	}
+	raw, err := store.Get(SyncStateFileName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to read sync state: %s",
+			SyncStateFileName,
+		)
+	}
+	err = json.Unmarshal(raw, state)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to unmarshal sync state: %s",
+			SyncStateFileName,
+		)
+	}
+	if state.Repos == nil {
+		state.Repos = map[string]time.Time{}
+	}
+	if state.Seen == nil {
+		state.Seen = map[string][]string{}
+	}
+	return state, nil
+}
+
+// syncStateKey returns the key of the high water mark of the given
+// repo & kinds. Empty kinds stand for all the kinds.
+func syncStateKey(namespace string, name string, kinds []LogKind) string {
+	key := path.Join(namespace, name)
+	if len(kinds) == 0 {
+		return key
+	}
+	unique := map[string]bool{}
+	var names []string
+	for _, kind := range kinds {
+		if unique[string(kind)] {
+			continue
+		}
+		unique[string(kind)] = true
+		names = append(names, string(kind))
+	}
+	sort.Strings(names)
+	return key + "?kinds=" + strings.Join(names, ",")
+}
+
+// HighWaterMark returns the datetime of the newest log fetched for
+// the given repo & kinds. Zero time is returned if the repo was
+// never fetched for these kinds.
+func (s *SyncState) HighWaterMark(namespace string, name string, kinds []LogKind) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Repos[syncStateKey(namespace, name, kinds)]
+}
+
+// SeenAtHighWaterMark returns the fingerprints of the logs fetched
+// at the high water mark of the given repo & kinds
+func (s *SyncState) SeenAtHighWaterMark(namespace string, name string, kinds []LogKind) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.Seen[syncStateKey(namespace, name, kinds)]...)
+}
+
+// Update sets the high water mark of the given repo & kinds if the
+// given datetime is newer than or same as the current one. Seen has
+// the fingerprints of the logs fetched at the given datetime.
+func (s *SyncState) Update(namespace string, name string, kinds []LogKind, newest time.Time, seen []string) {
+	if newest.IsZero() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := syncStateKey(namespace, name, kinds)
+	if newest.Before(s.Repos[key]) {
+		return
+	}
+	s.Repos[key] = newest.UTC()
+	s.Seen[key] = seen
+}
+
+// Save writes the state to its storage
+//
+// Storages write files atomically. This avoids a corrupt state if
+// the run gets killed.
+func (s *SyncState) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal sync state")
+	}
+	err = s.store.Put(SyncStateFileName, raw)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to save sync state",
+		)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+func TestSyncState(t *testing.T) {
+	store := storage.NewMemory()
+	state, err := gmetrics.LoadSyncState(store)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if mark := state.HighWaterMark("openebs", "jiva", nil); !mark.IsZero() {
+		t.Fatalf("Expected no high water mark got %s", mark)
+	}
+
+	kinds := []gmetrics.LogKind{gmetrics.KindPullRepo, gmetrics.KindPushRepo}
+	state.Update("openebs", "jiva", nil, now, []string{"a"})
+	state.Update("openebs", "jiva", kinds, now.Add(-time.Hour), []string{"b"})
+	// older logs do not move the mark back
+	state.Update("openebs", "jiva", nil, now.Add(-2*time.Hour), []string{"c"})
+	// zero time tells that no log was received
+	state.Update("openebs", "cstor", nil, time.Time{}, nil)
+	err = state.Save()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	loaded, err := gmetrics.LoadSyncState(store)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	var tests = map[string]struct {
+		name       string
+		kinds      []gmetrics.LogKind
+		expect     time.Time
+		expectSeen []string
+	}{
+		"all kinds": {
+			name:       "jiva",
+			expect:     now,
+			expectSeen: []string{"a"},
+		},
+		// kinds are matched irrespective of their order & repeats
+		"some kinds": {
+			name:       "jiva",
+			kinds:      []gmetrics.LogKind{gmetrics.KindPushRepo, gmetrics.KindPullRepo, gmetrics.KindPushRepo},
+			expect:     now.Add(-time.Hour),
+			expectSeen: []string{"b"},
+		},
+		"other kinds": {
+			name:  "jiva",
+			kinds: []gmetrics.LogKind{gmetrics.KindPullRepo},
+		},
+		"repo without logs": {
+			name: "cstor",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			mark := loaded.HighWaterMark("openebs", mock.name, mock.kinds)
+			if !mark.Equal(mock.expect) {
+				t.Fatalf("Expected high water mark %s got %s", mock.expect, mark)
+			}
+			seen := loaded.SeenAtHighWaterMark("openebs", mock.name, mock.kinds)
+			if !reflect.DeepEqual(seen, mock.expectSeen) {
+				t.Fatalf("Expected seen %q got %q", mock.expectSeen, seen)
+			}
+		})
+	}
+}
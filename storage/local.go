@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Local stores files in a folder of the local filesystem
+type Local struct {
+	// Root is the folder that has all the files
+	Root string
+}
+
+// NewLocal returns a new instance of Local rooted at the given
+// folder
+func NewLocal(root string) *Local {
+	return &Local{
+		Root: root,
+	}
+}
+
+// filename returns the file of the given key
+func (l *Local) filename(key string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(normaliseKey(key)))
+}
+
+// Put writes the file of the given key atomically. Folders are
+// created as needed.
+func (l *Local) Put(key string, data []byte) error {
+	filename := l.filename(key)
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to create folder of %s",
+			filename,
+		)
+	}
+
+	// NOTE:
+	//	Content is written to a temporary file which is then renamed.
+	// Readers hence never see a partially written file.
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+"-*")
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to create temporary file for %s",
+			filename,
+		)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to write %s",
+			filename,
+		)
+	}
+	return nil
+}
+
+// Get reads the file of the given key
+func (l *Local) Get(key string) ([]byte, error) {
+	filename := l.filename(key)
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotFound, "%s", filename)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to read %s",
+			filename,
+		)
+	}
+	return data, nil
+}
+
+// List walks the root folder for the keys having the given prefix
+func (l *Local) List(prefix string) ([]string, error) {
+	prefix = strings.TrimLeft(prefix, "/")
+	var out []string
+	err := filepath.Walk(l.Root, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fpath == l.Root {
+				// nothing is stored yet
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Root, fpath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if isHidden(key) || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		out = append(out, key)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to list %s: Prefix %q",
+			l.Root,
+			prefix,
+		)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Delete removes the file of the given key
+func (l *Local) Delete(key string) error {
+	filename := l.filename(key)
+	err := os.Remove(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(
+			err,
+			"Failed to delete %s",
+			filename,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Memory stores files in memory. It is meant for tests & for runs
+// that do not need to persist the files.
+type Memory struct {
+	files map[string][]byte
+	mu    sync.Mutex
+}
+
+// NewMemory returns a new empty instance of Memory
+func NewMemory() *Memory {
+	return &Memory{
+		files: map[string][]byte{},
+	}
+}
+
+// Put stores a copy of the given data
+func (m *Memory) Put(key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[normaliseKey(key)] = append([]byte(nil), data...)
+	return nil
+}
+
+// Get returns a copy of the stored data
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, found := m.files[normaliseKey(key)]
+	if !found {
+		return nil, errors.Wrapf(ErrNotFound, "%s", key)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// List returns the stored keys having the given prefix
+func (m *Memory) List(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix = strings.TrimLeft(prefix, "/")
+	var out []string
+	for key := range m.files {
+		if isHidden(key) || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Delete removes the stored data
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.files, normaliseKey(key))
+	return nil
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+)
+
+// S3Config is used to initialise a S3 instance
+type S3Config struct {
+	// Endpoint is the host & optional port of the object storage
+	// e.g. s3.amazonaws.com or localhost:9000
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	// Prefix is prepended to all the keys e.g. quay-logs/
+	Prefix string
+	// Region of the bucket. Setting this avoids a request to find
+	// the region of the bucket.
+	Region string
+	// Insecure when set to true uses http instead of https
+	Insecure bool
+}
+
+// S3 stores files in a bucket of S3 compatible object storage e.g.
+// AWS S3 or MinIO
+type S3 struct {
+	S3Config
+
+	client *minio.Client
+}
+
+// NewS3 returns a new instance of S3
+func NewS3(config S3Config) (*S3, error) {
+	if config.Endpoint == "" {
+		return nil, errors.Errorf("Missing S3 endpoint")
+	}
+	if config.Bucket == "" {
+		return nil, errors.Errorf("Missing S3 bucket")
+	}
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: !config.Insecure,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to initialise S3 client: Endpoint %q",
+			config.Endpoint,
+		)
+	}
+	config.Prefix = normaliseKey(config.Prefix)
+	return &S3{
+		S3Config: config,
+		client:   client,
+	}, nil
+}
+
+// object returns the object name of the given key
+func (s *S3) object(key string) string {
+	return path.Join(s.Prefix, normaliseKey(key))
+}
+
+// Put uploads the given data as the object of the given key
+func (s *S3) Put(key string, data []byte) error {
+	_, err := s.client.PutObject(
+		context.Background(),
+		s.Bucket,
+		s.object(key),
+		bytes.NewReader(data),
+		int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType(key)},
+	)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to put S3 object: Bucket %q: Object %q",
+			s.Bucket,
+			s.object(key),
+		)
+	}
+	return nil
+}
+
+// Get downloads the object of the given key
+func (s *S3) Get(key string) ([]byte, error) {
+	obj, err := s.client.GetObject(
+		context.Background(),
+		s.Bucket,
+		s.object(key),
+		minio.GetObjectOptions{},
+	)
+	if err == nil {
+		defer obj.Close()
+		var data []byte
+		data, err = ioutil.ReadAll(obj)
+		if err == nil {
+			return data, nil
+		}
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, errors.Wrapf(ErrNotFound, "%s", s.object(key))
+	}
+	return nil, errors.Wrapf(
+		err,
+		"Failed to get S3 object: Bucket %q: Object %q",
+		s.Bucket,
+		s.object(key),
+	)
+}
+
+// List lists the objects having the given prefix
+func (s *S3) List(prefix string) ([]string, error) {
+	var out []string
+	objPrefix := normaliseKey(prefix)
+	if strings.HasSuffix(prefix, "/") && objPrefix != "" {
+		// retain the folder boundary of the prefix
+		objPrefix += "/"
+	}
+	if s.Prefix != "" {
+		// NOTE:
+		//	The folder boundary of Prefix is always retained. Else
+		// objects of sibling prefixes e.g. quay-logs-archive/ get
+		// listed along with the ones of quay-logs/
+		objPrefix = s.Prefix + "/" + objPrefix
+	}
+	objects := s.client.ListObjects(
+		context.Background(),
+		s.Bucket,
+		minio.ListObjectsOptions{
+			Prefix:    objPrefix,
+			Recursive: true,
+		},
+	)
+	for obj := range objects {
+		if obj.Err != nil {
+			return nil, errors.Wrapf(
+				obj.Err,
+				"Failed to list S3 objects: Bucket %q: Prefix %q",
+				s.Bucket,
+				objPrefix,
+			)
+		}
+		key := obj.Key
+		if s.Prefix != "" {
+			key = strings.TrimPrefix(key, s.Prefix+"/")
+		}
+		if isHidden(key) {
+			continue
+		}
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Delete removes the object of the given key
+func (s *S3) Delete(key string) error {
+	err := s.client.RemoveObject(
+		context.Background(),
+		s.Bucket,
+		s.object(key),
+		minio.RemoveObjectOptions{},
+	)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to delete S3 object: Bucket %q: Object %q",
+			s.Bucket,
+			s.object(key),
+		)
+	}
+	return nil
+}
+
+// contentType returns the content type of the given key based on
+// its extension
+func contentType(key string) string {
+	switch {
+	case strings.HasSuffix(key, ".json"):
+		return "application/json"
+	case strings.HasSuffix(key, ".ndjson"):
+		return "application/x-ndjson"
+	case strings.HasSuffix(key, ".gz"):
+		return "application/gzip"
+	case strings.HasSuffix(key, ".zst"):
+		return "application/zstd"
+	default:
+		return "application/octet-stream"
+	}
+}
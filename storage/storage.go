@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package storage stores the files downloaded from quay in local
+// folders, in memory or in S3 compatible object storage.
+package storage
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when the requested key does not exist
+var ErrNotFound = errors.New("Key not found")
+
+// Storage stores files by keys. Keys are slash separated paths
+// relative to the root of the storage e.g.
+// `openebs/jiva/Aug-06-2020-09:13:10-0.json`
+//
+// Implementations are safe for concurrent use.
+type Storage interface {
+	// Put creates or replaces the file of the given key
+	Put(key string, data []byte) error
+
+	// Get returns the file of the given key. An error wrapping
+	// ErrNotFound is returned if the key does not exist.
+	Get(key string) ([]byte, error)
+
+	// List returns the keys that start with the given prefix in
+	// lexical order. Hidden files i.e. names starting with '.' are
+	// not listed.
+	List(prefix string) ([]string, error)
+
+	// Delete removes the file of the given key. Deleting a key that
+	// does not exist is not an error.
+	Delete(key string) error
+}
+
+// normaliseKey returns the key without leading & trailing slashes
+func normaliseKey(key string) string {
+	return strings.Trim(key, "/")
+}
+
+// isHidden returns true if the name of the file of the given key
+// starts with '.'
+func isHidden(key string) bool {
+	return strings.HasPrefix(key[strings.LastIndex(key, "/")+1:], ".")
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage_test
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// fakeS3 is a minimal S3 compatible server. It supports path style
+// put, get, delete & list objects v2 requests of a single bucket.
+type fakeS3 struct {
+	bucket  string
+	objects map[string][]byte
+	mu      sync.Mutex
+}
+
+// listBucketResult is the response of list objects v2
+type listBucketResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []listBucketObject
+}
+
+// listBucketObject is an object of list objects v2 response
+type listBucketObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+// s3Error is the error response of S3
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+	Key     string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		xml.NewEncoder(w).Encode(s3Error{Code: "NoSuchBucket", Message: parts[0]})
+		return
+	}
+	var key string
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut:
+		data, err := readBody(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = data
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet:
+		data, found := f.objects[key]
+		if !found {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			xml.NewEncoder(w).Encode(s3Error{Code: "NoSuchKey", Message: "Key not found", Key: key})
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list writes the objects having the given prefix
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	result := listBucketResult{
+		Name:    f.bucket,
+		Prefix:  prefix,
+		MaxKeys: 1000,
+	}
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result.Contents = append(result.Contents, listBucketObject{
+			Key:          key,
+			LastModified: time.Now().UTC().Format(time.RFC3339),
+			ETag:         `"etag"`,
+			Size:         len(f.objects[key]),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// readBody reads the body of the given put request. Chunks of aws
+// streaming signature are decoded.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return ioutil.ReadAll(r.Body)
+	}
+	var out []byte
+	reader := bufio.NewReader(r.Body)
+	for {
+		// each chunk is `<hex size>;chunk-signature=<sig>\r\n<data>\r\n`
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(header), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return out, nil
+		}
+		chunk := make([]byte, size+2)
+		_, err = io.ReadFull(reader, chunk)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk[:size]...)
+	}
+}
+
+// newStores returns an empty instance of every storage
+func newStores(t *testing.T) (map[string]storage.Storage, func()) {
+	dir, err := ioutil.TempDir("", "storage-test")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	server := httptest.NewServer(&fakeS3{
+		bucket:  "quay-logs",
+		objects: map[string][]byte{},
+	})
+	s3, err := storage.NewS3(storage.S3Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		AccessKey: "access",
+		SecretKey: "secret",
+		Bucket:    "quay-logs",
+		Prefix:    "backup/",
+		Region:    "us-east-1",
+		Insecure:  true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	return map[string]storage.Storage{
+		"local":  storage.NewLocal(dir),
+		"memory": storage.NewMemory(),
+		"s3":     s3,
+	}, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStoragePutGet(t *testing.T) {
+	stores, cleanup := newStores(t)
+	defer cleanup()
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			err := store.Put("openebs/jiva/Aug-06-2020-09:13:10-0.json", []byte("first"))
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			err = store.Put("openebs/jiva/Aug-06-2020-09:13:10-0.json", []byte("second"))
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			got, err := store.Get("openebs/jiva/Aug-06-2020-09:13:10-0.json")
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if string(got) != "second" {
+				t.Fatalf("Expected %q got %q", "second", got)
+			}
+			_, err = store.Get("openebs/jiva/missing.json")
+			if !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("Expected ErrNotFound got %v", err)
+			}
+		})
+	}
+}
+
+func TestStorageList(t *testing.T) {
+	stores, cleanup := newStores(t)
+	defer cleanup()
+
+	keys := []string{
+		"openebs/jiva/b.json",
+		"openebs/jiva/a.json",
+		"openebs/jiva-operator/a.json",
+		"openebs/m-apiserver/a.json",
+		".sync-state.json",
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range keys {
+				err := store.Put(key, []byte("{}"))
+				if err != nil {
+					t.Fatalf("Expected no error got %v", err)
+				}
+			}
+			var tests = map[string]struct {
+				prefix string
+				expect []string
+			}{
+				"all": {
+					prefix: "",
+					expect: []string{
+						"openebs/jiva-operator/a.json",
+						"openebs/jiva/a.json",
+						"openebs/jiva/b.json",
+						"openebs/m-apiserver/a.json",
+					},
+				},
+				"folder": {
+					prefix: "openebs/jiva/",
+					expect: []string{
+						"openebs/jiva/a.json",
+						"openebs/jiva/b.json",
+					},
+				},
+				"missing": {
+					prefix: "litmuschaos/",
+				},
+			}
+			for tname, test := range tests {
+				got, err := store.List(test.prefix)
+				if err != nil {
+					t.Fatalf("%s: Expected no error got %v", tname, err)
+				}
+				if !reflect.DeepEqual(got, test.expect) {
+					t.Fatalf("%s: Expected %v got %v", tname, test.expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestS3ListSiblingPrefixes(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{
+		bucket:  "quay-logs",
+		objects: map[string][]byte{},
+	})
+	defer server.Close()
+
+	stores := map[string]*storage.S3{}
+	for _, prefix := range []string{"openebs", "openebs-partner"} {
+		s3, err := storage.NewS3(storage.S3Config{
+			Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+			AccessKey: "access",
+			SecretKey: "secret",
+			Bucket:    "quay-logs",
+			Prefix:    prefix,
+			Region:    "us-east-1",
+			Insecure:  true,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		err = s3.Put(prefix+"/jiva/a.json", []byte("{}"))
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		stores[prefix] = s3
+	}
+	for prefix, s3 := range stores {
+		got, err := s3.List("")
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		expect := []string{prefix + "/jiva/a.json"}
+		if !reflect.DeepEqual(got, expect) {
+			t.Fatalf("Prefix %q: Expected %v got %v", prefix, expect, got)
+		}
+	}
+}
+
+func TestStorageDelete(t *testing.T) {
+	stores, cleanup := newStores(t)
+	defer cleanup()
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				err := store.Put(fmt.Sprintf("openebs/jiva/%d.json", i), []byte("{}"))
+				if err != nil {
+					t.Fatalf("Expected no error got %v", err)
+				}
+			}
+			err := store.Delete("openebs/jiva/0.json")
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			err = store.Delete("openebs/jiva/missing.json")
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			got, err := store.List("")
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+			if !reflect.DeepEqual(got, []string{"openebs/jiva/1.json"}) {
+				t.Fatalf("Expected [openebs/jiva/1.json] got %v", got)
+			}
+		})
+	}
+}
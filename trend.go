@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics
+
+import (
+	"math"
+)
+
+// TrendStatus tells if a repo is new, removed or present in both of
+// the compared snapshots
+type TrendStatus string
+
+const (
+	// TrendKept means the repo is present in both snapshots
+	TrendKept TrendStatus = "kept"
+
+	// TrendNew means the repo is present in the newer snapshot only
+	TrendNew TrendStatus = "new"
+
+	// TrendRemoved means the repo is present in the older snapshot
+	// only
+	TrendRemoved TrendStatus = "removed"
+)
+
+// RepoTrend is the change in popularity of a repo between two
+// snapshots
+type RepoTrend struct {
+	Name   string      `json:"name"`
+	Status TrendStatus `json:"status"`
+	// FromRank & ToRank start at 1. These are 0 if the repo is not
+	// present in the respective snapshot.
+	FromRank int `json:"from_rank"`
+	ToRank   int `json:"to_rank"`
+	// RankChange is positive if the repo moved up in the ranking.
+	// It is 0 for new & removed repos.
+	RankChange int     `json:"rank_change"`
+	FromScore  float64 `json:"from_score"`
+	ToScore    float64 `json:"to_score"`
+	ScoreDelta float64 `json:"score_delta"`
+	// History has the scores of the repo in the snapshots used for
+	// the history from the oldest to the newest. NaN means the repo
+	// is not present in that snapshot.
+	History []float64 `json:"-"`
+}
+
+// CompareSnapshots returns the change in popularity of the repos
+// between the given snapshots. The given history snapshots are used
+// to fill the history of every repo.
+//
+// Repos are in the order of their rank in the newer snapshot
+// followed by the removed repos in the order of their rank in the
+// older snapshot.
+func CompareSnapshots(from, to Snapshot, history []Snapshot) []RepoTrend {
+	fromRanks := ranksOf(from)
+	toRanks := ranksOf(to)
+
+	var out []RepoTrend
+	for i, repo := range to.Repos {
+		trend := RepoTrend{
+			Name:    repo.Name,
+			Status:  TrendNew,
+			ToRank:  i + 1,
+			ToScore: repo.Popularity,
+		}
+		if rank, found := fromRanks[repo.Name]; found {
+			trend.Status = TrendKept
+			trend.FromRank = rank
+			trend.FromScore = from.Repos[rank-1].Popularity
+			trend.RankChange = rank - trend.ToRank
+		}
+		trend.ScoreDelta = trend.ToScore - trend.FromScore
+		out = append(out, trend)
+	}
+	for i, repo := range from.Repos {
+		if _, found := toRanks[repo.Name]; found {
+			continue
+		}
+		out = append(out, RepoTrend{
+			Name:       repo.Name,
+			Status:     TrendRemoved,
+			FromRank:   i + 1,
+			FromScore:  repo.Popularity,
+			ScoreDelta: -repo.Popularity,
+		})
+	}
+
+	for i := range out {
+		for _, snapshot := range history {
+			score := math.NaN()
+			for _, repo := range snapshot.Repos {
+				if repo.Name == out[i].Name {
+					score = repo.Popularity
+					break
+				}
+			}
+			out[i].History = append(out[i].History, score)
+		}
+	}
+	return out
+}
+
+// ranksOf returns the rank of every repo of the given snapshot
+func ranksOf(snapshot Snapshot) map[string]int {
+	ranks := map[string]int{}
+	for i, repo := range snapshot.Repos {
+		if _, found := ranks[repo.Name]; !found {
+			ranks[repo.Name] = i + 1
+		}
+	}
+	return ranks
+}
+
+// sparks are the bars of a sparkline from the lowest to the highest
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline returns the given values as a line of bars scaled from
+// the lowest to the highest value e.g. ▁▃▅█. NaN values are shown
+// as spaces.
+func Sparkline(values []float64) string {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	out := make([]rune, 0, len(values))
+	for _, v := range values {
+		switch {
+		case math.IsNaN(v):
+			out = append(out, ' ')
+		case max == min:
+			// flat line when all values are same
+			out = append(out, sparks[len(sparks)/2-1])
+		default:
+			index := int((v - min) / (max - min) * float64(len(sparks)-1))
+			out = append(out, sparks[index])
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+	"github.com/mayadata.io/quay-logs/storage"
+)
+
+// newSnapshot returns a snapshot of openebs namespace at the given
+// time with repos having the given popularity in the given order
+func newSnapshot(t time.Time, names []string, scores []float64) gmetrics.Snapshot {
+	snapshot := gmetrics.Snapshot{Namespace: "openebs", Time: t}
+	for i, name := range names {
+		snapshot.Repos = append(snapshot.Repos, gmetrics.Popular{
+			Namespace:  "openebs",
+			Name:       name,
+			Popularity: scores[i],
+		})
+	}
+	return snapshot
+}
+
+func TestSnapshots(t *testing.T) {
+	store := storage.NewMemory()
+	day := time.Date(2020, 8, 6, 9, 13, 10, 0, time.UTC)
+	for i := 2; i >= 0; i-- {
+		err := gmetrics.SaveSnapshot(store, newSnapshot(
+			day.AddDate(0, 0, i),
+			[]string{"jiva"},
+			[]float64{float64(i)},
+		))
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+	}
+	times, err := gmetrics.ListSnapshots(store, "openebs")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	expect := []time.Time{day, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2)}
+	if !reflect.DeepEqual(times, expect) {
+		t.Fatalf("Expected snapshots %v got %v", expect, times)
+	}
+	got, err := gmetrics.LoadSnapshots(store, "openebs", day.AddDate(0, 0, 1), time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(got) != 2 || got[0].Repos[0].Popularity != 1 || got[1].Repos[0].Popularity != 2 {
+		t.Fatalf("Expected 2 newest snapshots got %+v", got)
+	}
+
+	// snapshots are not logs
+	keys, err := gmetrics.ListJSONKeys(store, "")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("Expected no log files got %v", keys)
+	}
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	day := time.Date(2020, 8, 6, 0, 0, 0, 0, time.UTC)
+	first := newSnapshot(day, []string{"jiva", "cstor", "maya"}, []float64{30, 20, 10})
+	second := newSnapshot(day.AddDate(0, 0, 1), []string{"cstor", "jiva"}, []float64{35, 25})
+	third := newSnapshot(day.AddDate(0, 0, 2), []string{"cstor", "mayastor", "jiva"}, []float64{40, 30, 20})
+
+	got := gmetrics.CompareSnapshots(first, third, []gmetrics.Snapshot{first, second, third})
+	expect := []gmetrics.RepoTrend{
+		{Name: "cstor", Status: gmetrics.TrendKept, FromRank: 2, ToRank: 1, RankChange: 1, FromScore: 20, ToScore: 40, ScoreDelta: 20},
+		{Name: "mayastor", Status: gmetrics.TrendNew, ToRank: 2, ToScore: 30, ScoreDelta: 30},
+		{Name: "jiva", Status: gmetrics.TrendKept, FromRank: 1, ToRank: 3, RankChange: -2, FromScore: 30, ToScore: 20, ScoreDelta: -10},
+		{Name: "maya", Status: gmetrics.TrendRemoved, FromRank: 3, FromScore: 10, ScoreDelta: -10},
+	}
+	expectHistory := map[string][]float64{
+		"cstor":    {20, 35, 40},
+		"mayastor": {math.NaN(), math.NaN(), 30},
+		"jiva":     {30, 25, 20},
+		"maya":     {10, math.NaN(), math.NaN()},
+	}
+	if len(got) != len(expect) {
+		t.Fatalf("Expected %d trends got %+v", len(expect), got)
+	}
+	for i := range got {
+		history := got[i].History
+		got[i].History = nil
+		if !reflect.DeepEqual(got[i], expect[i]) {
+			t.Fatalf("Expected trend %+v got %+v", expect[i], got[i])
+		}
+		for j, score := range expectHistory[got[i].Name] {
+			if score != history[j] && !(math.IsNaN(score) && math.IsNaN(history[j])) {
+				t.Fatalf("Expected history %v of %s got %v", expectHistory[got[i].Name], got[i].Name, history)
+			}
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	var tests = map[string]struct {
+		values []float64
+		expect string
+	}{
+		"empty": {
+			expect: "",
+		},
+		"rising": {
+			values: []float64{0, 1, 2, 3, 4, 5, 6, 7},
+			expect: "▁▂▃▄▅▆▇█",
+		},
+		"flat": {
+			values: []float64{5, 5, 5},
+			expect: "▄▄▄",
+		},
+		"missing": {
+			values: []float64{math.NaN(), 1, 7},
+			expect: " ▁█",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := gmetrics.Sparkline(test.values)
+			if got != test.expect {
+				t.Fatalf("Expected sparkline %q got %q", test.expect, got)
+			}
+		})
+	}
+}
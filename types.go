@@ -16,11 +16,9 @@ limitations under the License.
 
 package growthmetrics
 
-// import (
-// 	"context"
-// 	"net"
-// 	"strings"
-// )
+import (
+	"time"
+)
 
 const (
 	// MonDDYYYYDateFormat is used for file names where these files are
@@ -29,6 +27,17 @@ const (
 
 	// QuayLogDateFormat is the format found in quay logs
 	QuayLogDateFormat string = "02 Jan 2006"
+
+	// QuayTimeFormat is the format of timestamps found in quay API
+	// responses e.g. datetime of a log or start_time of a log list
+	QuayTimeFormat string = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+	// QuayQueryDateFormat is the format expected by quay APIs
+	// for starttime & endtime query parameters
+	QuayQueryDateFormat string = "01/02/2006"
+
+	// ISODateFormat is the ISO 8601 calendar date format
+	ISODateFormat string = "2006-01-02"
 )
 
 // Popular holds the fields that represent an image
@@ -46,7 +55,8 @@ type Popular struct {
 
 // PopularList holds a list of Popular items
 type PopularList struct {
-	Items []Popular `json:"repositories"`
+	NextPage string    `json:"next_page"`
+	Items    []Popular `json:"repositories"`
 }
 
 // ResolvedIP represents quay.io repo's resolved IP details
@@ -55,22 +65,183 @@ type ResolvedIP struct {
 	SyncToken      string `json:"sync_token"`
 	Service        string `json:"service"`
 	Provider       string `json:"provider"`
+	AWSRegion      string `json:"aws_region,omitempty"`
+	// Extras has the fields not modelled above
+	Extras Extras `json:"-"`
 }
 
 // Metadata represents quay.io repo's metadata
+//
+// Fields are the union of the metadata of all kinds of logs. Use
+// Log.KindMetadata for the fields of a kind only.
 type Metadata struct {
 	Repo       string     `json:"repo"`
 	Tag        string     `json:"tag"`
 	Namespace  string     `json:"namespace"`
 	ResolvedIP ResolvedIP `json:"resolved_ip"`
+
+	// ManifestDigest is the digest of the pulled, pushed or tagged
+	// manifest e.g. sha256:...
+	ManifestDigest string `json:"manifest_digest,omitempty"`
+	// UserAgent is the user agent of the client e.g. docker/19.03.8
+	UserAgent string `json:"user-agent,omitempty"`
+	// Username is the user or robot that performed the action
+	Username string `json:"username,omitempty"`
+	// Token & TokenCode identify the access token if one was used
+	Token     string `json:"token,omitempty"`
+	TokenCode string `json:"token_code,omitempty"`
+	// Public is set for pulls of public repos
+	Public *bool `json:"public,omitempty"`
+	// Tags are the tags of a push
+	Tags []string `json:"tags,omitempty"`
+	// Image & OriginalImage are the image ids of a tag change
+	Image         string `json:"image,omitempty"`
+	OriginalImage string `json:"original_image,omitempty"`
+	// OriginalManifestDigest is the digest a tag pointed to before
+	// it was moved or reverted
+	OriginalManifestDigest string `json:"original_manifest_digest,omitempty"`
+	// Visibility is the new visibility of the repo i.e. public or
+	// private
+	Visibility string `json:"visibility,omitempty"`
+	// Verb is the verb of a pull e.g. squash
+	Verb string `json:"verb,omitempty"`
+	// BuildID & TriggerID identify a build & its trigger
+	BuildID   string `json:"build_id,omitempty"`
+	TriggerID string `json:"trigger_id,omitempty"`
+
+	// Extras has the fields not modelled above
+	Extras Extras `json:"-"`
+}
+
+// Avatar is the avatar of a user, robot or organization
+type Avatar struct {
+	Name  string `json:"name"`
+	Hash  string `json:"hash"`
+	Color string `json:"color"`
+	Kind  string `json:"kind"`
+	// Extras has the fields not modelled above
+	Extras Extras `json:"-"`
+}
+
+// Performer is the user or robot that caused a log
+type Performer struct {
+	// Kind is either user or robot
+	Kind    string  `json:"kind"`
+	Name    string  `json:"name"`
+	IsRobot bool    `json:"is_robot"`
+	Avatar  *Avatar `json:"avatar,omitempty"`
+	// Extras has the fields not modelled above
+	Extras Extras `json:"-"`
+}
+
+// LogNamespace is the namespace i.e. user or organization a log
+// belongs to
+type LogNamespace struct {
+	// Kind is either user or org
+	Kind   string  `json:"kind"`
+	Name   string  `json:"name"`
+	Avatar *Avatar `json:"avatar,omitempty"`
+	// Extras has the fields not modelled above
+	Extras Extras `json:"-"`
 }
 
 // Log represents a quay.io repo's logs
 type Log struct {
 	IP       string   `json:"ip"`
-	Kind     string   `json:"kind"`
+	Kind     LogKind  `json:"kind"`
 	Datetime string   `json:"datetime"`
 	Metadata Metadata `json:"metadata"`
+	// Performer is not set for anonymous actions e.g. pulls of
+	// public repos
+	Performer *Performer    `json:"performer,omitempty"`
+	Namespace *LogNamespace `json:"namespace,omitempty"`
+	// Geo is set by the GeoIP enrichment of the IP & never by quay
+	Geo *Geo `json:"geo,omitempty"`
+	// Extras has the fields not modelled above
+	Extras Extras `json:"-"`
+}
+
+// Time returns the parsed datetime of this log
+func (l Log) Time() (time.Time, error) {
+	return ParseQuayTime(l.Datetime)
+}
+
+// UnmarshalJSON keeps the unknown fields in Extras
+func (l *Log) UnmarshalJSON(raw []byte) (err error) {
+	type plain Log
+	l.Extras, err = unmarshalWithExtras(raw, (*plain)(l))
+	return err
+}
+
+// MarshalJSON writes the unknown fields kept in Extras
+func (l Log) MarshalJSON() ([]byte, error) {
+	type plain Log
+	return marshalWithExtras(plain(l), l.Extras)
+}
+
+// UnmarshalJSON keeps the unknown fields in Extras
+func (m *Metadata) UnmarshalJSON(raw []byte) (err error) {
+	type plain Metadata
+	m.Extras, err = unmarshalWithExtras(raw, (*plain)(m))
+	return err
+}
+
+// MarshalJSON writes the unknown fields kept in Extras
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	type plain Metadata
+	return marshalWithExtras(plain(m), m.Extras)
+}
+
+// UnmarshalJSON keeps the unknown fields in Extras
+func (r *ResolvedIP) UnmarshalJSON(raw []byte) (err error) {
+	type plain ResolvedIP
+	r.Extras, err = unmarshalWithExtras(raw, (*plain)(r))
+	return err
+}
+
+// MarshalJSON writes the unknown fields kept in Extras
+func (r ResolvedIP) MarshalJSON() ([]byte, error) {
+	type plain ResolvedIP
+	return marshalWithExtras(plain(r), r.Extras)
+}
+
+// UnmarshalJSON keeps the unknown fields in Extras
+func (a *Avatar) UnmarshalJSON(raw []byte) (err error) {
+	type plain Avatar
+	a.Extras, err = unmarshalWithExtras(raw, (*plain)(a))
+	return err
+}
+
+// MarshalJSON writes the unknown fields kept in Extras
+func (a Avatar) MarshalJSON() ([]byte, error) {
+	type plain Avatar
+	return marshalWithExtras(plain(a), a.Extras)
+}
+
+// UnmarshalJSON keeps the unknown fields in Extras
+func (p *Performer) UnmarshalJSON(raw []byte) (err error) {
+	type plain Performer
+	p.Extras, err = unmarshalWithExtras(raw, (*plain)(p))
+	return err
+}
+
+// MarshalJSON writes the unknown fields kept in Extras
+func (p Performer) MarshalJSON() ([]byte, error) {
+	type plain Performer
+	return marshalWithExtras(plain(p), p.Extras)
+}
+
+// UnmarshalJSON keeps the unknown fields in Extras
+func (n *LogNamespace) UnmarshalJSON(raw []byte) (err error) {
+	type plain LogNamespace
+	n.Extras, err = unmarshalWithExtras(raw, (*plain)(n))
+	return err
+}
+
+// MarshalJSON writes the unknown fields kept in Extras
+func (n LogNamespace) MarshalJSON() ([]byte, error) {
+	type plain LogNamespace
+	return marshalWithExtras(plain(n), n.Extras)
 }
 
 // LogList holds a list of Log items
@@ -79,4 +250,20 @@ type LogList struct {
 	EndTime   string `json:"end_time"`
 	NextPage  string `json:"next_page"`
 	Items     []Log  `json:"logs"`
-}
\ No newline at end of file
+}
+
+// Newest returns the datetime of the newest log in this list. Zero
+// time is returned if none of the logs has a valid datetime.
+func (l LogList) Newest() time.Time {
+	var newest time.Time
+	for _, entry := range l.Items {
+		t, err := entry.Time()
+		if err != nil {
+			continue
+		}
+		if t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
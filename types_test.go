@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The MayaData Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package growthmetrics_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	gmetrics "github.com/mayadata.io/quay-logs"
+)
+
+// pullLogJSON is a pull log as returned by quay along with fields
+// that are not modelled i.e. future_field
+const pullLogJSON = `{
+	"kind": "pull_repo",
+	"ip": "10.0.0.1",
+	"datetime": "Thu, 06 Aug 2020 09:13:10 -0000",
+	"future_field": {"a": [1, 2]},
+	"metadata": {
+		"repo": "jiva",
+		"namespace": "openebs",
+		"tag": "2.0.0",
+		"manifest_digest": "sha256:abc",
+		"user-agent": "docker/19.03.8",
+		"public": true,
+		"pull_source": "mirror",
+		"resolved_ip": {
+			"provider": "aws",
+			"service": "ec2",
+			"sync_token": "1",
+			"country_iso_code": "US",
+			"aws_region": "us-east-1",
+			"city": "Ashburn"
+		}
+	},
+	"performer": {
+		"kind": "user",
+		"name": "kiran",
+		"is_robot": false,
+		"avatar": {"name": "kiran", "hash": "h", "color": "#fff", "kind": "user", "size": 32}
+	},
+	"namespace": {"kind": "org", "name": "openebs", "is_admin": true}
+}`
+
+func TestLogJSONIsLossless(t *testing.T) {
+	var entry gmetrics.Log
+	err := json.Unmarshal([]byte(pullLogJSON), &entry)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if entry.Metadata.ManifestDigest != "sha256:abc" ||
+		entry.Metadata.UserAgent != "docker/19.03.8" ||
+		entry.Metadata.ResolvedIP.AWSRegion != "us-east-1" ||
+		entry.Performer == nil || entry.Performer.Name != "kiran" ||
+		entry.Namespace == nil || entry.Namespace.Kind != "org" {
+		t.Fatalf("Expected modelled fields to be set got %+v", entry)
+	}
+	if string(entry.Extras["future_field"]) != `{"a": [1, 2]}` {
+		t.Fatalf("Expected future_field in extras got %v", entry.Extras)
+	}
+	if string(entry.Metadata.ResolvedIP.Extras["city"]) != `"Ashburn"` {
+		t.Fatalf("Expected city in extras got %v", entry.Metadata.ResolvedIP.Extras)
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	var expect, got interface{}
+	_ = json.Unmarshal([]byte(pullLogJSON), &expect)
+	_ = json.Unmarshal(raw, &got)
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("Expected log %v got %v", expect, got)
+	}
+}
+
+func TestLogTime(t *testing.T) {
+	entry := gmetrics.Log{Datetime: "Thu, 06 Aug 2020 09:13:10 -0200"}
+	got, err := entry.Time()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	expect := time.Date(2020, 8, 6, 11, 13, 10, 0, time.UTC)
+	if !got.Equal(expect) || got.Location() != time.UTC {
+		t.Fatalf("Expected time %v got %v", expect, got)
+	}
+	_, err = gmetrics.Log{Datetime: "2020-08-06"}.Time()
+	if err == nil {
+		t.Fatalf("Expected error for invalid datetime got none")
+	}
+}
+
+func TestLogKindMetadata(t *testing.T) {
+	var entry gmetrics.Log
+	err := json.Unmarshal([]byte(pullLogJSON), &entry)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	got, err := entry.KindMetadata()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	pull, ok := got.(*gmetrics.PullMetadata)
+	if !ok {
+		t.Fatalf("Expected pull metadata got %T", got)
+	}
+	if pull.Tag != "2.0.0" || pull.Public == nil || !*pull.Public || pull.ResolvedIP.CountryISOCode != "US" {
+		t.Fatalf("Expected pull metadata fields got %+v", pull)
+	}
+
+	entry = gmetrics.Log{
+		Kind: gmetrics.KindMoveTag,
+		Metadata: gmetrics.Metadata{
+			Repo:                   "jiva",
+			Tag:                    "latest",
+			ManifestDigest:         "sha256:new",
+			OriginalManifestDigest: "sha256:old",
+		},
+	}
+	got, err = entry.KindMetadata()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	tag, ok := got.(*gmetrics.TagMetadata)
+	if !ok || tag.OriginalManifestDigest != "sha256:old" || tag.Tag != "latest" {
+		t.Fatalf("Expected tag metadata got %+v", got)
+	}
+
+	entry.Kind = "unknown_kind"
+	got, err = entry.KindMetadata()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if _, ok := got.(*gmetrics.Metadata); !ok {
+		t.Fatalf("Expected metadata got %T", got)
+	}
+}